@@ -0,0 +1,34 @@
+// Поддельная Jira для разработки и демонстраций без доступа к настоящей Jira.
+//
+//	go run ./cmd/fakejira --listen 127.0.0.1:8081
+//
+// В config.yaml укажите url: http://127.0.0.1:8081 и токен пользователя из фикстуры
+// (во встроенной - demo-token). Изменения хранятся в памяти до перезапуска.
+package main
+
+import (
+	"flag"
+	"jira-go/pkg/fakejira"
+	"log"
+	"net/http"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:8081", "адрес, на котором отвечает поддельная Jira")
+	fixturePath := flag.String("fixtures", "", "JSON-файл с пользователями, переходами и задачами; по умолчанию встроенный проект DEMO")
+	flag.Parse()
+
+	fixture, err := fakejira.DefaultFixture()
+	if *fixturePath != "" {
+		fixture, err = fakejira.LoadFixture(*fixturePath)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Поддельная Jira: %d задач, %d пользователей, адрес http://%s", len(fixture.Issues), len(fixture.Users), *listen)
+	for _, user := range fixture.Users {
+		log.Printf("Пользователь %s, токен %s", user.Name, user.Token)
+	}
+	log.Fatal(http.ListenAndServe(*listen, fakejira.New(fixture)))
+}
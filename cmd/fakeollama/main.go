@@ -0,0 +1,60 @@
+// Поддельная Ollama для локальной разработки и проверок без модели и GPU.
+//
+//	go run ./cmd/fakeollama --listen 127.0.0.1:11435 --latency 200ms --chunk-delay 50ms
+//
+// В config.yaml укажите ollama: [{url: http://127.0.0.1:11435}]. Модель отвечает эхом
+// последнего сообщения или заготовкой из --replies.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"jira-go/pkg/fakeollama"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:11435", "адрес, на котором отвечает поддельная Ollama")
+	names := flag.String("models", "", "установленные модели через запятую; по умолчанию llama3:8b, mistral:7b и nomic-embed-text")
+	replies := flag.String("replies", "", `JSON-файл с заготовленными ответами {"фрагмент вопроса": "ответ"}`)
+	failEvery := flag.Int("fail-every", 0, "ошибкой из --fail завершается только каждый N-й запрос")
+	opts := fakeollama.Options{Failures: map[string]fakeollama.Failure{}}
+	flag.DurationVar(&opts.Latency, "latency", 0, "задержка перед каждым ответом")
+	flag.DurationVar(&opts.ChunkDelay, "chunk-delay", 0, "пауза между фрагментами потокового ответа")
+	flag.Func("fail", "отвечать ошибкой на запросы к пути, например /api/chat=503 (можно повторять)", func(value string) error {
+		path, code, ok := strings.Cut(value, "=")
+		status, err := strconv.Atoi(code)
+		if !ok || err != nil || status < 400 || status > 599 {
+			return fmt.Errorf("ожидается путь=код, например /api/chat=503")
+		}
+		opts.Failures[path] = fakeollama.Failure{Status: status}
+		return nil
+	})
+	flag.Parse()
+
+	if *names != "" {
+		opts.Models = fakeollama.Models(*names)
+	}
+	if *replies != "" {
+		data, err := os.ReadFile(*replies)
+		if err != nil {
+			log.Fatalf("Ошибка чтения ответов: %v", err)
+		}
+		if err := json.Unmarshal(data, &opts.Replies); err != nil {
+			log.Fatalf("Ошибка разбора ответов %s: %v", *replies, err)
+		}
+	}
+	for path, f := range opts.Failures {
+		f.Every = *failEvery
+		opts.Failures[path] = f
+	}
+
+	server := fakeollama.New(opts)
+	log.Printf("Поддельная Ollama: адрес http://%s, задержка %s, заготовленных ответов %d", *listen, opts.Latency, len(opts.Replies))
+	log.Fatal(http.ListenAndServe(*listen, server))
+}
@@ -2,4 +2,12 @@ module jira-go
 
 go 1.24.2
 
-require github.com/joho/godotenv v1.5.1
+require (
+	github.com/coreos/go-oidc/v3 v3.14.1
+	github.com/joho/godotenv v1.5.1
+	golang.org/x/crypto v0.40.0
+	golang.org/x/oauth2 v0.30.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require github.com/go-jose/go-jose/v4 v4.0.5 // indirect
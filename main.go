@@ -1,22 +1,228 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"jira-go/pkg/auth"
+	"jira-go/pkg/cli"
 	"jira-go/pkg/config"
 	"jira-go/pkg/handlers"
+	"jira-go/pkg/jira"
+	"jira-go/pkg/ollama"
+	"jira-go/pkg/prompt"
+	"jira-go/pkg/watch"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 )
 
 func main() {
+	configPath := flag.String("config", "", "путь к файлу конфигурации YAML (по умолчанию CONFIG_FILE или config.yaml)")
+	printConfig := flag.Bool("print-config", false, "вывести итоговую конфигурацию со скрытыми токенами и выйти")
+	hashPassword := flag.Bool("hash-password", false, "прочитать пароль из стандартного ввода, вывести bcrypt-хэш для auth.users и выйти")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "%s\nГлобальные флаги:\n", cli.Usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *hashPassword {
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			log.Fatal(err)
+		}
+		hash, err := auth.HashPassword(strings.TrimRight(password, "\r\n"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(hash)
+		return
+	}
+
+	// Любая команда, кроме serve, выполняется в режиме командной строки
+	if args := flag.Args(); len(args) > 0 && args[0] != "serve" {
+		if err := cli.Run(*configPath, args, os.Stdin, os.Stdout, os.Stderr); err != nil {
+			if errors.Is(err, cli.ErrUsage) {
+				os.Exit(2)
+			}
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	log.Println("Запуск приложения")
-	config := config.LoadConfig()
-	if config.JiraToken == "" {
-		log.Fatal("JIRA_TOKEN не установлен. Добавьте его в .env файл или переменные окружения")
+
+	if *printConfig {
+		cfg, err := config.Read(*configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		masked, err := cfg.Masked()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(masked)
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	// Инициализируем handlers с конфигом
-	handlers.InitHandlers(config)
+	if err := run(*configPath); err != nil {
+		log.Fatal(err)
+	}
+}
 
-	log.Println("Сервер запущен на порту 8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+// run запускает сервер и блокируется до SIGINT/SIGTERM. При остановке сервер перестает
+// принимать соединения, ждет завершения начатых запросов не дольше server.shutdown_timeout
+// и останавливает фоновые задачи.
+func run(configPath string) error {
+	config, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+
+	if config.Log.File != "" {
+		logFile, err := os.OpenFile(config.Log.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("ошибка открытия файла журнала: %v", err)
+		}
+		defer func() {
+			log.SetOutput(os.Stderr)
+			logFile.Sync()
+			logFile.Close()
+		}()
+		log.SetOutput(io.MultiWriter(os.Stderr, logFile))
+	}
+
+	applySettings(config)
+
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	// Обработчики с клиентами Jira и Ollama по конфигурации
+	srv, err := handlers.New(config, handlers.Deps{})
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+
+	stopReloader := startReloader(configPath, config, srv)
+	defer stopReloader()
+
+	server := &http.Server{
+		Addr:              config.Server.Listen,
+		Handler:           srv,
+		ReadHeaderTimeout: config.Server.ReadTimeout,
+		ReadTimeout:       config.Server.ReadTimeout,
+		WriteTimeout:      config.Server.WriteTimeout,
+		IdleTimeout:       config.Server.IdleTimeout,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Сервер запущен на %s", config.Server.Listen)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	log.Printf("Получен сигнал остановки, ждем завершения запросов (не дольше %v)", config.Server.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Не все запросы завершились вовремя, соединения закрыты принудительно: %v", err)
+		server.Close()
+	}
+	log.Println("Сервер остановлен")
+	return nil
+}
+
+// applySettings применяет параметры конфигурации, которые можно менять без перезапуска
+func applySettings(cfg *config.Config) {
+	if cfg.Debug() {
+		log.SetFlags(log.LstdFlags | log.Lshortfile)
+	} else {
+		log.SetFlags(log.LstdFlags)
+	}
+	jira.SetTimeout(cfg.Timeouts.Jira)
+	ollama.SetTimeout(cfg.Timeouts.Ollama)
+	prompt.SetDir(cfg.PromptDir)
+}
+
+// startReloader перезагружает конфигурацию и шаблоны по SIGHUP и при изменении файлов.
+// Если новая конфигурация или шаблоны содержат ошибки, сервер продолжает работать со старыми.
+// Возвращает функцию, которая останавливает отслеживание.
+func startReloader(configPath string, initial *config.Config, srv *handlers.Server) func() {
+	var mu sync.Mutex
+	current := initial
+
+	reload := func(reason string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		log.Printf("Перезагрузка: %s", reason)
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			log.Printf("Конфигурация не перезагружена, используется прежняя: %v", err)
+			// Шаблоны все равно перечитываем, их правка не зависит от конфигурации
+			if err := srv.Reload(nil); err != nil {
+				log.Print(err)
+			}
+			return
+		}
+		if err := srv.Reload(cfg); err != nil {
+			log.Print(err)
+			return
+		}
+		applySettings(cfg)
+		current = cfg
+	}
+
+	stop := make(chan struct{})
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-hup:
+				reload("получен SIGHUP")
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	if initial.Server.Watch > 0 {
+		paths := func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return []string{config.Path(configPath), ".env", current.Server.TemplatesDir}
+		}
+		go watch.Poll(paths, initial.Server.Watch, stop, func() {
+			reload("изменились файлы конфигурации или шаблонов")
+		})
+	}
+
+	return func() {
+		signal.Stop(hup)
+		close(stop)
+	}
 }
@@ -19,10 +19,21 @@ type Stats struct {
 	TaskCount  int `json:"taskCount"`
 }
 
+// ExportColumn - столбец выгрузки задач для выбора на странице
+type ExportColumn struct {
+	Name    string `json:"name"`
+	Title   string `json:"title"`
+	Checked bool   `json:"checked"`
+}
+
 type TemplateData struct {
 	Models        []map[string]interface{} `json:"models"`
 	Tasks         []jira.JiraTask          `json:"tasks"`
 	Error         string                   `json:"error"`
 	SelectedModel string                   `json:"selectedModel"`
+	JiraInstances []string                 `json:"jiraInstances"`
+	ExportColumns []ExportColumn           `json:"exportColumns"`
+	User          string                   `json:"user"`
+	CSRFToken     string                   `json:"-"`
 	Stats         Stats                    `json:"stats"`
 }
@@ -0,0 +1,365 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"jira-go/pkg/config"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	sessionCookie = "session"
+	// MethodPassword и MethodOIDC - способ, которым пользователь вошел
+	MethodPassword = "password"
+	MethodOIDC     = "oidc"
+)
+
+// dummyHash сравнивается с паролем для несуществующих пользователей, чтобы по времени
+// ответа нельзя было понять, есть ли такой пользователь
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+// publicPrefixes - адреса, доступные без входа
+var publicPrefixes = []string{"/login", "/logout", "/auth/", "/static/", "/healthz", "/readyz", "/api/v1/openapi.json"}
+
+// APIPrefix - адреса версионного API: отказы во входе и по CSRF для них отдаются
+// в формате ошибок API
+const APIPrefix = "/api/v1/"
+
+type User struct {
+	Name   string `json:"name"`
+	Method string `json:"method"`
+	// Subject - постоянный идентификатор (sub) пользователя у провайдера OIDC
+	Subject string `json:"subject,omitempty"`
+}
+
+// ID - ключ личных данных пользователя (токены Jira, кэш задач, выбранная модель).
+// Имя OIDC берется из preferred_username или email и может совпасть с именем локального
+// пользователя, поэтому пользователи OIDC различаются по sub, а ключи разных способов
+// входа не пересекаются.
+func (u User) ID() string {
+	if u.Method == MethodOIDC {
+		return "oidc:" + u.Subject
+	}
+	return "local:" + u.Name
+}
+
+type contextKey struct{}
+
+// WithUser добавляет пользователя в контекст запроса
+func WithUser(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// UserFromContext возвращает вошедшего пользователя; ok равен false, если вход отключен
+func UserFromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(contextKey{}).(User)
+	return user, ok
+}
+
+// UserName возвращает имя пользователя для журналов
+func UserName(ctx context.Context) string {
+	if user, ok := UserFromContext(ctx); ok {
+		return user.Name
+	}
+	return "anonymous"
+}
+
+type session struct {
+	user    User
+	expires time.Time
+}
+
+// LoginPage - данные для шаблона login.html
+type LoginPage struct {
+	Error    string
+	Next     string
+	Password bool
+	OIDC     bool
+	User     string
+	// CSRFToken выводится в формы входа и выхода
+	CSRFToken string
+}
+
+// Authenticator проверяет вход в веб-интерфейс: локальные пользователи с bcrypt-паролями
+// из конфигурации и, если настроен, вход через OIDC. Сессии хранятся в памяти.
+type Authenticator struct {
+	cfg atomic.Pointer[config.AuthConfig]
+
+	mu       sync.Mutex
+	sessions map[string]session
+
+	oidcMu sync.Mutex
+	oidc   *oidcClient
+
+	render func(w http.ResponseWriter, page LoginPage) error
+}
+
+// New создает Authenticator; render выводит страницу входа
+func New(cfg config.AuthConfig, render func(w http.ResponseWriter, page LoginPage) error) *Authenticator {
+	a := &Authenticator{sessions: map[string]session{}, render: render}
+	a.SetConfig(cfg)
+	return a
+}
+
+// SetConfig применяет новые настройки входа. Уже открытые сессии пользователей,
+// которых больше нет в конфигурации, закрываются.
+func (a *Authenticator) SetConfig(cfg config.AuthConfig) {
+	a.cfg.Store(&cfg)
+
+	known := map[string]bool{}
+	for _, u := range cfg.Users {
+		known[u.Name] = true
+	}
+	a.mu.Lock()
+	for token, s := range a.sessions {
+		if s.user.Method == MethodPassword && !known[s.user.Name] {
+			delete(a.sessions, token)
+		}
+	}
+	a.mu.Unlock()
+
+	a.oidcMu.Lock()
+	if a.oidc != nil && a.oidc.cfg != cfg.OIDC {
+		a.oidc = nil
+	}
+	a.oidcMu.Unlock()
+}
+
+// Register добавляет страницы входа и выхода
+func (a *Authenticator) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/login", a.loginHandler)
+	mux.HandleFunc("/logout", a.logoutHandler)
+	mux.HandleFunc("/auth/oidc", a.oidcLoginHandler)
+	mux.HandleFunc("/auth/callback", a.oidcCallbackHandler)
+}
+
+// Middleware пропускает к next только вошедших пользователей и пишет каждый запрос в журнал аудита.
+// Страницы без входа перенаправляются на /login, API отвечает 401.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := a.cfg.Load()
+
+		if !cfg.Disabled {
+			if user, ok := a.sessionUser(r); ok {
+				r = r.WithContext(WithUser(r.Context(), user))
+			} else if !public(r.URL.Path) {
+				a.deny(w, r)
+				return
+			}
+		}
+
+		// Статику и проверки состояния не пишем в аудит, их слишком много
+		if strings.HasPrefix(r.URL.Path, "/static/") || r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		Audit(r, "request", "%s %s -> %d (%v)", r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond))
+	})
+}
+
+// Audit пишет событие в журнал аудита с именем пользователя и адресом клиента
+func Audit(r *http.Request, action string, format string, args ...interface{}) {
+	log.Printf("[audit] user=%s ip=%s action=%s %s", UserName(r.Context()), clientIP(r), action, fmt.Sprintf(format, args...))
+}
+
+func (a *Authenticator) deny(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, APIPrefix) {
+		apiError(w, http.StatusUnauthorized, "unauthorized", "требуется вход")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte(`{"error":"требуется вход"}` + "\n"))
+}
+
+// apiError отвечает ошибкой в формате API: {"error": {"code": ..., "message": ...}}
+func apiError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"code": code, "message": message},
+	})
+}
+
+func (a *Authenticator) loginHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := a.cfg.Load()
+	page := LoginPage{Next: safeNext(r.FormValue("next")), Password: len(cfg.Users) > 0, OIDC: cfg.OIDC.Enabled(), CSRFToken: CSRFToken(r.Context())}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		name := strings.TrimSpace(r.FormValue("username"))
+		if user, ok := a.checkPassword(cfg, name, r.FormValue("password")); ok {
+			a.startSession(w, r, user)
+			Audit(r.WithContext(WithUser(r.Context(), user)), "login", "успешный вход по паролю")
+			http.Redirect(w, r, page.Next, http.StatusFound)
+			return
+		}
+		Audit(r, "login-failed", "неверный пароль для %q", name)
+		page.Error = "Неверное имя пользователя или пароль"
+		w.WriteHeader(http.StatusUnauthorized)
+	default:
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := a.render(w, page); err != nil {
+		log.Printf("Ошибка выполнения шаблона: %v", err)
+	}
+}
+
+func (a *Authenticator) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		a.mu.Lock()
+		if s, ok := a.sessions[cookie.Value]; ok {
+			Audit(r.WithContext(WithUser(r.Context(), s.user)), "logout", "выход")
+			delete(a.sessions, cookie.Value)
+		}
+		a.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
+
+func (a *Authenticator) checkPassword(cfg *config.AuthConfig, name, password string) (User, bool) {
+	hash := dummyHash
+	found := false
+	for _, u := range cfg.Users {
+		if u.Name == name {
+			hash, found = []byte(u.PasswordHash), true
+			break
+		}
+	}
+	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+	if err != nil || !found {
+		return User{}, false
+	}
+	return User{Name: name, Method: MethodPassword}, true
+}
+
+func (a *Authenticator) startSession(w http.ResponseWriter, r *http.Request, user User) {
+	ttl := a.cfg.Load().SessionTTL
+	token := randomToken()
+
+	a.mu.Lock()
+	now := time.Now()
+	for t, s := range a.sessions {
+		if now.After(s.expires) {
+			delete(a.sessions, t)
+		}
+	}
+	a.sessions[token] = session{user: user, expires: now.Add(ttl)}
+	a.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   secure(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (a *Authenticator) sessionUser(r *http.Request) (User, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return User{}, false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s, ok := a.sessions[cookie.Value]
+	if !ok {
+		return User{}, false
+	}
+	if time.Now().After(s.expires) {
+		delete(a.sessions, cookie.Value)
+		return User{}, false
+	}
+	return s.user, true
+}
+
+// HashPassword возвращает bcrypt-хэш пароля для auth.users[].password_hash
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("ошибка хэширования пароля: %v", err)
+	}
+	return string(hash), nil
+}
+
+func public(path string) bool {
+	for _, prefix := range publicPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// safeNext разрешает перенаправление после входа только на адреса этого же сервера
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+func secure(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+func clientIP(r *http.Request) string {
+	if i := strings.LastIndex(r.RemoteAddr, ":"); i > 0 {
+		return r.RemoteAddr[:i]
+	}
+	return r.RemoteAddr
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("нет источника случайных чисел: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// statusRecorder запоминает код ответа для журнала аудита
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
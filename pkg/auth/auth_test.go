@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"fmt"
+	"jira-go/pkg/config"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func testAuthenticator(t *testing.T) (*Authenticator, http.Handler) {
+	t.Helper()
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := New(config.AuthConfig{
+		SessionTTL: 1e12,
+		Users:      []config.AuthUser{{Name: "alice", PasswordHash: hash}},
+	}, func(w http.ResponseWriter, page LoginPage) error {
+		_, err := fmt.Fprintf(w, "login page error=%q next=%q", page.Error, page.Next)
+		return err
+	})
+
+	mux := http.NewServeMux()
+	a.Register(mux)
+	mux.HandleFunc("/api/tasks", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello "+UserName(r.Context()))
+	})
+	return a, a.Middleware(mux)
+}
+
+func login(t *testing.T, handler http.Handler, password string) *httptest.ResponseRecorder {
+	t.Helper()
+	form := url.Values{"username": {"alice"}, "password": {password}, "next": {"/epic"}}
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddlewareRequiresLogin(t *testing.T) {
+	_, handler := testAuthenticator(t)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/api/tasks", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for API, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/api/tasks?x=1&y=2", nil)
+	req.Header.Set("Accept", "text/html")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/login?next=%2Fapi%2Ftasks%3Fx%3D1%26y%3D2" {
+		t.Errorf("expected redirect to login, got %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+
+	// Версионное API отвечает ошибкой в своем формате
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/tasks", nil))
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), `"code":"unauthorized"`) {
+		t.Errorf("expected API error envelope, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/login", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "login page") {
+		t.Errorf("expected login page to be public, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLoginAndLogout(t *testing.T) {
+	_, handler := testAuthenticator(t)
+
+	rec := login(t, handler, "wrong")
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "Неверное имя") {
+		t.Fatalf("expected failed login, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = login(t, handler, "secret")
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/epic" {
+		t.Fatalf("expected redirect after login, got %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookie || !cookies[0].HttpOnly {
+		t.Fatalf("expected HttpOnly session cookie, got %+v", cookies)
+	}
+
+	req := httptest.NewRequest("GET", "/api/tasks", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Body.String() != "hello alice" {
+		t.Errorf("expected request as alice, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest("POST", "/logout", nil)
+	req.AddCookie(cookies[0])
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest("GET", "/api/tasks", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected session to be closed after logout, got %d", rec.Code)
+	}
+}
+
+func TestSetConfigDropsRemovedUsers(t *testing.T) {
+	a, handler := testAuthenticator(t)
+	cookie := login(t, handler, "secret").Result().Cookies()[0]
+
+	a.SetConfig(config.AuthConfig{SessionTTL: 1e12, OIDC: config.OIDCConfig{Issuer: "https://idp.example.com"}})
+
+	req := httptest.NewRequest("GET", "/api/tasks", nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected removed user to lose the session, got %d", rec.Code)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	a, handler := testAuthenticator(t)
+	a.SetConfig(config.AuthConfig{Disabled: true})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/api/tasks", nil))
+	if rec.Body.String() != "hello anonymous" {
+		t.Errorf("expected open access when auth is disabled, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSafeNext(t *testing.T) {
+	tests := map[string]string{
+		"":                     "/",
+		"/epic":                "/epic",
+		"//evil.example.com":   "/",
+		"https://evil.example": "/",
+		"/\\evil.example.com":  "/",
+	}
+	for input, expected := range tests {
+		if got := safeNext(input); got != expected {
+			t.Errorf("safeNext(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	handler := CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(CSRFToken(r.Context())))
+	}))
+
+	// GET выдает токен в cookie и в контексте
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != csrfCookie || cookies[0].Value != rec.Body.String() {
+		t.Fatalf("expected csrf cookie matching page token, got %v / %q", cookies, rec.Body.String())
+	}
+	token := cookies[0].Value
+
+	post := func(header, field, origin string) int {
+		form := url.Values{}
+		if field != "" {
+			form.Set(CSRFField, field)
+		}
+		req := httptest.NewRequest("POST", "/send-to-ai", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: csrfCookie, Value: token})
+		if header != "" {
+			req.Header.Set(CSRFHeader, header)
+		}
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	cases := []struct {
+		name                  string
+		header, field, origin string
+		want                  int
+	}{
+		{"header", token, "", "", http.StatusOK},
+		{"form field", "", token, "", http.StatusOK},
+		{"same origin", token, "", "http://example.com", http.StatusOK},
+		{"missing token", "", "", "", http.StatusForbidden},
+		{"wrong token", "forged", "", "", http.StatusForbidden},
+		{"foreign origin", token, "", "https://evil.example", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		if got := post(c.header, c.field, c.origin); got != c.want {
+			t.Errorf("%s: expected %d, got %d", c.name, c.want, got)
+		}
+	}
+}
+
+func TestCSRFAPIError(t *testing.T) {
+	handler := CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("POST", "/api/v1/chat", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), `"code":"csrf_rejected"`) {
+		t.Errorf("expected API error envelope, got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"jira-go/pkg/config"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	stateCookie = "oidc_state"
+	nonceCookie = "oidc_nonce"
+	nextCookie  = "oidc_next"
+	// oidcFlowTTL - сколько ждать возврата пользователя от провайдера
+	oidcFlowTTL = 10 * time.Minute
+)
+
+type oidcClient struct {
+	cfg      config.OIDCConfig
+	verifier *oidc.IDTokenVerifier
+	oauth    oauth2.Config
+}
+
+// oidcClient подключается к провайдеру при первом входе, чтобы недоступный провайдер
+// не мешал запуску сервера
+func (a *Authenticator) oidcClient(ctx context.Context) (*oidcClient, error) {
+	cfg := a.cfg.Load().OIDC
+	if !cfg.Enabled() {
+		return nil, fmt.Errorf("вход через OIDC не настроен")
+	}
+
+	a.oidcMu.Lock()
+	defer a.oidcMu.Unlock()
+	if a.oidc != nil && a.oidc.cfg == cfg {
+		return a.oidc, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к провайдеру OIDC: %v", err)
+	}
+	a.oidc = &oidcClient{
+		cfg:      cfg,
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+	}
+	return a.oidc, nil
+}
+
+// oidcLoginHandler перенаправляет пользователя к провайдеру OIDC
+func (a *Authenticator) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	client, err := a.oidcClient(r.Context())
+	if err != nil {
+		log.Printf("Ошибка входа через OIDC: %v", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	state, nonce := randomToken(), randomToken()
+	a.setFlowCookie(w, r, stateCookie, state)
+	a.setFlowCookie(w, r, nonceCookie, nonce)
+	a.setFlowCookie(w, r, nextCookie, safeNext(r.FormValue("next")))
+
+	http.Redirect(w, r, client.oauth.AuthCodeURL(state, oidc.Nonce(nonce)), http.StatusFound)
+}
+
+// oidcCallbackHandler принимает код от провайдера, проверяет ID-токен и открывает сессию
+func (a *Authenticator) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	client, err := a.oidcClient(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	state, err := r.Cookie(stateCookie)
+	if err != nil || r.URL.Query().Get("state") != state.Value {
+		Audit(r, "login-failed", "OIDC: неверный state")
+		http.Error(w, "Неверный параметр state, начните вход заново", http.StatusBadRequest)
+		return
+	}
+	if e := r.URL.Query().Get("error"); e != "" {
+		Audit(r, "login-failed", "OIDC: провайдер вернул ошибку %s", e)
+		http.Error(w, "Провайдер отклонил вход: "+e, http.StatusUnauthorized)
+		return
+	}
+
+	token, err := client.oauth.Exchange(r.Context(), r.URL.Query().Get("code"))
+	if err != nil {
+		log.Printf("Ошибка обмена кода OIDC: %v", err)
+		http.Error(w, "Ошибка обмена кода авторизации", http.StatusBadGateway)
+		return
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		http.Error(w, "Провайдер не вернул id_token", http.StatusBadGateway)
+		return
+	}
+	idToken, err := client.verifier.Verify(r.Context(), rawIDToken)
+	if err != nil {
+		Audit(r, "login-failed", "OIDC: недействительный id_token: %v", err)
+		http.Error(w, "Недействительный id_token", http.StatusUnauthorized)
+		return
+	}
+	if nonce, err := r.Cookie(nonceCookie); err != nil || idToken.Nonce != nonce.Value {
+		Audit(r, "login-failed", "OIDC: неверный nonce")
+		http.Error(w, "Неверный nonce, начните вход заново", http.StatusUnauthorized)
+		return
+	}
+
+	var claims struct {
+		PreferredUsername string `json:"preferred_username"`
+		Email             string `json:"email"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		http.Error(w, "Ошибка чтения данных пользователя", http.StatusBadGateway)
+		return
+	}
+	name := claims.PreferredUsername
+	if name == "" {
+		name = claims.Email
+	}
+	if name == "" {
+		name = idToken.Subject
+	}
+
+	next := "/"
+	if c, err := r.Cookie(nextCookie); err == nil {
+		next = safeNext(c.Value)
+	}
+	for _, c := range []string{stateCookie, nonceCookie, nextCookie} {
+		http.SetCookie(w, &http.Cookie{Name: c, Value: "", Path: "/auth/", MaxAge: -1, HttpOnly: true})
+	}
+
+	user := User{Name: name, Method: MethodOIDC, Subject: idToken.Subject}
+	a.startSession(w, r, user)
+	Audit(r.WithContext(WithUser(r.Context(), user)), "login", "успешный вход через OIDC")
+	http.Redirect(w, r, next, http.StatusFound)
+}
+
+func (a *Authenticator) setFlowCookie(w http.ResponseWriter, r *http.Request, name, value string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/auth/",
+		MaxAge:   int(oidcFlowTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   secure(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
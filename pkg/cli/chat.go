@@ -0,0 +1,353 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"jira-go/models"
+	"jira-go/pkg/config"
+	"jira-go/pkg/jira"
+	"jira-go/pkg/prompt"
+	"jira-go/pkg/source"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+)
+
+const chatHelp = `Команды чата:
+  /tasks [PROJ]     список задач проекта
+  /open N|KEY       открыть задачу по номеру в списке или ключу; история сбрасывается
+  /model [NAME]     показать модели или переключиться на другую
+  /context          что из задачи попало в контекст модели
+  /comment [текст]  добавить в задачу комментарий: текст или последний ответ модели
+  /reset            начать разговор заново
+  /help             эта справка
+  /quit             выйти
+Остальной ввод отправляется модели как вопрос.
+`
+
+// maxInputLine - самая длинная строка ввода, например вставленный текст комментария
+const maxInputLine = 1 << 20
+
+// chatSession - состояние интерактивного чата: открытая задача, модель и история разговора
+type chatSession struct {
+	e        *env
+	in       *bufio.Scanner
+	instance config.JiraInstance
+	model    string
+	project  string
+	tasks    []jira.JiraTask
+	task     *jira.JiraTask
+	history  []models.Message
+	report   *prompt.Report
+	// answer - последний ответ модели, его добавляет в задачу /comment без текста
+	answer string
+}
+
+// chat - интерактивный разговор с моделью о задаче: выбор проекта и задачи, затем
+// вопросы с потоковым выводом ответа и командами, начинающимися с /
+func chat(e *env, args []string) error {
+	fs := flag.NewFlagSet("chat", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	project := fs.String("project", "", "ключ проекта Jira; если не задан, будет запрошен")
+	issue := fs.String("issue", "", "сразу открыть задачу, например PROJ-123")
+	model := fs.String("model", e.cfg.DefaultModel, "модель Ollama; если не задана, будет предложен выбор")
+	instanceName := fs.String("instance", "", "имя подключения Jira")
+	if err := fs.Parse(args); err != nil {
+		return ErrUsage
+	}
+	instance, err := e.instance(*instanceName)
+	if err != nil {
+		return err
+	}
+
+	s := &chatSession{e: e, in: bufio.NewScanner(e.stdin), instance: instance, model: *model}
+	s.in.Buffer(make([]byte, 64*1024), maxInputLine)
+	e.pool.Refresh()
+
+	if s.model == "" {
+		if !s.chooseModel() {
+			return nil
+		}
+	}
+	fmt.Fprintf(e.stdout, "Модель: %s. Подключение Jira: %s. Справка - /help\n", s.model, instance.Name)
+
+	switch {
+	case *issue != "":
+		s.open(*issue)
+	default:
+		if *project == "" {
+			line, ok := s.readLine("Ключ проекта Jira: ")
+			if !ok {
+				return nil
+			}
+			*project = line
+		}
+		s.listTasks(*project)
+	}
+
+	for {
+		line, ok := s.readLine(s.promptLabel())
+		if !ok {
+			fmt.Fprintln(e.stdout)
+			return nil
+		}
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "/") {
+			s.question(line)
+			continue
+		}
+
+		command, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+		switch command {
+		case "/quit", "/exit":
+			return nil
+		case "/help":
+			fmt.Fprint(e.stdout, chatHelp)
+		case "/tasks":
+			if arg == "" {
+				arg = s.project
+			}
+			s.listTasks(arg)
+		case "/open":
+			s.open(arg)
+		case "/model":
+			s.switchModel(arg)
+		case "/context":
+			s.showContext()
+		case "/comment":
+			s.comment(arg)
+		case "/reset":
+			s.reset()
+			fmt.Fprintln(e.stdout, "История разговора очищена")
+		default:
+			fmt.Fprintf(e.stdout, "Неизвестная команда %s, справка - /help\n", command)
+		}
+	}
+}
+
+// readLine выводит приглашение и читает строку; false - ввод закончился
+func (s *chatSession) readLine(label string) (string, bool) {
+	fmt.Fprint(s.e.stdout, label)
+	if !s.in.Scan() {
+		return "", false
+	}
+	return strings.TrimSpace(s.in.Text()), true
+}
+
+func (s *chatSession) promptLabel() string {
+	if s.task != nil {
+		return s.task.Key + "> "
+	}
+	return "> "
+}
+
+// chooseModel предлагает выбрать модель из доступных на серверах Ollama
+func (s *chatSession) chooseModel() bool {
+	list := s.e.pool.Models()
+	if len(list) == 0 {
+		fmt.Fprintln(s.e.stdout, "Нет доступных серверов Ollama с моделями, укажите --model")
+		return false
+	}
+	s.printModels(list)
+	for {
+		line, ok := s.readLine("Выберите модель (номер): ")
+		if !ok {
+			return false
+		}
+		if n, err := strconv.Atoi(line); err == nil && n >= 1 && n <= len(list) {
+			s.model = fmt.Sprint(list[n-1]["name"])
+			return true
+		}
+		fmt.Fprintf(s.e.stdout, "Введите номер от 1 до %d\n", len(list))
+	}
+}
+
+func (s *chatSession) printModels(list []map[string]interface{}) {
+	fmt.Fprintln(s.e.stdout, "Доступные модели ИИ:")
+	for i, m := range list {
+		mark := " "
+		if m["name"] == s.model {
+			mark = "*"
+		}
+		fmt.Fprintf(s.e.stdout, "%s%d - %v\n", mark, i+1, m["name"])
+	}
+}
+
+// switchModel переключает модель; история сохраняется, контекст задачи уже в ней
+func (s *chatSession) switchModel(name string) {
+	list := s.e.pool.Models()
+	if name == "" {
+		s.printModels(list)
+		return
+	}
+	if n, err := strconv.Atoi(name); err == nil && n >= 1 && n <= len(list) {
+		name = fmt.Sprint(list[n-1]["name"])
+	} else if len(list) > 0 && !knownModel(list, name) {
+		fmt.Fprintf(s.e.stdout, "Модель %s не найдена на серверах Ollama\n", name)
+		return
+	}
+	s.model = name
+	fmt.Fprintf(s.e.stdout, "Модель: %s\n", name)
+}
+
+// listTasks получает задачи проекта так же, как веб-интерфейс, и выводит их с номерами
+func (s *chatSession) listTasks(project string) {
+	key := strings.ToUpper(strings.TrimSpace(project))
+	if !jira.ValidProjectKey(key) {
+		fmt.Fprintln(s.e.stdout, "Неверный ключ проекта, ожидаются латинские буквы, цифры и _, например PROJ")
+		return
+	}
+	found, err := source.New(s.instance, nil).ProjectTasks(key)
+	if err != nil {
+		fmt.Fprintf(s.e.stdout, "Ошибка получения задач: %v\n", err)
+		return
+	}
+	s.project, s.tasks = key, found.Issues
+	if len(s.tasks) == 0 {
+		period := "за последнюю неделю"
+		if s.instance.Offline() {
+			period = "в выгрузке"
+		}
+		fmt.Fprintf(s.e.stdout, "В проекте %s нет незакрытых задач %s. Задачу можно открыть по ключу: /open KEY\n", key, period)
+		return
+	}
+
+	fmt.Fprintln(s.e.stdout, "Найденные задачи:")
+	for i, t := range s.tasks {
+		fmt.Fprintf(s.e.stdout, "%3d. %s [%s] %s\n", i+1, t.Key, t.Fields.Status.Name, oneLine(t.Fields.Summary))
+	}
+	if found.Partial {
+		fmt.Fprintf(s.e.stdout, "Показаны %d из %d найденных задач\n", len(s.tasks), found.Total)
+	}
+	fmt.Fprintln(s.e.stdout, "Откройте задачу: /open номер или ключ")
+}
+
+// open открывает задачу по номеру в последнем списке или по ключу и начинает разговор заново
+func (s *chatSession) open(ref string) {
+	key := strings.ToUpper(strings.TrimSpace(ref))
+	if n, err := strconv.Atoi(key); err == nil {
+		if n < 1 || n > len(s.tasks) {
+			fmt.Fprintf(s.e.stdout, "В списке нет задачи с номером %d\n", n)
+			return
+		}
+		key = s.tasks[n-1].Key
+	}
+	if !jira.ValidIssueKey(key) {
+		fmt.Fprintln(s.e.stdout, "Неверный ключ задачи, ожидается вид PROJ-123")
+		return
+	}
+
+	// В списке задач нет комментариев и связей, поэтому запрашиваем задачу целиком
+	task, err := source.New(s.instance, nil).Issue(key)
+	if err != nil {
+		fmt.Fprintf(s.e.stdout, "Ошибка получения задачи %s: %v\n", key, err)
+		return
+	}
+	task.Instance = s.instance.Name
+	s.task = task
+	s.reset()
+
+	fmt.Fprintf(s.e.stdout, "Работаем с задачей: %s\nЗаголовок: %s\nСтатус: %s\n",
+		task.Key, task.Fields.Summary, task.Fields.Status.Name)
+	if description := strings.TrimSpace(task.Fields.Description.Markdown()); description != "" {
+		fmt.Fprintf(s.e.stdout, "Описание: %s\n", prompt.Truncate(description, 200))
+	}
+}
+
+func (s *chatSession) reset() {
+	s.history, s.report, s.answer = nil, nil, ""
+}
+
+// question отправляет вопрос модели и выводит ответ по мере генерации. Контекст задачи
+// добавляется к первому вопросу разговора, дальше он уже есть в истории.
+func (s *chatSession) question(text string) {
+	content := text
+	var report *prompt.Report
+	if len(s.history) == 0 && s.task != nil {
+		message, r := s.e.taskMessage(s.model, text, *s.task)
+		if len(r.Dropped) > 0 {
+			fmt.Fprintf(s.e.stdout, "В контекст не поместились разделы: %s\n", strings.Join(r.Dropped, ", "))
+		}
+		content, report = message, &r
+	}
+
+	// Ctrl+C во время ответа прерывает генерацию, но не сам чат
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	messages := append(s.history, models.Message{Role: "user", Content: content})
+	answer, err := s.e.pool.ChatStream(ctx, s.model, messages, func(chunk string) {
+		io.WriteString(s.e.stdout, chunk)
+	})
+	fmt.Fprintln(s.e.stdout)
+	if ctx.Err() != nil {
+		fmt.Fprintln(s.e.stdout, "Ответ прерван")
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(s.e.stdout, "Ошибка запроса к модели: %v\n", err)
+		return
+	}
+
+	s.history = append(messages, models.Message{Role: "assistant", Content: answer})
+	if report != nil {
+		s.report = report
+	}
+	s.answer = answer
+}
+
+// showContext выводит, какие разделы задачи попали в контекст и сколько токенов заняли
+func (s *chatSession) showContext() {
+	if s.report == nil {
+		fmt.Fprintln(s.e.stdout, "Контекст задачи собирается при первом вопросе о ней")
+		return
+	}
+	fmt.Fprintf(s.e.stdout, "Окно модели: %d токенов, под задачу: %d, занято: %d\n", s.report.NumCtx, s.report.Budget, s.report.Used)
+	rows := make([][]string, 0, len(s.report.Sections))
+	for _, section := range s.report.Sections {
+		rows = append(rows, []string{section.Name, section.Action, strconv.Itoa(section.Tokens), strconv.Itoa(section.Kept)})
+	}
+	writeRows(s.e.stdout, formatTable, []string{"Раздел", "Действие", "Токенов", "Оставлено"}, rows)
+	fmt.Fprintf(s.e.stdout, "Сообщений в истории: %d\n", len(s.history))
+}
+
+// comment добавляет в открытую задачу комментарий от имени владельца токена из конфигурации
+func (s *chatSession) comment(text string) {
+	if s.task == nil {
+		fmt.Fprintln(s.e.stdout, "Сначала откройте задачу: /open")
+		return
+	}
+	if text == "" {
+		text = s.answer
+	}
+	if text == "" {
+		fmt.Fprintln(s.e.stdout, "Нет ответа модели для комментария, укажите текст: /comment текст")
+		return
+	}
+	if s.instance.Offline() {
+		fmt.Fprintf(s.e.stdout, "Подключение %s работает с выгрузкой из файла, комментарий добавить нельзя\n", s.instance.Name)
+		return
+	}
+	if _, err := jira.AddComment(s.instance.URL, s.instance.Token, s.task.Key, text); err != nil {
+		fmt.Fprintf(s.e.stdout, "Ошибка добавления комментария: %v\n", err)
+		return
+	}
+	fmt.Fprintf(s.e.stdout, "Комментарий добавлен в %s\n", s.task.Key)
+}
+
+// knownModel сообщает, есть ли модель в списке, полученном от серверов Ollama
+func knownModel(list []map[string]interface{}, name string) bool {
+	for _, m := range list {
+		if m["name"] == name {
+			return true
+		}
+	}
+	return false
+}
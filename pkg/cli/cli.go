@@ -0,0 +1,305 @@
+// Package cli - режим командной строки: те же запросы к Jira и Ollama, что и в веб-интерфейсе,
+// но с выводом в терминал в виде таблицы, Markdown или JSON
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"jira-go/models"
+	"jira-go/pkg/config"
+	"jira-go/pkg/jira"
+	"jira-go/pkg/ollama"
+	"jira-go/pkg/prompt"
+	"jira-go/pkg/source"
+	"jira-go/pkg/summarize"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// ErrUsage - команда вызвана с неверными аргументами; справка уже выведена
+var ErrUsage = errors.New("неверные аргументы команды")
+
+// Usage - справка по командам
+const Usage = `Использование: jira-ai [--config файл] <команда> [параметры]
+
+Команды:
+  serve                                  запустить веб-сервер (по умолчанию)
+  tasks list --project PROJ [--jql JQL]  список задач проекта или задач по JQL
+  ask --issue PROJ-1 --model M "вопрос"  вопрос к модели с контекстом задачи
+  chat [--project PROJ] [--issue PROJ-1]  интерактивный разговор с моделью о задаче
+  models list                            модели на серверах Ollama
+  help                                   эта справка
+
+Общие параметры команд:
+  --output table|markdown|json           формат вывода (по умолчанию table)
+  --instance NAME                        подключение Jira (по умолчанию первое)
+`
+
+// env - окружение команды: конфигурация и потоки ввода-вывода
+type env struct {
+	cfg    *config.Config
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	pool   *ollama.Pool
+}
+
+// Run выполняет команду командной строки; args - аргументы после глобальных флагов
+// (например, ["tasks", "list", "--project", "PROJ"]). Команда serve сюда не попадает.
+func Run(configPath string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(stdout, Usage)
+		return nil
+	}
+
+	var command func(e *env, args []string) error
+	switch {
+	case args[0] == "ask":
+		command, args = ask, args[1:]
+	case args[0] == "chat":
+		command, args = chat, args[1:]
+	case len(args) > 1 && args[0] == "tasks" && args[1] == "list":
+		command, args = tasksList, args[2:]
+	case len(args) > 1 && args[0] == "models" && args[1] == "list":
+		command, args = modelsList, args[2:]
+	default:
+		fmt.Fprintf(stderr, "Неизвестная команда: %s\n\n%s", strings.Join(args, " "), Usage)
+		return ErrUsage
+	}
+
+	cfg, err := config.LoadClient(configPath)
+	if err != nil {
+		return err
+	}
+	// Журнал запросов нужен только при отладке, иначе он перемешивается с выводом команды
+	if cfg.Debug() {
+		log.SetOutput(stderr)
+	} else {
+		log.SetOutput(io.Discard)
+	}
+	jira.SetTimeout(cfg.Timeouts.Jira)
+	ollama.SetTimeout(cfg.Timeouts.Ollama)
+	prompt.SetDir(cfg.PromptDir)
+
+	endpoints := make([]ollama.Endpoint, 0, len(cfg.Ollama))
+	for _, o := range cfg.Ollama {
+		endpoints = append(endpoints, ollama.Endpoint{Name: o.Name, URL: o.URL})
+	}
+	return command(&env{cfg: cfg, stdin: stdin, stdout: stdout, stderr: stderr, pool: ollama.NewPool(endpoints)}, args)
+}
+
+// flags создает набор флагов команды с общим параметром --output
+func (e *env) flags(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	output := fs.String("output", "table", "формат вывода: table, markdown или json")
+	return fs, output
+}
+
+// parse разбирает флаги и проверяет формат вывода
+func (e *env) parse(fs *flag.FlagSet, output *string, args []string) (format, error) {
+	if err := fs.Parse(args); err != nil {
+		return "", ErrUsage
+	}
+	f, err := parseFormat(*output)
+	if err != nil {
+		fmt.Fprintln(e.stderr, err)
+		return "", ErrUsage
+	}
+	return f, nil
+}
+
+// instance возвращает подключение Jira по имени из --instance
+func (e *env) instance(name string) (config.JiraInstance, error) {
+	instance, ok := e.cfg.JiraByName(name)
+	if !ok {
+		return config.JiraInstance{}, fmt.Errorf("неизвестное подключение Jira %q, доступны: %s", name, strings.Join(e.cfg.JiraNames(), ", "))
+	}
+	return instance, nil
+}
+
+// tasksList выводит задачи проекта (как в веб-интерфейсе) или задачи по произвольному JQL
+func tasksList(e *env, args []string) error {
+	fs, output := e.flags("tasks list")
+	project := fs.String("project", "", "ключ проекта Jira, например PROJ")
+	jql := fs.String("jql", "", "JQL-запрос; вместе с --project ограничивается проектом")
+	instanceName := fs.String("instance", "", "имя подключения Jira")
+	f, err := e.parse(fs, output, args)
+	if err != nil {
+		return err
+	}
+
+	key := strings.ToUpper(strings.TrimSpace(*project))
+	if key == "" && *jql == "" {
+		fmt.Fprintln(e.stderr, "Укажите --project или --jql")
+		return ErrUsage
+	}
+	if key != "" && !jira.ValidProjectKey(key) {
+		return fmt.Errorf("неверный ключ проекта %q, ожидаются латинские буквы, цифры и _, например PROJ", *project)
+	}
+	instance, err := e.instance(*instanceName)
+	if err != nil {
+		return err
+	}
+
+	var found *jira.SearchResult
+	switch {
+	case instance.Offline() && *jql != "":
+		return fmt.Errorf("подключение %s работает с выгрузкой из файла, поиск по JQL в ней недоступен", instance.Name)
+	case *jql == "":
+		found, err = source.New(instance, nil).ProjectTasks(key)
+	case key != "":
+		found, err = jira.Search(instance.URL, instance.Token, jira.SearchQuery{JQL: projectJQL(key, *jql)})
+	default:
+		found, err = jira.Search(instance.URL, instance.Token, jira.SearchQuery{JQL: *jql})
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка получения задач: %v", err)
+	}
+	tasks := found.Issues
+	for i := range tasks {
+		tasks[i].Instance = instance.Name
+	}
+	// Пояснения идут в stderr, чтобы не мешать разбору вывода
+	switch {
+	case len(tasks) == 0:
+		fmt.Fprintf(e.stderr, "Задачи не найдены по запросу: %s\n", found.JQL)
+	case found.Partial:
+		fmt.Fprintf(e.stderr, "Показаны %d из %d найденных задач\n", len(tasks), found.Total)
+	}
+	return writeTasks(e.stdout, f, tasks)
+}
+
+// orderBy - начало сортировки в JQL
+var orderBy = regexp.MustCompile(`(?i)\border\s+by\b`)
+
+// projectJQL ограничивает запрос --jql проектом. Сортировка ORDER BY не может стоять
+// внутри скобок, поэтому она переносится в конец запроса.
+func projectJQL(key, jql string) string {
+	filter, order := jql, ""
+	for _, loc := range orderBy.FindAllStringIndex(jql, -1) {
+		if !inJQLString(jql[:loc[0]]) {
+			filter, order = jql[:loc[0]], " "+strings.TrimSpace(jql[loc[0]:])
+			break
+		}
+	}
+	if filter = strings.TrimSpace(filter); filter == "" {
+		return fmt.Sprintf("project = %s%s", key, order)
+	}
+	return fmt.Sprintf("project = %s AND (%s)%s", key, filter, order)
+}
+
+// inJQLString сообщает, остается ли открытой строка в кавычках в конце prefix
+func inJQLString(prefix string) bool {
+	var quote rune
+	escaped := false
+	for _, r := range prefix {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		}
+	}
+	return quote != 0
+}
+
+// modelsList выводит модели со всех доступных серверов Ollama
+func modelsList(e *env, args []string) error {
+	fs, output := e.flags("models list")
+	f, err := e.parse(fs, output, args)
+	if err != nil {
+		return err
+	}
+
+	e.pool.Refresh()
+	list := e.pool.Models()
+	if len(list) == 0 {
+		return fmt.Errorf("нет доступных серверов Ollama с моделями")
+	}
+	return writeModels(e.stdout, f, list)
+}
+
+// Answer - ответ модели на вопрос из командной строки
+type Answer struct {
+	Model   string         `json:"model"`
+	TaskRef string         `json:"taskRef,omitempty"`
+	Answer  string         `json:"answer"`
+	Context *prompt.Report `json:"context,omitempty"`
+}
+
+// ask задает вопрос модели; с --issue в вопрос добавляется контекст задачи так же,
+// как при вопросе из веб-интерфейса
+func ask(e *env, args []string) error {
+	fs, output := e.flags("ask")
+	issue := fs.String("issue", "", "ключ задачи Jira, например PROJ-123")
+	model := fs.String("model", "", "модель Ollama")
+	instanceName := fs.String("instance", "", "имя подключения Jira")
+	f, err := e.parse(fs, output, args)
+	if err != nil {
+		return err
+	}
+
+	question := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if question == "" || *model == "" {
+		fmt.Fprintln(e.stderr, "Укажите --model и текст вопроса")
+		return ErrUsage
+	}
+
+	// Сведения о моделях нужны пулу, чтобы отправить запрос на сервер, где модель есть
+	e.pool.Refresh()
+	answer := Answer{Model: *model}
+	message := question
+	if *issue != "" {
+		key := strings.ToUpper(strings.TrimSpace(*issue))
+		if !jira.ValidIssueKey(key) {
+			return fmt.Errorf("неверный ключ задачи %q, ожидается вид PROJ-123", *issue)
+		}
+		instance, err := e.instance(*instanceName)
+		if err != nil {
+			return err
+		}
+		task, err := source.New(instance, nil).Issue(key)
+		if err != nil {
+			return fmt.Errorf("ошибка получения задачи %s: %v", key, err)
+		}
+		task.Instance = instance.Name
+		answer.TaskRef = task.Ref()
+
+		var report prompt.Report
+		message, report = e.taskMessage(*model, question, *task)
+		if len(report.Dropped) > 0 {
+			fmt.Fprintf(e.stderr, "В контекст задачи не поместились разделы: %s\n", strings.Join(report.Dropped, ", "))
+		}
+		answer.Context = &report
+	}
+
+	answer.Answer, err = e.pool.Chat(*model, []models.Message{{Role: "user", Content: message}})
+	if err != nil {
+		return fmt.Errorf("ошибка запроса к модели: %v", err)
+	}
+	return writeAnswer(e.stdout, f, answer)
+}
+
+// taskMessage добавляет к вопросу контекст задачи в пределах окна модели; не поместившиеся
+// разделы сжимаются отдельными запросами к той же модели
+func (e *env) taskMessage(model, question string, task jira.JiraTask) (string, prompt.Report) {
+	numCtx := ollama.DefaultNumCtx
+	if info, err := e.pool.ShowModel(model); err == nil {
+		numCtx = info.NumCtx
+	}
+	builder := prompt.NewBuilder(numCtx)
+	builder.Summarize = summarize.NewWithChat(func(messages []models.Message) (string, error) {
+		return e.pool.Chat(model, messages)
+	}, numCtx).Summarize
+	return builder.Build(question, prompt.TaskSections(task))
+}
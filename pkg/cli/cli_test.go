@@ -0,0 +1,303 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakes - что получили поддельные Jira и Ollama
+type fakes struct {
+	// prompt - последний запрос к модели
+	prompt string
+	// comment - последний комментарий, добавленный в задачу
+	comment string
+	// jql - последний запрос поиска задач
+	jql string
+}
+
+// setup поднимает Jira и Ollama с одной задачей и одной моделью и пишет конфигурацию для них
+func setup(t *testing.T) (configPath string, got *fakes) {
+	t.Helper()
+	for _, key := range []string{"CONFIG_FILE", "JIRA_URL", "JIRA_TOKEN", "OLLAMA_HOST", "PROMPT_DIR", "LOG_LEVEL", "LOG_FILE"} {
+		t.Setenv(key, "")
+	}
+
+	issue := map[string]interface{}{
+		"key": "PROJ-1",
+		"fields": map[string]interface{}{
+			"summary":     "Падает вход | SSO",
+			"description": "Пользователи не могут войти",
+			"status":      map[string]string{"name": "Open"},
+			"issuetype":   map[string]string{"name": "Bug"},
+		},
+	}
+	jiraServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/rest/api/2/search":
+			got.jql = r.URL.Query().Get("jql")
+			json.NewEncoder(w).Encode(map[string]interface{}{"issues": []interface{}{issue}, "total": 1})
+		case "/rest/api/2/issue/PROJ-1":
+			json.NewEncoder(w).Encode(issue)
+		case "/rest/api/2/issue/PROJ-1/comment":
+			var comment struct {
+				Body string `json:"body"`
+			}
+			json.NewDecoder(r.Body).Decode(&comment)
+			got.comment = comment.Body
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(comment)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(jiraServer.Close)
+
+	got = &fakes{}
+	ollamaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"models": []map[string]interface{}{{"name": "llama3", "size": 4 << 30}},
+			})
+		case "/api/chat":
+			var req struct {
+				Messages []struct {
+					Content string `json:"content"`
+				} `json:"messages"`
+				Stream bool `json:"stream"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			got.prompt = req.Messages[len(req.Messages)-1].Content
+			if !req.Stream {
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"message": map[string]string{"role": "assistant", "content": "Проверьте настройки SSO"},
+				})
+				return
+			}
+			enc := json.NewEncoder(w)
+			for _, chunk := range []string{"Проверьте ", "настройки SSO"} {
+				enc.Encode(map[string]interface{}{"message": map[string]string{"content": chunk}})
+			}
+			enc.Encode(map[string]interface{}{"done": true})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(ollamaServer.Close)
+
+	configPath = filepath.Join(t.TempDir(), "config.yaml")
+	body := fmt.Sprintf("jira:\n  - name: main\n    url: %s\n    token: secret\nollama:\n  - name: local\n    url: %s\n", jiraServer.URL, ollamaServer.URL)
+	if err := os.WriteFile(configPath, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return configPath, got
+}
+
+func run(t *testing.T, configPath string, args ...string) (string, error) {
+	t.Helper()
+	return runInput(t, configPath, "", args...)
+}
+
+func runInput(t *testing.T, configPath, input string, args ...string) (string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	err := Run(configPath, args, strings.NewReader(input), &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func TestTasksList(t *testing.T) {
+	configPath, got := setup(t)
+
+	out, err := run(t, configPath, "tasks", "list", "--project", "proj")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "Ключ") || !strings.Contains(out, "PROJ-1") || !strings.Contains(out, "Bug") {
+		t.Errorf("unexpected table:\n%s", out)
+	}
+
+	out, err = run(t, configPath, "tasks", "list", "--jql", "assignee = currentUser()", "--output", "markdown")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "| --- |") || !strings.Contains(out, `Падает вход \| SSO`) {
+		t.Errorf("unexpected markdown:\n%s", out)
+	}
+
+	out, err = run(t, configPath, "tasks", "list", "--project", "PROJ", "--output", "json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var tasks []struct {
+		Key      string `json:"key"`
+		Instance string `json:"instance"`
+	}
+	if err := json.Unmarshal([]byte(out), &tasks); err != nil || len(tasks) != 1 || tasks[0].Instance != "main" {
+		t.Errorf("unexpected json %q: %v", out, err)
+	}
+
+	if _, err := run(t, configPath, "tasks", "list", "--project", "PROJ", "--jql", "status = Open ORDER BY created DESC"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "project = PROJ AND (status = Open) ORDER BY created DESC"; got.jql != want {
+		t.Errorf("expected JQL %q, got %q", want, got.jql)
+	}
+
+	if _, err := run(t, configPath, "tasks", "list", "--project", "PROJ OR 1=1"); err == nil {
+		t.Error("expected invalid project key error")
+	}
+	if _, err := run(t, configPath, "tasks", "list"); !errors.Is(err, ErrUsage) {
+		t.Errorf("expected usage error, got %v", err)
+	}
+	if _, err := run(t, configPath, "tasks", "list", "--project", "PROJ", "--output", "xml"); !errors.Is(err, ErrUsage) {
+		t.Errorf("expected usage error for unknown format, got %v", err)
+	}
+}
+
+func TestProjectJQL(t *testing.T) {
+	for jql, want := range map[string]string{
+		"status = Open":                     "project = PROJ AND (status = Open)",
+		"status = Open order by key":        "project = PROJ AND (status = Open) order by key",
+		"ORDER BY created":                  "project = PROJ ORDER BY created",
+		`summary ~ "order by" ORDER BY key`: `project = PROJ AND (summary ~ "order by") ORDER BY key`,
+		`summary ~ "sort \" order by"`:      `project = PROJ AND (summary ~ "sort \" order by")`,
+	} {
+		if got := projectJQL("PROJ", jql); got != want {
+			t.Errorf("%s: expected %q, got %q", jql, want, got)
+		}
+	}
+}
+
+func TestAsk(t *testing.T) {
+	configPath, got := setup(t)
+
+	out, err := run(t, configPath, "ask", "--issue", "proj-1", "--model", "llama3", "--output", "json", "Что", "проверить?")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var answer Answer
+	if err := json.Unmarshal([]byte(out), &answer); err != nil {
+		t.Fatalf("unexpected json %q: %v", out, err)
+	}
+	if answer.Answer != "Проверьте настройки SSO" || answer.TaskRef != "main/PROJ-1" || answer.Context == nil {
+		t.Errorf("unexpected answer: %+v", answer)
+	}
+	if !strings.Contains(got.prompt, "Пользователи не могут войти") || !strings.Contains(got.prompt, "Что проверить?") {
+		t.Errorf("task context is missing from prompt:\n%s", got.prompt)
+	}
+
+	out, err = run(t, configPath, "ask", "--model", "llama3", "Привет")
+	if err != nil || out != "Проверьте настройки SSO\n" {
+		t.Errorf("unexpected plain answer %q: %v", out, err)
+	}
+
+	if _, err := run(t, configPath, "ask", "Привет"); !errors.Is(err, ErrUsage) {
+		t.Errorf("expected usage error without model, got %v", err)
+	}
+}
+
+func TestImportedInstance(t *testing.T) {
+	configPath, got := setup(t)
+	export := filepath.Join(t.TempDir(), "export.csv")
+	csv := "Summary,Issue key,Status,Description\nСтарая задача,OFF-1,Open,Снимок без Jira\nЗакрыта,OFF-2,Done,\n"
+	if err := os.WriteFile(export, []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	body, _ := os.ReadFile(configPath)
+	body = bytes.Replace(body, []byte("ollama:"), []byte("  - name: snapshot\n    import: "+export+"\nollama:"), 1)
+	if err := os.WriteFile(configPath, body, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := run(t, configPath, "tasks", "list", "--instance", "snapshot", "--project", "off", "--output", "json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "OFF-1") || strings.Contains(out, "OFF-2") || !strings.Contains(out, `"instance": "snapshot"`) {
+		t.Errorf("expected open task from the export:\n%s", out)
+	}
+
+	out, err = run(t, configPath, "ask", "--instance", "snapshot", "--issue", "OFF-1", "--model", "llama3", "Что", "делать?")
+	if err != nil || out != "Проверьте настройки SSO\n" {
+		t.Errorf("unexpected answer %q: %v", out, err)
+	}
+	if !strings.Contains(got.prompt, "Снимок без Jira") {
+		t.Errorf("imported task is missing from prompt:\n%s", got.prompt)
+	}
+
+	if _, err := run(t, configPath, "tasks", "list", "--instance", "snapshot", "--jql", "status = Open"); err == nil || !strings.Contains(err.Error(), "JQL") {
+		t.Errorf("expected JQL to be rejected for the export, got %v", err)
+	}
+}
+
+func TestModelsList(t *testing.T) {
+	configPath, _ := setup(t)
+
+	out, err := run(t, configPath, "models", "list")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "llama3") || !strings.Contains(out, "4.0 ГБ") || !strings.Contains(out, "local") {
+		t.Errorf("unexpected table:\n%s", out)
+	}
+
+	if _, err := run(t, configPath, "models", "remove"); !errors.Is(err, ErrUsage) {
+		t.Errorf("expected usage error for unknown command, got %v", err)
+	}
+}
+
+func TestChat(t *testing.T) {
+	configPath, got := setup(t)
+
+	input := strings.Join([]string{
+		"1",        // модель
+		"proj",     // проект
+		"/open 1",  // задача из списка
+		"/context", // контекст еще не собран
+		"Что проверить?",
+		"/context",
+		"Еще вопрос",
+		"/comment",
+		"/reset",
+		"/unknown",
+	}, "\n")
+	out, err := runInput(t, configPath, input, "chat")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, want := range []string{
+		"1 - llama3",
+		"1. PROJ-1 [Open]",
+		"Работаем с задачей: PROJ-1",
+		"Контекст задачи собирается при первом вопросе",
+		"PROJ-1> Проверьте настройки SSO\n",
+		"Сообщений в истории: 2",
+		"Комментарий добавлен в PROJ-1",
+		"История разговора очищена",
+		"Неизвестная команда /unknown",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+	// Контекст задачи добавляется только к первому вопросу, дальше он в истории
+	if got.prompt != "Еще вопрос" {
+		t.Errorf("expected plain follow-up question, got %q", got.prompt)
+	}
+	if got.comment != "Проверьте настройки SSO" {
+		t.Errorf("expected last answer as comment, got %q", got.comment)
+	}
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"jira-go/pkg/jira"
+	"strings"
+	"text/tabwriter"
+)
+
+// format - формат вывода команды
+type format string
+
+const (
+	formatTable    format = "table"
+	formatMarkdown format = "markdown"
+	formatJSON     format = "json"
+)
+
+func parseFormat(value string) (format, error) {
+	switch f := format(strings.ToLower(value)); f {
+	case formatTable, formatMarkdown, formatJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("неизвестный формат вывода %q, допустимы table, markdown и json", value)
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeRows выводит строки выровненной таблицей или таблицей Markdown
+func writeRows(w io.Writer, f format, header []string, rows [][]string) error {
+	if f == formatMarkdown {
+		fmt.Fprintf(w, "| %s |\n", strings.Join(header, " | "))
+		fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(header)))
+		for _, row := range rows {
+			cells := make([]string, len(row))
+			for i, cell := range row {
+				cells[i] = strings.ReplaceAll(cell, "|", `\|`)
+			}
+			fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func writeTasks(w io.Writer, f format, tasks []jira.JiraTask) error {
+	if f == formatJSON {
+		if tasks == nil {
+			tasks = []jira.JiraTask{}
+		}
+		return writeJSON(w, tasks)
+	}
+
+	rows := make([][]string, 0, len(tasks))
+	for _, t := range tasks {
+		rows = append(rows, []string{
+			t.Key,
+			t.Fields.Status.Name,
+			t.Fields.IssueType.Name,
+			t.Fields.Priority.Name,
+			t.Fields.Assignee.DisplayName,
+			oneLine(t.Fields.Summary),
+		})
+	}
+	return writeRows(w, f, []string{"Ключ", "Статус", "Тип", "Приоритет", "Исполнитель", "Заголовок"}, rows)
+}
+
+func writeModels(w io.Writer, f format, list []map[string]interface{}) error {
+	if f == formatJSON {
+		return writeJSON(w, list)
+	}
+
+	rows := make([][]string, 0, len(list))
+	for _, m := range list {
+		size := ""
+		if bytes, ok := m["size"].(float64); ok {
+			size = fmt.Sprintf("%.1f ГБ", bytes/(1<<30))
+		}
+		hosts, _ := m["hosts"].([]string)
+		rows = append(rows, []string{fmt.Sprint(m["name"]), size, strings.Join(hosts, ", ")})
+	}
+	return writeRows(w, f, []string{"Модель", "Размер", "Серверы"}, rows)
+}
+
+func writeAnswer(w io.Writer, f format, answer Answer) error {
+	switch f {
+	case formatJSON:
+		return writeJSON(w, answer)
+	case formatMarkdown:
+		if answer.TaskRef != "" {
+			fmt.Fprintf(w, "## %s\n\n", answer.TaskRef)
+		}
+		fmt.Fprintf(w, "%s\n\n_Модель: %s_\n", strings.TrimSpace(answer.Answer), answer.Model)
+		return nil
+	}
+	_, err := fmt.Fprintln(w, strings.TrimSpace(answer.Answer))
+	return err
+}
+
+// oneLine заменяет переводы строк пробелами, чтобы строка таблицы не разъезжалась
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -1,31 +1,595 @@
 package config
 
 import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
+// DefaultPath - файл конфигурации, который читается, если путь не задан явно
+const DefaultPath = "config.yaml"
+
+const secretMask = "********"
+
 type Config struct {
-	JiraToken  string
-	JiraURL    string
-	OllamaHost string
+	Server       ServerConfig   `yaml:"server"`
+	Jira         []JiraInstance `yaml:"jira"`
+	Ollama       []OllamaHost   `yaml:"ollama"`
+	DefaultModel string         `yaml:"default_model"`
+	Timeouts     TimeoutsConfig `yaml:"timeouts"`
+	PromptDir    string         `yaml:"prompt_dir"`
+	Cache        CacheConfig    `yaml:"cache"`
+	Limits       LimitsConfig   `yaml:"limits"`
+	Log          LogConfig      `yaml:"log"`
+	Auth         AuthConfig     `yaml:"auth"`
+
+	// Подключения по умолчанию (первые в списках jira и ollama). Запросы к моделям
+	// распределяются по всем серверам из списка ollama.
+	JiraToken  string `yaml:"-"`
+	JiraURL    string `yaml:"-"`
+	OllamaHost string `yaml:"-"`
+}
+
+type ServerConfig struct {
+	Listen       string `yaml:"listen"`
+	TemplatesDir string `yaml:"templates_dir"`
+	StaticDir    string `yaml:"static_dir"`
+	// Watch - период проверки изменений конфигурации и шаблонов; 0 - перезагрузка только по SIGHUP
+	Watch time.Duration `yaml:"watch"`
+	// Таймауты HTTP-сервера; запись должна успевать за генерацией ответа модели
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout - сколько ждать завершения начатых запросов при остановке
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type JiraInstance struct {
+	Name  string `yaml:"name"`
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+	// Import - файл выгрузки задач Jira (CSV или JSON). Такое подключение работает без
+	// Jira: задачи читаются из файла, url и token не нужны.
+	Import string `yaml:"import,omitempty"`
+}
+
+// Offline сообщает, что подключение работает с импортированной выгрузкой, а не с Jira
+func (j JiraInstance) Offline() bool {
+	return j.Import != ""
+}
+
+type OllamaHost struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+}
+
+type TimeoutsConfig struct {
+	Jira   time.Duration `yaml:"jira"`
+	Ollama time.Duration `yaml:"ollama"`
+	// HealthCheck - период проверки доступности серверов Ollama
+	HealthCheck time.Duration `yaml:"health_check"`
+}
+
+type CacheConfig struct {
+	// TTL - сколько хранить полученные из Jira задачи перед повторным запросом
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// LimitsConfig - ограничения нагрузки на серверы Ollama
+type LimitsConfig struct {
+	// PerHost - сколько генераций одной модели одновременно выполняется на одном сервере; 0 - без ограничения
+	PerHost int `yaml:"per_host"`
+	// Queue - сколько запросов может ждать места у модели на сервере; остальные получают 429
+	Queue int `yaml:"queue"`
+	// UserRate - запросов к моделям в минуту на пользователя; 0 - без ограничения
+	UserRate int `yaml:"user_rate"`
+	// UserBurst - сколько запросов пользователь может отправить подряд
+	UserBurst int `yaml:"user_burst"`
+}
+
+// AuthConfig - вход в веб-интерфейс. Нужен хотя бы один способ входа (users или oidc),
+// либо явное disabled: true.
+type AuthConfig struct {
+	Disabled bool `yaml:"disabled"`
+	// SessionTTL - срок жизни сессии после входа
+	SessionTTL time.Duration `yaml:"session_ttl"`
+	Users      []AuthUser    `yaml:"users"`
+	OIDC       OIDCConfig    `yaml:"oidc"`
+	// TokenStore - файл с личными токенами Jira пользователей; пусто - токены
+	// хранятся только в памяти до перезапуска
+	TokenStore string `yaml:"token_store"`
+	// TokenKey - ключ шифрования личных токенов: 32 байта в base64
+	// (openssl rand -base64 32). Обязателен, если задан token_store.
+	TokenKey string `yaml:"token_key"`
+}
+
+type AuthUser struct {
+	Name string `yaml:"name"`
+	// PasswordHash - bcrypt-хэш пароля, получить его можно командой --hash-password
+	PasswordHash string `yaml:"password_hash"`
+}
+
+type OIDCConfig struct {
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// RedirectURL - адрес /auth/callback этого сервиса, зарегистрированный у провайдера
+	RedirectURL string `yaml:"redirect_url"`
+}
+
+// Enabled сообщает, настроен ли вход через OIDC
+func (o OIDCConfig) Enabled() bool {
+	return o.Issuer != ""
+}
+
+type LogConfig struct {
+	Level string `yaml:"level"`
+	File  string `yaml:"file"`
+}
+
+// Default возвращает конфигурацию со значениями по умолчанию
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Listen:          ":8080",
+			TemplatesDir:    "templates",
+			StaticDir:       "templates/static",
+			Watch:           2 * time.Second,
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    10 * time.Minute,
+			IdleTimeout:     2 * time.Minute,
+			ShutdownTimeout: time.Minute,
+		},
+		Jira:     []JiraInstance{{Name: "default", URL: "https://jira.officesvc.bz"}},
+		Ollama:   []OllamaHost{{Name: "default", URL: "host.docker.internal:11434"}},
+		Timeouts: TimeoutsConfig{Jira: 30 * time.Second, Ollama: 5 * time.Minute, HealthCheck: 30 * time.Second},
+		Cache:    CacheConfig{TTL: 5 * time.Minute},
+		Limits:   LimitsConfig{PerHost: 2, Queue: 20, UserRate: 10, UserBurst: 3},
+		Log:      LogConfig{Level: "info"},
+		Auth:     AuthConfig{SessionTTL: 12 * time.Hour},
+	}
+}
+
+// Load читает конфигурацию и проверяет ее
+func Load(path string) (*Config, error) {
+	cfg, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadClient загружает конфигурацию для командной строки: без проверки настроек
+// веб-сервера и входа (см. ValidateClient)
+func LoadClient(path string) (*Config, error) {
+	cfg, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.ValidateClient(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
 
-func LoadConfig() *Config {
+// Read собирает конфигурацию по слоям без проверки: значения по умолчанию, YAML-файл,
+// .env и переменные окружения. Пустой path означает CONFIG_FILE или config.yaml,
+// если такой файл есть.
+func Read(path string) (*Config, error) {
 	// Загружаем .env файл
-	err := godotenv.Load()
+	loadDotEnv()
+
+	cfg := Default()
+
+	explicit := path != "" || os.Getenv("CONFIG_FILE") != ""
+	path = Path(path)
+	if err := cfg.loadFile(path, explicit); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	cfg.setDefaults()
+	return cfg, nil
+}
+
+// Path возвращает файл конфигурации, который будет прочитан: path, CONFIG_FILE или config.yaml
+func Path(path string) string {
+	if path != "" {
+		return path
+	}
+	return getEnv("CONFIG_FILE", DefaultPath)
+}
+
+var (
+	// processEnv - переменные, заданные в окружении процесса до чтения .env; они важнее .env
+	processEnv map[string]bool
+	// dotEnvKeys - переменные, установленные из .env при прошлом чтении
+	dotEnvKeys map[string]bool
+)
+
+// loadDotEnv читает .env в окружение. В отличие от godotenv.Load, при повторном вызове
+// применяет изменения файла и убирает удаленные из него переменные, не трогая
+// переменные окружения процесса.
+func loadDotEnv() {
+	if processEnv == nil {
+		processEnv = map[string]bool{}
+		for _, kv := range os.Environ() {
+			processEnv[strings.SplitN(kv, "=", 2)[0]] = true
+		}
+	}
+
+	values, err := godotenv.Read()
 	if err != nil {
 		log.Println("Warning: No .env file found, using environment variables")
 	}
-	cfg := &Config{
-		JiraToken:  getEnv("JIRA_TOKEN", ""),
-		JiraURL:    getEnv("JIRA_URL", "https://jira.officesvc.bz"),
-		OllamaHost: getEnv("OLLAMA_HOST", "host.docker.internal:11434"),
+
+	for key := range dotEnvKeys {
+		if _, ok := values[key]; !ok {
+			os.Unsetenv(key)
+		}
+	}
+	dotEnvKeys = map[string]bool{}
+	for key, value := range values {
+		if !processEnv[key] {
+			os.Setenv(key, value)
+			dotEnvKeys[key] = true
+		}
+	}
+}
+
+func (c *Config) loadFile(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка чтения файла конфигурации: %v", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("ошибка разбора %s: %v", path, err)
+	}
+	log.Printf("Загружена конфигурация из %s", path)
+	return nil
+}
+
+// applyEnv применяет переменные окружения поверх файла. JIRA_* и OLLAMA_HOST
+// относятся к первому подключению в списке.
+func (c *Config) applyEnv() error {
+	if len(c.Jira) == 0 {
+		c.Jira = []JiraInstance{{Name: "default"}}
+	}
+	if len(c.Ollama) == 0 {
+		c.Ollama = []OllamaHost{{Name: "default"}}
+	}
+
+	overrideString(&c.Jira[0].URL, "JIRA_URL")
+	overrideString(&c.Jira[0].Token, "JIRA_TOKEN")
+	overrideString(&c.Ollama[0].URL, "OLLAMA_HOST")
+	overrideString(&c.Server.Listen, "LISTEN_ADDR")
+	overrideString(&c.Server.TemplatesDir, "TEMPLATES_DIR")
+	overrideString(&c.Server.StaticDir, "STATIC_DIR")
+	overrideString(&c.DefaultModel, "DEFAULT_MODEL")
+	overrideString(&c.PromptDir, "PROMPT_DIR")
+	overrideString(&c.Log.Level, "LOG_LEVEL")
+	overrideString(&c.Log.File, "LOG_FILE")
+	overrideString(&c.Auth.OIDC.ClientSecret, "OIDC_CLIENT_SECRET")
+	overrideString(&c.Auth.TokenStore, "TOKEN_STORE")
+	overrideString(&c.Auth.TokenKey, "TOKEN_KEY")
+	if value := os.Getenv("AUTH_DISABLED"); value != "" {
+		c.Auth.Disabled = value == "true" || value == "1"
+	}
+
+	for key, target := range map[string]*time.Duration{
+		"JIRA_TIMEOUT":     &c.Timeouts.Jira,
+		"OLLAMA_TIMEOUT":   &c.Timeouts.Ollama,
+		"HEALTH_CHECK":     &c.Timeouts.HealthCheck,
+		"CACHE_TTL":        &c.Cache.TTL,
+		"WATCH_INTERVAL":   &c.Server.Watch,
+		"SHUTDOWN_TIMEOUT": &c.Server.ShutdownTimeout,
+		"SESSION_TTL":      &c.Auth.SessionTTL,
+	} {
+		if value := os.Getenv(key); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("неверное значение %s=%q: %v", key, value, err)
+			}
+			*target = d
+		}
+	}
+	return nil
+}
+
+func (c *Config) setDefaults() {
+	for i := range c.Jira {
+		if c.Jira[i].Name == "" {
+			c.Jira[i].Name = fmt.Sprintf("jira-%d", i+1)
+		}
+		c.Jira[i].URL = strings.TrimRight(c.Jira[i].URL, "/")
+	}
+	for i := range c.Ollama {
+		if c.Ollama[i].Name == "" {
+			c.Ollama[i].Name = fmt.Sprintf("ollama-%d", i+1)
+		}
+	}
+
+	c.JiraURL = c.Jira[0].URL
+	c.JiraToken = c.Jira[0].Token
+	c.OllamaHost = c.Ollama[0].URL
+}
+
+// Validate проверяет конфигурацию сервера и возвращает все найденные ошибки разом
+func (c *Config) Validate() error {
+	return c.validate(true)
+}
+
+// ValidateClient проверяет только то, что нужно командной строке: подключения к Jira
+// и Ollama, таймауты и промпты. Настройки веб-сервера и входа не проверяются.
+func (c *Config) ValidateClient() error {
+	return c.validate(false)
+}
+
+func (c *Config) validate(server bool) error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	names := map[string]bool{}
+	for i, j := range c.Jira {
+		if names[j.Name] {
+			add("jira[%d].name: имя %q повторяется", i, j.Name)
+		}
+		names[j.Name] = true
+		if j.Offline() {
+			if j.URL != "" {
+				add("jira[%d]: укажите либо url, либо import", i)
+			}
+			if _, err := os.Stat(j.Import); err != nil {
+				add("jira[%d].import: файл выгрузки недоступен: %v", i, err)
+			}
+			continue
+		}
+		if !validURL(j.URL, true) {
+			add("jira[%d].url: ожидается адрес вида https://jira.example.com, получено %q", i, j.URL)
+		}
+		if j.Token == "" {
+			add("jira[%d].token: не задан (для первого подключения можно указать JIRA_TOKEN в .env или окружении)", i)
+		}
+	}
+
+	names = map[string]bool{}
+	for i, o := range c.Ollama {
+		if names[o.Name] {
+			add("ollama[%d].name: имя %q повторяется", i, o.Name)
+		}
+		names[o.Name] = true
+		if !validURL(o.URL, false) {
+			add("ollama[%d].url: ожидается адрес вида http://host:11434, получено %q", i, o.URL)
+		}
+	}
+
+	if c.Timeouts.Jira <= 0 {
+		add("timeouts.jira: должен быть больше нуля")
+	}
+	if c.Timeouts.Ollama <= 0 {
+		add("timeouts.ollama: должен быть больше нуля")
+	}
+	if c.PromptDir != "" {
+		if info, err := os.Stat(c.PromptDir); err != nil || !info.IsDir() {
+			add("prompt_dir: каталог %q не найден", c.PromptDir)
+		}
+	}
+	if c.Log.Level != "info" && c.Log.Level != "debug" {
+		add("log.level: допустимы значения info и debug, получено %q", c.Log.Level)
+	}
+
+	if server {
+		c.validateServer(add)
+		c.validateAuth(add)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("ошибки конфигурации:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// validateServer проверяет настройки веб-сервера: адрес, каталоги шаблонов, таймауты, кэш и лимиты
+func (c *Config) validateServer(add func(format string, args ...interface{})) {
+	if c.Server.Listen == "" {
+		add("server.listen: адрес не задан")
+	}
+	if info, err := os.Stat(c.Server.TemplatesDir); err != nil || !info.IsDir() {
+		add("server.templates_dir: каталог %q не найден", c.Server.TemplatesDir)
+	}
+	if info, err := os.Stat(c.Server.StaticDir); err != nil || !info.IsDir() {
+		add("server.static_dir: каталог %q не найден", c.Server.StaticDir)
+	}
+
+	if c.Server.Watch < 0 {
+		add("server.watch: не может быть отрицательным")
+	}
+	for _, t := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"read_timeout", c.Server.ReadTimeout},
+		{"write_timeout", c.Server.WriteTimeout},
+		{"idle_timeout", c.Server.IdleTimeout},
+		{"shutdown_timeout", c.Server.ShutdownTimeout},
+	} {
+		if t.value <= 0 {
+			add("server.%s: должен быть больше нуля", t.name)
+		}
+	}
+	if c.Server.WriteTimeout > 0 && c.Server.WriteTimeout < c.Timeouts.Ollama {
+		add("server.write_timeout (%v) меньше timeouts.ollama (%v): ответы модели будут обрываться", c.Server.WriteTimeout, c.Timeouts.Ollama)
+	}
+	if c.Timeouts.HealthCheck <= 0 {
+		add("timeouts.health_check: должен быть больше нуля")
+	}
+	if c.Cache.TTL < 0 {
+		add("cache.ttl: не может быть отрицательным")
+	}
+
+	for _, l := range []struct {
+		name  string
+		value int
+	}{
+		{"limits.per_host", c.Limits.PerHost},
+		{"limits.queue", c.Limits.Queue},
+		{"limits.user_rate", c.Limits.UserRate},
+		{"limits.user_burst", c.Limits.UserBurst},
+	} {
+		if l.value < 0 {
+			add("%s: не может быть отрицательным", l.name)
+		}
+	}
+	if c.Limits.UserRate > 0 && c.Limits.UserBurst < 1 {
+		add("limits.user_burst: должен быть не меньше 1, если задан limits.user_rate")
+	}
+}
+
+func (c *Config) validateAuth(add func(format string, args ...interface{})) {
+	a := c.Auth
+	if a.Disabled {
+		return
+	}
+	if len(a.Users) == 0 && !a.OIDC.Enabled() {
+		add("auth: не настроен вход - укажите auth.users или auth.oidc (или auth.disabled: true, чтобы открыть интерфейс без входа)")
+	}
+	if a.SessionTTL <= 0 {
+		add("auth.session_ttl: должен быть больше нуля")
+	}
+
+	names := map[string]bool{}
+	for i, u := range a.Users {
+		if u.Name == "" {
+			add("auth.users[%d].name: не задано", i)
+		}
+		if names[u.Name] {
+			add("auth.users[%d].name: имя %q повторяется", i, u.Name)
+		}
+		names[u.Name] = true
+		if !strings.HasPrefix(u.PasswordHash, "$2a$") && !strings.HasPrefix(u.PasswordHash, "$2b$") && !strings.HasPrefix(u.PasswordHash, "$2y$") {
+			add("auth.users[%d].password_hash: ожидается bcrypt-хэш (получите его командой --hash-password)", i)
+		}
+	}
+
+	if a.TokenKey != "" {
+		if key, err := base64.StdEncoding.DecodeString(a.TokenKey); err != nil || len(key) != 32 {
+			add("auth.token_key: ожидается 32 байта в base64 (openssl rand -base64 32)")
+		}
+	}
+	if a.TokenStore != "" && a.TokenKey == "" {
+		add("auth.token_key: нужен для хранения токенов в %s", a.TokenStore)
+	}
+
+	if o := a.OIDC; o.Enabled() {
+		if !validURL(o.Issuer, true) {
+			add("auth.oidc.issuer: ожидается адрес вида https://accounts.example.com, получено %q", o.Issuer)
+		}
+		if o.ClientID == "" {
+			add("auth.oidc.client_id: не задан")
+		}
+		if !validURL(o.RedirectURL, true) {
+			add("auth.oidc.redirect_url: ожидается адрес вида https://app.example.com/auth/callback, получено %q", o.RedirectURL)
+		}
+	}
+}
+
+// JiraByName возвращает подключение Jira по имени; пустое имя означает подключение по умолчанию
+func (c *Config) JiraByName(name string) (JiraInstance, bool) {
+	if name == "" {
+		return c.Jira[0], true
+	}
+	for _, j := range c.Jira {
+		if j.Name == name {
+			return j, true
+		}
+	}
+	return JiraInstance{}, false
+}
+
+// JiraNames возвращает имена подключений Jira в порядке из конфигурации
+func (c *Config) JiraNames() []string {
+	names := make([]string, len(c.Jira))
+	for i, j := range c.Jira {
+		names[i] = j.Name
+	}
+	return names
+}
+
+// Debug сообщает, включен ли подробный режим логирования
+func (c *Config) Debug() bool {
+	return c.Log.Level == "debug"
+}
+
+// Masked возвращает YAML-представление конфигурации со скрытыми токенами
+func (c *Config) Masked() (string, error) {
+	masked := *c
+	masked.Jira = make([]JiraInstance, len(c.Jira))
+	copy(masked.Jira, c.Jira)
+	for i := range masked.Jira {
+		if masked.Jira[i].Token != "" {
+			masked.Jira[i].Token = secretMask
+		}
+	}
+	if masked.Auth.OIDC.ClientSecret != "" {
+		masked.Auth.OIDC.ClientSecret = secretMask
+	}
+	if masked.Auth.TokenKey != "" {
+		masked.Auth.TokenKey = secretMask
+	}
+	// Хэши паролей тоже не показываем: по ним можно подбирать пароли
+	masked.Auth.Users = make([]AuthUser, len(c.Auth.Users))
+	for i, u := range c.Auth.Users {
+		masked.Auth.Users[i] = AuthUser{Name: u.Name, PasswordHash: secretMask}
+	}
+
+	data, err := yaml.Marshal(&masked)
+	if err != nil {
+		return "", fmt.Errorf("ошибка сериализации конфигурации: %v", err)
+	}
+	return string(data), nil
+}
+
+// validURL проверяет адрес; адрес Ollama допускается без схемы (host:port)
+func validURL(raw string, requireScheme bool) bool {
+	if raw == "" {
+		return false
+	}
+	if !strings.Contains(raw, "://") {
+		if requireScheme {
+			return false
+		}
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func overrideString(target *string, key string) {
+	if value := os.Getenv(key); value != "" {
+		*target = value
 	}
-	//log.Printf("Loaded .env file: %v\n", cfg)
-	return cfg
 }
 
 func getEnv(key, defaultValue string) string {
@@ -0,0 +1,304 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var envKeys = []string{
+	"CONFIG_FILE", "JIRA_URL", "JIRA_TOKEN", "OLLAMA_HOST", "LISTEN_ADDR", "TEMPLATES_DIR", "STATIC_DIR",
+	"DEFAULT_MODEL", "PROMPT_DIR", "LOG_LEVEL", "LOG_FILE", "JIRA_TIMEOUT", "OLLAMA_TIMEOUT", "HEALTH_CHECK", "CACHE_TTL", "WATCH_INTERVAL", "SHUTDOWN_TIMEOUT", "SESSION_TTL", "OIDC_CLIENT_SECRET", "TOKEN_STORE", "TOKEN_KEY",
+}
+
+// writeConfig создает каталог с шаблонами и файлом конфигурации и очищает переменные окружения
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	for _, key := range envKeys {
+		t.Setenv(key, "")
+	}
+
+	dir := t.TempDir()
+	templates := filepath.Join(dir, "templates")
+	if err := os.MkdirAll(filepath.Join(templates, "static"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEMPLATES_DIR", templates)
+	t.Setenv("STATIC_DIR", filepath.Join(templates, "static"))
+	// Вход проверяется отдельно в TestValidateAuth
+	t.Setenv("AUTH_DISABLED", "true")
+
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeConfig(t, `
+server:
+  listen: ":9090"
+jira:
+  - name: main
+    url: https://jira.example.com/
+    token: secret
+  - url: https://other.example.com
+    token: other
+ollama:
+  - url: gpu:11434
+default_model: llama3
+timeouts:
+  ollama: 2m
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Server.Listen != ":9090" {
+		t.Errorf("expected listen :9090, got %q", cfg.Server.Listen)
+	}
+	if cfg.JiraURL != "https://jira.example.com" || cfg.JiraToken != "secret" {
+		t.Errorf("unexpected default Jira: %q %q", cfg.JiraURL, cfg.JiraToken)
+	}
+	if cfg.Jira[1].Name != "jira-2" {
+		t.Errorf("expected generated name jira-2, got %q", cfg.Jira[1].Name)
+	}
+	if cfg.OllamaHost != "gpu:11434" || cfg.DefaultModel != "llama3" {
+		t.Errorf("unexpected ollama settings: %q %q", cfg.OllamaHost, cfg.DefaultModel)
+	}
+	if cfg.Timeouts.Ollama != 2*time.Minute || cfg.Timeouts.Jira != 30*time.Second {
+		t.Errorf("unexpected timeouts: %+v", cfg.Timeouts)
+	}
+}
+
+func TestEnvOverridesFile(t *testing.T) {
+	path := writeConfig(t, `
+jira:
+  - url: https://jira.example.com
+    token: from-file
+`)
+	t.Setenv("JIRA_TOKEN", "from-env")
+	t.Setenv("OLLAMA_TIMEOUT", "90s")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.JiraToken != "from-env" {
+		t.Errorf("expected token from env, got %q", cfg.JiraToken)
+	}
+	if cfg.Timeouts.Ollama != 90*time.Second {
+		t.Errorf("expected ollama timeout 90s, got %v", cfg.Timeouts.Ollama)
+	}
+
+	t.Setenv("CACHE_TTL", "soon")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "CACHE_TTL") {
+		t.Errorf("expected CACHE_TTL error, got %v", err)
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	path := writeConfig(t, `
+jira:
+  - name: a
+    url: jira.example.com
+  - name: a
+    url: https://jira.example.com
+    token: x
+timeouts:
+  jira: 0s
+log:
+  level: verbose
+`)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"jira[0].url", "jira[0].token", "jira[1].name", "timeouts.jira", "log.level"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in error, got:\n%v", want, err)
+		}
+	}
+}
+
+func TestUnknownField(t *testing.T) {
+	path := writeConfig(t, "jira_url: https://jira.example.com\n")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "jira_url") {
+		t.Errorf("expected unknown field error, got %v", err)
+	}
+}
+
+func TestMasked(t *testing.T) {
+	path := writeConfig(t, `
+jira:
+  - url: https://jira.example.com
+    token: super-secret
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out, err := cfg.Masked()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(out, "super-secret") || !strings.Contains(out, secretMask) {
+		t.Errorf("token is not masked:\n%s", out)
+	}
+	if cfg.Jira[0].Token != "super-secret" {
+		t.Error("Masked must not modify the original config")
+	}
+}
+
+func TestJiraByName(t *testing.T) {
+	path := writeConfig(t, `
+jira:
+  - name: onprem
+    url: https://jira.local
+    token: a
+  - name: cloud
+    url: https://example.atlassian.net
+    token: b
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if j, ok := cfg.JiraByName(""); !ok || j.Name != "onprem" {
+		t.Errorf("expected default instance onprem, got %+v", j)
+	}
+	if j, ok := cfg.JiraByName("cloud"); !ok || j.URL != "https://example.atlassian.net" {
+		t.Errorf("unexpected cloud instance: %+v", j)
+	}
+	if _, ok := cfg.JiraByName("missing"); ok {
+		t.Error("expected unknown instance to be rejected")
+	}
+	if names := strings.Join(cfg.JiraNames(), ","); names != "onprem,cloud" {
+		t.Errorf("unexpected names: %s", names)
+	}
+}
+
+func TestJiraImport(t *testing.T) {
+	export := filepath.Join(t.TempDir(), "export.csv")
+	if err := os.WriteFile(export, []byte("Summary,Issue key\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := writeConfig(t, `
+jira:
+  - name: main
+    url: https://jira.example.com
+    token: x
+  - name: offline
+    import: `+export+`
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if j, ok := cfg.JiraByName("offline"); !ok || !j.Offline() || j.Token != "" {
+		t.Errorf("expected offline instance without token, got %+v", j)
+	}
+	if j, _ := cfg.JiraByName("main"); j.Offline() {
+		t.Error("instance with url should not be offline")
+	}
+
+	path = writeConfig(t, `
+jira:
+  - name: both
+    url: https://jira.example.com
+    import: `+export+`
+  - name: missing
+    import: /nonexistent/export.csv
+`)
+	_, err = Load(path)
+	for _, want := range []string{"jira[0]: укажите либо url, либо import", "jira[1].import"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in error, got %v", want, err)
+		}
+	}
+}
+
+func TestValidateAuth(t *testing.T) {
+	path := writeConfig(t, `
+jira:
+  - url: https://jira.example.com
+    token: x
+`)
+	t.Setenv("AUTH_DISABLED", "")
+
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "auth: не настроен вход") {
+		t.Errorf("expected missing auth error, got %v", err)
+	}
+
+	path = writeConfig(t, `
+jira:
+  - url: https://jira.example.com
+    token: x
+auth:
+  users:
+    - name: alice
+      password_hash: plain-text
+  oidc:
+    issuer: https://accounts.example.com
+    client_secret: oidc-secret
+  token_store: tokens.json
+`)
+	t.Setenv("AUTH_DISABLED", "")
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"auth.users[0].password_hash", "auth.oidc.client_id", "auth.oidc.redirect_url", "auth.token_key: нужен"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in error, got:\n%v", want, err)
+		}
+	}
+
+	cfg, err := Read(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := cfg.Masked()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(out, "oidc-secret") || strings.Contains(out, "plain-text") {
+		t.Errorf("auth secrets are not masked:\n%s", out)
+	}
+
+	t.Setenv("TOKEN_KEY", "c2hvcnQ=")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "auth.token_key: ожидается 32 байта") {
+		t.Errorf("expected token key length error, got %v", err)
+	}
+}
+
+func TestLoadClient(t *testing.T) {
+	path := writeConfig(t, `
+jira:
+  - url: https://jira.example.com
+    token: x
+server:
+  templates_dir: missing
+auth:
+  token_store: tokens.json
+`)
+	t.Setenv("TEMPLATES_DIR", "")
+	t.Setenv("AUTH_DISABLED", "")
+
+	// Командной строке не нужны шаблоны и настройки входа, проверяются только Jira и Ollama
+	if _, err := LoadClient(path); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "server.templates_dir") {
+		t.Errorf("expected server validation error, got %v", err)
+	}
+}
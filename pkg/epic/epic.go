@@ -0,0 +1,204 @@
+package epic
+
+import (
+	"context"
+	"fmt"
+	"jira-go/models"
+	"jira-go/pkg/jira"
+	"jira-go/pkg/ollama"
+	"jira-go/pkg/prompt"
+	"strings"
+	"time"
+)
+
+const (
+	// StaleAfter - задача без обновлений дольше этого срока считается зависшей
+	StaleAfter = 14 * 24 * time.Hour
+	// ScopeGrace - задачи, добавленные в эпик позже этого срока после его создания,
+	// считаются расширением объема
+	ScopeGrace = 7 * 24 * time.Hour
+)
+
+// systemPrompt - инструкция по умолчанию, ее можно заменить файлом epic_report.txt в prompt_dir
+const systemPrompt = "Ты помощник руководителя проекта. По данным эпика подготовь в формате Markdown сводку о состоянии: " +
+	"прогресс, блокеры, зависшие задачи, расширение объема, основные риски и рекомендуемые действия. " +
+	"Опирайся только на переданные данные и ссылайся на ключи задач."
+
+type Item struct {
+	Key       string `json:"key"`
+	Summary   string `json:"summary"`
+	Status    string `json:"status"`
+	Assignee  string `json:"assignee"`
+	Priority  string `json:"priority"`
+	Updated   string `json:"updated"`
+	DaysStale int    `json:"daysStale,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Report - сводка по эпику: вычисленные показатели и разбор от модели
+type Report struct {
+	Epic        Item      `json:"epic"`
+	Total       int       `json:"total"`
+	Done        int       `json:"done"`
+	InProgress  int       `json:"inProgress"`
+	ToDo        int       `json:"toDo"`
+	Progress    int       `json:"progress"`
+	Blockers    []Item    `json:"blockers"`
+	Stale       []Item    `json:"stale"`
+	ScopeAdded  []Item    `json:"scopeAdded"`
+	Children    []Item    `json:"children"`
+	Analysis    string    `json:"analysis"`
+	Model       string    `json:"model"`
+	GeneratedAt time.Time `json:"generatedAt"`
+}
+
+// Analyze считает прогресс эпика и находит блокеры, зависшие задачи и расширение объема
+func Analyze(epic jira.JiraTask, children []jira.JiraTask, now time.Time) *Report {
+	report := &Report{
+		Epic:        item(epic),
+		Total:       len(children),
+		Blockers:    []Item{},
+		Stale:       []Item{},
+		ScopeAdded:  []Item{},
+		Children:    []Item{},
+		GeneratedAt: now,
+	}
+
+	epicCreated, epicErr := jira.ParseTime(epic.Fields.Created)
+
+	for _, child := range children {
+		it := item(child)
+		report.Children = append(report.Children, it)
+
+		switch {
+		case child.Done():
+			report.Done++
+		case child.Fields.Status.StatusCategory.Key == "indeterminate":
+			report.InProgress++
+		default:
+			report.ToDo++
+		}
+
+		if epicErr == nil {
+			if created, err := jira.ParseTime(child.Fields.Created); err == nil && created.After(epicCreated.Add(ScopeGrace)) {
+				added := it
+				added.Reason = "добавлена " + created.Format("02.01.2006")
+				report.ScopeAdded = append(report.ScopeAdded, added)
+			}
+		}
+
+		if child.Done() {
+			continue
+		}
+
+		if reason := blockReason(child); reason != "" {
+			blocker := it
+			blocker.Reason = reason
+			report.Blockers = append(report.Blockers, blocker)
+		}
+
+		if updated, err := jira.ParseTime(child.Fields.Updated); err == nil && now.Sub(updated) > StaleAfter {
+			stale := it
+			stale.DaysStale = int(now.Sub(updated).Hours() / 24)
+			report.Stale = append(report.Stale, stale)
+		}
+	}
+
+	if report.Total > 0 {
+		report.Progress = report.Done * 100 / report.Total
+	}
+	return report
+}
+
+// blockReason объясняет, почему незавершенная задача считается блокером
+func blockReason(task jira.JiraTask) string {
+	status := strings.ToLower(task.Fields.Status.Name)
+	if strings.Contains(status, "block") || strings.Contains(status, "блок") {
+		return "статус " + task.Fields.Status.Name
+	}
+
+	for _, link := range task.Fields.IssueLinks {
+		if link.InwardIssue != nil && strings.Contains(strings.ToLower(link.Type.Inward), "blocked") &&
+			link.InwardIssue.Fields.Status.StatusCategory.Key != "done" {
+			return "заблокирована задачей " + link.InwardIssue.Key
+		}
+	}
+
+	switch task.Fields.Priority.Name {
+	case "Blocker", "Highest":
+		return "приоритет " + task.Fields.Priority.Name
+	}
+	return ""
+}
+
+func item(task jira.JiraTask) Item {
+	return Item{
+		Key:      task.Key,
+		Summary:  task.Fields.Summary,
+		Status:   task.Fields.Status.Name,
+		Assignee: task.Fields.Assignee.DisplayName,
+		Priority: task.Fields.Priority.Name,
+		Updated:  task.Fields.Updated,
+	}
+}
+
+// BuildMessages готовит запрос к модели на разбор состояния эпика
+func BuildMessages(report *Report) []models.Message {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Эпик %s: %s (статус: %s)\n", report.Epic.Key, report.Epic.Summary, report.Epic.Status)
+	fmt.Fprintf(&b, "Задач: %d, готово: %d, в работе: %d, не начато: %d, прогресс: %d%%\n\n",
+		report.Total, report.Done, report.InProgress, report.ToDo, report.Progress)
+
+	b.WriteString("Задачи эпика:\n")
+	for _, c := range report.Children {
+		assignee := c.Assignee
+		if assignee == "" {
+			assignee = "не назначена"
+		}
+		fmt.Fprintf(&b, "- %s [%s, %s, %s] %s\n", c.Key, c.Status, c.Priority, assignee, c.Summary)
+	}
+
+	writeItems(&b, "Блокеры", report.Blockers, func(it Item) string { return it.Reason })
+	writeItems(&b, "Зависшие задачи", report.Stale, func(it Item) string {
+		return fmt.Sprintf("без обновлений %d дн.", it.DaysStale)
+	})
+	writeItems(&b, "Добавлены после старта эпика", report.ScopeAdded, func(it Item) string { return it.Reason })
+
+	return []models.Message{
+		{
+			Role:    "system",
+			Content: prompt.System("epic_report", systemPrompt),
+		},
+		{
+			Role:    "user",
+			Content: b.String(),
+		},
+	}
+}
+
+func writeItems(b *strings.Builder, title string, items []Item, detail func(Item) string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n%s:\n", title)
+	for _, it := range items {
+		fmt.Fprintf(b, "- %s %s (%s)\n", it.Key, it.Summary, detail(it))
+	}
+}
+
+// Generate собирает сводку по эпику и добавляет к ней разбор от модели;
+// отмена ctx обрывает запрос к модели
+func Generate(ctx context.Context, OllamaHost, model string, epic jira.JiraTask, children []jira.JiraTask) (*Report, error) {
+	report := Analyze(epic, children, time.Now())
+	if report.Total == 0 {
+		return nil, fmt.Errorf("у эпика %s нет задач", epic.Key)
+	}
+
+	analysis, err := ollama.SendOllamaMessageContext(ctx, OllamaHost, model, BuildMessages(report), ollama.ChatOptions{})
+	if err != nil {
+		return nil, err
+	}
+	report.Analysis = strings.TrimSpace(analysis)
+	report.Model = model
+	return report, nil
+}
@@ -0,0 +1,103 @@
+package epic
+
+import (
+	"context"
+	"encoding/json"
+	"jira-go/pkg/jira"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func decodeTasks(t *testing.T, raw string) []jira.JiraTask {
+	var tasks []jira.JiraTask
+	if err := json.Unmarshal([]byte(raw), &tasks); err != nil {
+		t.Fatalf("failed to decode fixture: %v", err)
+	}
+	return tasks
+}
+
+const epicFixture = `[{"key": "EPIC-1", "fields": {"summary": "New checkout", "status": {"name": "In Progress"}, "created": "2024-01-01T09:00:00.000+0000"}}]`
+
+const childrenFixture = `[
+	{"key": "EPIC-2", "fields": {"summary": "Cart", "status": {"name": "Done", "statusCategory": {"key": "done"}},
+		"created": "2024-01-02T09:00:00.000+0000", "updated": "2024-01-10T09:00:00.000+0000"}},
+	{"key": "EPIC-3", "fields": {"summary": "Payment", "status": {"name": "In Progress", "statusCategory": {"key": "indeterminate"}},
+		"created": "2024-01-02T09:00:00.000+0000", "updated": "2024-02-28T09:00:00.000+0000",
+		"issuelinks": [{"type": {"name": "Blocks", "inward": "is blocked by", "outward": "blocks"},
+			"inwardIssue": {"key": "OPS-1", "fields": {"summary": "Gateway", "status": {"name": "Open", "statusCategory": {"key": "new"}}}}}]}},
+	{"key": "EPIC-4", "fields": {"summary": "Receipts", "status": {"name": "To Do", "statusCategory": {"key": "new"}},
+		"priority": {"name": "Blocker"}, "assignee": {"displayName": "Anna"},
+		"created": "2024-02-20T09:00:00.000+0000", "updated": "2024-01-05T09:00:00.000+0000"}},
+	{"key": "EPIC-5", "fields": {"summary": "Old done", "status": {"name": "Closed"}, "resolution": {"name": "Fixed"},
+		"created": "2024-02-20T09:00:00.000+0000", "updated": "2023-12-01T09:00:00.000+0000"}}
+]`
+
+func TestAnalyze(t *testing.T) {
+	epicTask := decodeTasks(t, epicFixture)[0]
+	children := decodeTasks(t, childrenFixture)
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	report := Analyze(epicTask, children, now)
+
+	if report.Total != 4 || report.Done != 2 || report.InProgress != 1 || report.ToDo != 1 {
+		t.Errorf("unexpected counters: %+v", report)
+	}
+	if report.Progress != 50 {
+		t.Errorf("expected progress 50, got %d", report.Progress)
+	}
+
+	if len(report.Blockers) != 2 {
+		t.Fatalf("expected 2 blockers, got %+v", report.Blockers)
+	}
+	if report.Blockers[0].Key != "EPIC-3" || report.Blockers[0].Reason != "заблокирована задачей OPS-1" {
+		t.Errorf("unexpected link blocker: %+v", report.Blockers[0])
+	}
+	if report.Blockers[1].Key != "EPIC-4" || report.Blockers[1].Reason != "приоритет Blocker" {
+		t.Errorf("unexpected priority blocker: %+v", report.Blockers[1])
+	}
+
+	if len(report.Stale) != 1 || report.Stale[0].Key != "EPIC-4" || report.Stale[0].DaysStale != 56 {
+		t.Errorf("expected EPIC-4 to be stale for 56 days, got %+v", report.Stale)
+	}
+
+	if len(report.ScopeAdded) != 2 || report.ScopeAdded[0].Key != "EPIC-4" || report.ScopeAdded[1].Key != "EPIC-5" {
+		t.Errorf("unexpected scope creep: %+v", report.ScopeAdded)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		content := req.Messages[1].Content
+		for _, want := range []string{"Эпик EPIC-1", "прогресс: 50%", "Блокеры:", "EPIC-4 Receipts (приоритет Blocker)"} {
+			if !strings.Contains(content, want) {
+				t.Errorf("expected %q in prompt:\n%s", want, content)
+			}
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": map[string]interface{}{"content": "  Эпик идет по плану  "},
+		})
+	}))
+	defer server.Close()
+
+	report, err := Generate(context.Background(), server.URL, "test-model", decodeTasks(t, epicFixture)[0], decodeTasks(t, childrenFixture))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Analysis != "Эпик идет по плану" || report.Model != "test-model" {
+		t.Errorf("unexpected analysis: %+v", report)
+	}
+
+	if _, err := Generate(context.Background(), server.URL, "test-model", decodeTasks(t, epicFixture)[0], nil); err == nil {
+		t.Error("expected error for epic without children")
+	}
+}
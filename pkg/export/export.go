@@ -0,0 +1,260 @@
+// Package export выгружает список задач вместе с ответами модели в CSV, Markdown и XLSX
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"jira-go/pkg/jira"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Форматы выгрузки
+const (
+	FormatCSV      = "csv"
+	FormatMarkdown = "md"
+	FormatXLSX     = "xlsx"
+)
+
+// Item - задача и последний ответ модели о ней
+type Item struct {
+	Task jira.JiraTask
+	// URL - ссылка на задачу в Jira
+	URL        string
+	Model      string
+	Question   string
+	Answer     string
+	AnsweredAt time.Time
+}
+
+// Column - столбец выгрузки
+type Column struct {
+	Name  string
+	Title string
+	value func(Item) string
+}
+
+// columns - все столбцы в порядке по умолчанию для выбора в интерфейсе
+var columns = []Column{
+	{"key", "Ключ", func(i Item) string { return i.Task.Key }},
+	{"instance", "Подключение", func(i Item) string { return i.Task.Instance }},
+	{"summary", "Заголовок", func(i Item) string { return i.Task.Fields.Summary }},
+	{"status", "Статус", func(i Item) string { return i.Task.Fields.Status.Name }},
+	{"type", "Тип", func(i Item) string { return i.Task.Fields.IssueType.Name }},
+	{"priority", "Приоритет", func(i Item) string { return i.Task.Fields.Priority.Name }},
+	{"assignee", "Исполнитель", func(i Item) string { return i.Task.Fields.Assignee.DisplayName }},
+	{"created", "Создана", func(i Item) string { return jiraDate(i.Task.Fields.Created) }},
+	{"updated", "Обновлена", func(i Item) string { return jiraDate(i.Task.Fields.Updated) }},
+	{"url", "Ссылка", func(i Item) string { return i.URL }},
+	{"description", "Описание", func(i Item) string { return i.Task.Fields.Description.Markdown() }},
+	{"model", "Модель", func(i Item) string { return i.Model }},
+	{"question", "Вопрос", func(i Item) string { return i.Question }},
+	{"answer", "Ответ модели", func(i Item) string { return i.Answer }},
+	{"answered_at", "Время ответа", func(i Item) string {
+		if i.AnsweredAt.IsZero() {
+			return ""
+		}
+		return i.AnsweredAt.Format("2006-01-02 15:04")
+	}},
+}
+
+// DefaultColumns - столбцы, если они не выбраны явно
+var DefaultColumns = []string{"key", "summary", "status", "priority", "assignee", "model", "answer"}
+
+// Columns возвращает все доступные столбцы
+func Columns() []Column {
+	return append([]Column(nil), columns...)
+}
+
+// ParseColumns разбирает список столбцов через запятую; пустой список - DefaultColumns
+func ParseColumns(list string) ([]Column, error) {
+	names := DefaultColumns
+	if strings.TrimSpace(list) != "" {
+		names = strings.Split(list, ",")
+	}
+
+	var selected []Column
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		column, ok := columnByName(name)
+		if !ok {
+			return nil, fmt.Errorf("неизвестный столбец %q, доступны: %s", name, strings.Join(columnNames(), ", "))
+		}
+		seen[name] = true
+		selected = append(selected, column)
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("не выбрано ни одного столбца")
+	}
+	return selected, nil
+}
+
+// ParseFormat проверяет формат выгрузки; пустое значение - CSV
+func ParseFormat(format string) (string, error) {
+	switch f := strings.ToLower(strings.TrimSpace(format)); f {
+	case "", FormatCSV:
+		return FormatCSV, nil
+	case FormatMarkdown, "markdown":
+		return FormatMarkdown, nil
+	case FormatXLSX:
+		return FormatXLSX, nil
+	default:
+		return "", fmt.Errorf("неизвестный формат %q, доступны: csv, md, xlsx", format)
+	}
+}
+
+// ContentType возвращает MIME-тип файла выгрузки
+func ContentType(format string) string {
+	switch format {
+	case FormatMarkdown:
+		return "text/markdown; charset=utf-8"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
+
+// Write выгружает задачи в выбранном формате
+func Write(w io.Writer, format string, cols []Column, items []Item) error {
+	header := make([]string, len(cols))
+	for i, column := range cols {
+		header[i] = column.Title
+	}
+	rows := make([][]string, len(items))
+	for i, item := range items {
+		rows[i] = make([]string, len(cols))
+		for j, column := range cols {
+			rows[i][j] = column.value(item)
+		}
+	}
+
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, header, rows)
+	case FormatMarkdown:
+		return writeMarkdown(w, header, rows)
+	case FormatXLSX:
+		return writeXLSX(w, header, rows)
+	default:
+		return fmt.Errorf("неизвестный формат %q", format)
+	}
+}
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// FileName составляет имя файла выгрузки: jira-<подключение>-<проект>-<ГГГГММДД-ЧЧММ>.<формат>.
+// Если задачи из разных подключений или проектов, вместо имени пишется mixed.
+func FileName(items []Item, format string, now time.Time) string {
+	instances, projects := map[string]bool{}, map[string]bool{}
+	for _, item := range items {
+		instances[item.Task.Instance] = true
+		project, _, _ := strings.Cut(item.Task.Key, "-")
+		projects[project] = true
+	}
+	return fmt.Sprintf("jira-%s-%s-%s.%s", namePart(instances, "default"), namePart(projects, "tasks"), now.Format("20060102-1504"), format)
+}
+
+// namePart возвращает единственное значение из набора, пригодное для имени файла
+func namePart(values map[string]bool, empty string) string {
+	switch len(values) {
+	case 0:
+		return empty
+	case 1:
+		for value := range values {
+			if value = strings.Trim(unsafeName.ReplaceAllString(value, "_"), "_"); value != "" {
+				return value
+			}
+		}
+		return empty
+	default:
+		return "mixed"
+	}
+}
+
+func writeCSV(w io.Writer, header []string, rows [][]string) error {
+	// BOM нужен Excel, чтобы открыть файл в UTF-8, а не в системной кодировке
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = csvCell(cell)
+		}
+		if err := cw.Write(cells); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvCell добавляет апостроф перед значением, которое Excel принял бы за формулу:
+// заголовки задач и ответы модели приходят извне, а файлом делятся с другими
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func writeMarkdown(w io.Writer, header []string, rows [][]string) error {
+	if _, err := fmt.Fprintf(w, "| %s |\n|%s\n", strings.Join(header, " | "), strings.Repeat(" --- |", len(header))); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = markdownCell(cell)
+		}
+		if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markdownCell экранирует | и заменяет переводы строк на <br>, чтобы ответ модели
+// не разорвал строку таблицы
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(strings.TrimSpace(s), "\r\n", "\n")
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+func columnByName(name string) (Column, bool) {
+	for _, column := range columns {
+		if column.Name == name {
+			return column, true
+		}
+	}
+	return Column{}, false
+}
+
+func columnNames() []string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name
+	}
+	return names
+}
+
+// jiraDate переводит дату Jira в вид ГГГГ-ММ-ДД ЧЧ:ММ; нераспознанная дата выводится как есть
+func jiraDate(value string) string {
+	t, err := jira.ParseTime(value)
+	if err != nil {
+		return value
+	}
+	return t.Format("2006-01-02 15:04")
+}
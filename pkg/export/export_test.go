@@ -0,0 +1,211 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"jira-go/pkg/jira"
+	"strings"
+	"testing"
+	"time"
+)
+
+func items(t *testing.T) []Item {
+	t.Helper()
+	var first, second jira.JiraTask
+	if err := json.Unmarshal([]byte(`{"key": "PROJ-1", "fields": {"summary": "Падает вход | SSO", "status": {"name": "Open"}, "created": "2024-01-31T10:15:00.000+0300"}}`), &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`{"key": "PROJ-2", "fields": {"summary": "Медленный поиск", "status": {"name": "Done"}}}`), &second); err != nil {
+		t.Fatal(err)
+	}
+	first.Instance, second.Instance = "main", "main"
+	return []Item{
+		{Task: first, URL: "https://jira/browse/PROJ-1", Model: "llama3", Answer: "Проверьте SSO.\nЗатем \"сертификат\".", AnsweredAt: time.Date(2024, 2, 1, 9, 30, 0, 0, time.UTC)},
+		{Task: second},
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	cols, err := ParseColumns("")
+	if err != nil || len(cols) != len(DefaultColumns) || cols[0].Name != "key" {
+		t.Errorf("expected default columns, got %v, %v", cols, err)
+	}
+
+	cols, err = ParseColumns(" Key, answer,key,, created ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for _, c := range cols {
+		names = append(names, c.Name)
+	}
+	if strings.Join(names, ",") != "key,answer,created" {
+		t.Errorf("unexpected columns: %v", names)
+	}
+
+	if _, err := ParseColumns("key,secret"); err == nil || !strings.Contains(err.Error(), "secret") {
+		t.Errorf("expected unknown column error, got %v", err)
+	}
+	if _, err := ParseColumns(" , "); err == nil {
+		t.Error("expected error for empty selection")
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for input, expected := range map[string]string{"": FormatCSV, "CSV": FormatCSV, "markdown": FormatMarkdown, "md": FormatMarkdown, "xlsx": FormatXLSX} {
+		if f, err := ParseFormat(input); err != nil || f != expected {
+			t.Errorf("%q: expected %s, got %s, %v", input, expected, f, err)
+		}
+	}
+	if _, err := ParseFormat("pdf"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	cols, _ := ParseColumns("key,summary,created,answer,answered_at")
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatCSV, cols, items(t)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "\ufeff") {
+		t.Error("expected UTF-8 BOM for Excel")
+	}
+
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(buf.String(), "\ufeff"))).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid csv: %v", err)
+	}
+	expected := [][]string{
+		{"Ключ", "Заголовок", "Создана", "Ответ модели", "Время ответа"},
+		{"PROJ-1", "Падает вход | SSO", "2024-01-31 10:15", "Проверьте SSO.\nЗатем \"сертификат\".", "2024-02-01 09:30"},
+		{"PROJ-2", "Медленный поиск", "", "", ""},
+	}
+	for i := range expected {
+		if strings.Join(records[i], "\x00") != strings.Join(expected[i], "\x00") {
+			t.Errorf("row %d: expected %q, got %q", i, expected[i], records[i])
+		}
+	}
+}
+
+// Значения, похожие на формулы, не выполняются при открытии файла в Excel
+func TestWriteCSVFormulas(t *testing.T) {
+	cols, _ := ParseColumns("key,summary,answer")
+	var task jira.JiraTask
+	task.Key = "PROJ-3"
+	task.Fields.Summary = `=HYPERLINK("http://evil","нажми")`
+	items := []Item{
+		{Task: task, Answer: "@SUM(A1)"},
+		{Task: jira.JiraTask{Key: "PROJ-4"}, Answer: "-1+2"},
+		{Task: jira.JiraTask{Key: "PROJ-5"}, Answer: "\t+cmd"},
+		{Task: jira.JiraTask{Key: "PROJ-6"}, Answer: "Ответ = 42"},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatCSV, cols, items); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(buf.String(), "\ufeff"))).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid csv: %v", err)
+	}
+	expected := [][]string{
+		{"PROJ-3", `'=HYPERLINK("http://evil","нажми")`, "'@SUM(A1)"},
+		{"PROJ-4", "", "'-1+2"},
+		{"PROJ-5", "", "'\t+cmd"},
+		{"PROJ-6", "", "Ответ = 42"},
+	}
+	for i, want := range expected {
+		if strings.Join(records[i+1], "\x00") != strings.Join(want, "\x00") {
+			t.Errorf("row %d: expected %q, got %q", i, want, records[i+1])
+		}
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	cols, _ := ParseColumns("key,summary,answer")
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatMarkdown, cols, items(t)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "| Ключ | Заголовок | Ответ модели |\n" +
+		"| --- | --- | --- |\n" +
+		"| PROJ-1 | Падает вход \\| SSO | Проверьте SSO.<br>Затем \"сертификат\". |\n" +
+		"| PROJ-2 | Медленный поиск |  |\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected markdown:\n%s", buf.String())
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	cols, _ := ParseColumns("key,summary,answer")
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatXLSX, cols, items(t)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("xlsx is not a zip archive: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(body)
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("missing %s", name)
+		}
+	}
+
+	sheet := files["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<c r="A1" t="inlineStr" s="1"><is><t xml:space="preserve">Ключ</t></is></c>`,
+		`<c r="B2" t="inlineStr" s="0"><is><t xml:space="preserve">Падает вход | SSO</t></is></c>`,
+		`Проверьте SSO.&#xA;Затем &#34;сертификат&#34;.`,
+		`<row r="3"><c r="A3"`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("expected %q in sheet:\n%s", want, sheet)
+		}
+	}
+	if strings.Contains(sheet, `r="C3"`) {
+		t.Error("empty cells should be omitted")
+	}
+}
+
+func TestColumnLetter(t *testing.T) {
+	for i, expected := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := columnLetter(i); got != expected {
+			t.Errorf("%d: expected %s, got %s", i, expected, got)
+		}
+	}
+}
+
+func TestFileName(t *testing.T) {
+	now := time.Date(2024, 3, 5, 14, 7, 0, 0, time.UTC)
+	list := items(t)
+
+	if name := FileName(list, FormatXLSX, now); name != "jira-main-PROJ-20240305-1407.xlsx" {
+		t.Errorf("unexpected name %s", name)
+	}
+
+	list[1].Task.Key, list[1].Task.Instance = "OPS-7", "облако"
+	if name := FileName(list, FormatCSV, now); name != "jira-mixed-mixed-20240305-1407.csv" {
+		t.Errorf("unexpected name for mixed tasks %s", name)
+	}
+	if name := FileName(list[1:], FormatMarkdown, now); name != "jira-default-OPS-20240305-1407.md" {
+		t.Errorf("unexpected name for non-latin instance %s", name)
+	}
+	if name := FileName(nil, FormatCSV, now); name != "jira-default-tasks-20240305-1407.csv" {
+		t.Errorf("unexpected name for empty list %s", name)
+	}
+}
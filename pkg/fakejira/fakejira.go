@@ -0,0 +1,657 @@
+// Package fakejira - поддельная Jira для разработки, демонстраций и сквозных тестов без сети.
+// Отвечает на те запросы REST API v2, которые использует приложение (поиск, задача,
+// комментарии, переходы, создание задачи, myself), и хранит задачи из фикстуры в памяти.
+package fakejira
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeLayout - формат дат Jira REST API
+const timeLayout = "2006-01-02T15:04:05.000-0700"
+
+// Ограничения размера страницы поиска, как в Jira Cloud
+const (
+	defaultMaxResults = 50
+	maxMaxResults     = 100
+)
+
+//go:embed fixtures/default.json
+var defaultFixture []byte
+
+// Fixture - начальные данные поддельной Jira
+type Fixture struct {
+	// Users - пользователи и их токены; если список пуст, принимается любой запрос
+	Users []User `json:"users"`
+	// EpicLinkField - id поля Epic Link (как в Jira Server). Пусто - поля нет, как в Jira
+	// Cloud, и JQL с "Epic Link" получает 400.
+	EpicLinkField string `json:"epicLinkField"`
+	// SprintField - id поля спринта; значения - объекты с name, как в Jira Cloud
+	SprintField string `json:"sprintField"`
+	// Transitions - переходы, доступные из любого статуса, кроме целевого
+	Transitions []Transition `json:"transitions"`
+	// Issues - задачи в формате ответа /rest/api/2/issue. Даты вида now, now-2d, now-3h
+	// отсчитываются от момента загрузки, чтобы запросы вроде created >= startOfDay(-7)
+	// находили задачи в любой день.
+	Issues []map[string]interface{} `json:"issues"`
+}
+
+// User - учетная запись поддельной Jira
+type User struct {
+	Name         string `json:"name"`
+	DisplayName  string `json:"displayName"`
+	EmailAddress string `json:"emailAddress"`
+	Token        string `json:"token,omitempty"`
+}
+
+// Transition - переход задачи в другой статус
+type Transition struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	To   Status `json:"to"`
+}
+
+// Status - статус задачи и его категория (new, indeterminate, done)
+type Status struct {
+	Name           string `json:"name"`
+	StatusCategory struct {
+		Key string `json:"key"`
+	} `json:"statusCategory"`
+}
+
+// issue - задача в том виде, в котором ее отдает Jira
+type issue map[string]interface{}
+
+// Server - поддельная Jira; безопасна для одновременных запросов
+type Server struct {
+	mu      sync.Mutex
+	fixture Fixture
+	issues  []issue
+	nextID  int
+	now     func() time.Time
+	mux     *http.ServeMux
+}
+
+// DefaultFixture возвращает встроенную фикстуру с демонстрационным проектом DEMO
+func DefaultFixture() (*Fixture, error) {
+	return parseFixture(defaultFixture)
+}
+
+// LoadFixture читает фикстуру из JSON-файла
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения фикстуры: %v", err)
+	}
+	fixture, err := parseFixture(data)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора фикстуры %s: %v", path, err)
+	}
+	return fixture, nil
+}
+
+func parseFixture(data []byte) (*Fixture, error) {
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, err
+	}
+	for i, raw := range fixture.Issues {
+		if key, _ := raw["key"].(string); key == "" {
+			return nil, fmt.Errorf("задача %d: нет ключа", i+1)
+		}
+	}
+	return &fixture, nil
+}
+
+// New создает поддельную Jira с данными из фикстуры. Фикстура копируется, изменения
+// (комментарии, переходы, новые задачи) живут только в памяти сервера.
+func New(fixture *Fixture) *Server {
+	s := &Server{fixture: *fixture, nextID: 10000, now: time.Now}
+	if s.fixture.SprintField == "" {
+		s.fixture.SprintField = "customfield_10020"
+	}
+
+	loaded := time.Now()
+	for _, raw := range fixture.Issues {
+		i := issue(copyJSON(raw).(map[string]interface{}))
+		resolveDates(i, loaded)
+		if _, ok := i["id"]; !ok {
+			i["id"] = strconv.Itoa(s.nextID)
+		}
+		s.nextID++
+		if _, ok := i["fields"].(map[string]interface{}); !ok {
+			i["fields"] = map[string]interface{}{}
+		}
+		s.issues = append(s.issues, i)
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("GET /rest/api/2/myself", s.myself)
+	s.mux.HandleFunc("GET /rest/api/2/search", s.search)
+	s.mux.HandleFunc("POST /rest/api/2/search", s.search)
+	s.mux.HandleFunc("POST /rest/api/2/issue", s.createIssue)
+	s.mux.HandleFunc("GET /rest/api/2/issue/{key}", s.getIssue)
+	s.mux.HandleFunc("GET /rest/api/2/issue/{key}/comment", s.comments)
+	s.mux.HandleFunc("POST /rest/api/2/issue/{key}/comment", s.addComment)
+	s.mux.HandleFunc("GET /rest/api/2/issue/{key}/transitions", s.transitions)
+	s.mux.HandleFunc("POST /rest/api/2/issue/{key}/transitions", s.doTransition)
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeErrors(w, http.StatusNotFound, "Запрос "+r.Method+" "+r.URL.Path+" не поддерживается поддельной Jira")
+	})
+	return s
+}
+
+// ServeHTTP проверяет токен и передает запрос обработчику
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("fakejira: %s %s", r.Method, r.URL.RequestURI())
+	if _, ok := s.user(r); !ok {
+		writeErrors(w, http.StatusUnauthorized, "You are not authenticated. Authentication required to perform this operation.")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// user находит пользователя по токену Bearer; без пользователей в фикстуре все запросы
+// выполняются от имени admin
+func (s *Server) user(r *http.Request) (User, bool) {
+	if len(s.fixture.Users) == 0 {
+		return User{Name: "admin", DisplayName: "Administrator"}, true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return User{}, false
+	}
+	for _, u := range s.fixture.Users {
+		if u.Token == token {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+func (s *Server) myself(w http.ResponseWriter, r *http.Request) {
+	user, _ := s.user(r)
+	user.Token = ""
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	params := struct {
+		JQL        string `json:"jql"`
+		StartAt    int    `json:"startAt"`
+		MaxResults *int   `json:"maxResults"`
+	}{JQL: r.URL.Query().Get("jql")}
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			writeErrors(w, http.StatusBadRequest, "Неверный JSON: "+err.Error())
+			return
+		}
+	} else {
+		params.StartAt, _ = strconv.Atoi(r.URL.Query().Get("startAt"))
+		if value := r.URL.Query().Get("maxResults"); value != "" {
+			n, _ := strconv.Atoi(value)
+			params.MaxResults = &n
+		}
+	}
+	maxResults := defaultMaxResults
+	if params.MaxResults != nil {
+		maxResults = min(max(*params.MaxResults, 0), maxMaxResults)
+	}
+
+	user, _ := s.user(r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := parseJQL(params.JQL, s.field, user.Name, s.now())
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var found []issue
+	for _, i := range s.issues {
+		if q.where(i) {
+			found = append(found, i)
+		}
+	}
+	q.sortIssues(found)
+
+	page := []issue{}
+	if start := max(params.StartAt, 0); start < len(found) {
+		page = found[start:min(start+maxResults, len(found))]
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"startAt":    params.StartAt,
+		"maxResults": maxResults,
+		"total":      len(found),
+		"issues":     page,
+	})
+}
+
+func (s *Server) getIssue(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.find(r.PathValue("key"))
+	if !ok {
+		writeIssueNotFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, i)
+}
+
+// createIssue создает задачу в проекте из fields.project.key со следующим свободным номером
+func (s *Server) createIssue(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Fields map[string]interface{} `json:"fields"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, "Неверный JSON: "+err.Error())
+		return
+	}
+	fields := issue(req.Fields)
+	project := strings.ToUpper(str(fields, "project", "key"))
+	problems := map[string]string{}
+	if project == "" {
+		problems["project"] = "project is required"
+	}
+	if str(fields, "summary") == "" {
+		problems["summary"] = "You must specify a summary of the issue."
+	}
+	if str(fields, "issuetype", "name") == "" && str(fields, "issuetype", "id") == "" {
+		problems["issuetype"] = "issue type is required"
+	}
+	if len(problems) > 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"errorMessages": []string{}, "errors": problems})
+		return
+	}
+
+	user, _ := s.user(r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	number := 1
+	for _, i := range s.issues {
+		if p, n := splitKey(str(i, "key")); p == project && n >= number {
+			number = n + 1
+		}
+	}
+	key := fmt.Sprintf("%s-%d", project, number)
+	now := s.now().Format(timeLayout)
+	if req.Fields == nil {
+		req.Fields = map[string]interface{}{}
+	}
+	req.Fields["project"] = map[string]interface{}{"key": project}
+	req.Fields["created"], req.Fields["updated"] = now, now
+	req.Fields["reporter"] = map[string]interface{}{"name": user.Name, "displayName": user.DisplayName}
+	if _, ok := req.Fields["status"]; !ok {
+		req.Fields["status"] = s.initialStatus()
+	}
+	req.Fields["comment"] = map[string]interface{}{"comments": []interface{}{}, "total": 0}
+
+	id := strconv.Itoa(s.nextID)
+	s.nextID++
+	s.issues = append(s.issues, issue{"id": id, "key": key, "fields": req.Fields})
+	writeJSON(w, http.StatusCreated, map[string]string{"id": id, "key": key, "self": selfURL(r, "/rest/api/2/issue/"+id)})
+}
+
+func (s *Server) comments(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.find(r.PathValue("key"))
+	if !ok {
+		writeIssueNotFound(w)
+		return
+	}
+	comments := commentList(i)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"startAt": 0, "maxResults": len(comments), "total": len(comments), "comments": comments})
+}
+
+func (s *Server) addComment(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, "Неверный JSON: "+err.Error())
+		return
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"errorMessages": []string{}, "errors": map[string]string{"comment": "Comment body can not be empty!"}})
+		return
+	}
+
+	user, _ := s.user(r)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.find(r.PathValue("key"))
+	if !ok {
+		writeIssueNotFound(w)
+		return
+	}
+
+	now := s.now().Format(timeLayout)
+	comment := map[string]interface{}{
+		"id":      strconv.Itoa(s.nextID),
+		"author":  map[string]interface{}{"name": user.Name, "displayName": user.DisplayName},
+		"body":    req.Body,
+		"created": now,
+		"updated": now,
+	}
+	s.nextID++
+	comments := append(commentList(i), comment)
+	fields := i["fields"].(map[string]interface{})
+	fields["comment"] = map[string]interface{}{"comments": comments, "maxResults": len(comments), "total": len(comments), "startAt": 0}
+	fields["updated"] = now
+	writeJSON(w, http.StatusCreated, comment)
+}
+
+func (s *Server) transitions(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.find(r.PathValue("key"))
+	if !ok {
+		writeIssueNotFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"transitions": s.available(i)})
+}
+
+// doTransition переводит задачу в статус перехода; переход в категорию done ставит
+// резолюцию Done, остальные ее снимают
+func (s *Server) doTransition(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Transition struct {
+			ID string `json:"id"`
+		} `json:"transition"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, "Неверный JSON: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.find(r.PathValue("key"))
+	if !ok {
+		writeIssueNotFound(w)
+		return
+	}
+	for _, t := range s.available(i) {
+		if t.ID != req.Transition.ID {
+			continue
+		}
+		now := s.now().Format(timeLayout)
+		fields := i["fields"].(map[string]interface{})
+		fields["status"] = copyJSON(t.To)
+		fields["updated"] = now
+		if t.To.StatusCategory.Key == "done" {
+			fields["resolution"] = map[string]interface{}{"name": "Done"}
+			fields["resolutiondate"] = now
+		} else {
+			fields["resolution"], fields["resolutiondate"] = nil, nil
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeErrors(w, http.StatusBadRequest, fmt.Sprintf("Transition id '%s' is not valid for this issue.", req.Transition.ID))
+}
+
+// available возвращает переходы из текущего статуса задачи
+func (s *Server) available(i issue) []Transition {
+	transitions := []Transition{}
+	for _, t := range s.fixture.Transitions {
+		if !strings.EqualFold(t.To.Name, str(i, "fields", "status", "name")) {
+			transitions = append(transitions, t)
+		}
+	}
+	return transitions
+}
+
+// initialStatus - статус новой задачи: цель первого перехода фикстуры или To Do
+func (s *Server) initialStatus() interface{} {
+	if len(s.fixture.Transitions) > 0 {
+		return copyJSON(s.fixture.Transitions[0].To)
+	}
+	return map[string]interface{}{"name": "To Do", "statusCategory": map[string]interface{}{"key": "new"}}
+}
+
+// find ищет задачу по ключу (без учета регистра) или id. Вызывается под s.mu.
+func (s *Server) find(key string) (issue, bool) {
+	for _, i := range s.issues {
+		if strings.EqualFold(str(i, "key"), key) || str(i, "id") == key {
+			return i, true
+		}
+	}
+	return nil, false
+}
+
+// field возвращает поле для JQL
+func (s *Server) field(name string) (field, bool) {
+	path := func(p ...string) func(issue) []string {
+		return func(i issue) []string { return nonEmpty(str(i, p...)) }
+	}
+	names := func(p ...string) func(issue) []string {
+		return func(i issue) []string {
+			var values []string
+			list, _ := get(i, p...).([]interface{})
+			for _, item := range list {
+				switch v := item.(type) {
+				case string:
+					values = append(values, v)
+				case map[string]interface{}:
+					values = append(values, nonEmpty(str(v, "name"))...)
+				}
+			}
+			return values
+		}
+	}
+
+	f := field{name: name}
+	switch name {
+	case "project":
+		f.values = func(i issue) []string {
+			if key := str(i, "fields", "project", "key"); key != "" {
+				return []string{key}
+			}
+			project, _ := splitKey(str(i, "key"))
+			return []string{project}
+		}
+	case "key", "issuekey", "id":
+		f.name = "key"
+		f.values = func(i issue) []string { return []string{str(i, "key"), str(i, "id")} }
+	case "status":
+		f.values = path("fields", "status", "name")
+	case "statuscategory":
+		f.values = func(i issue) []string {
+			key := str(i, "fields", "status", "statusCategory", "key")
+			return nonEmpty(key, map[string]string{"new": "To Do", "indeterminate": "In Progress", "done": "Done"}[key])
+		}
+	case "resolution":
+		f.values = path("fields", "resolution", "name")
+	case "issuetype", "type":
+		f.values = path("fields", "issuetype", "name")
+	case "priority":
+		f.values = path("fields", "priority", "name")
+	case "assignee", "reporter":
+		f.values = func(i issue) []string {
+			return nonEmpty(str(i, "fields", name, "name"), str(i, "fields", name, "displayName"))
+		}
+	case "summary":
+		f.values = path("fields", "summary")
+	case "description":
+		f.values = func(i issue) []string { return nonEmpty(text(get(i, "fields", "description"))) }
+	case "comment":
+		f.values = func(i issue) []string {
+			var values []string
+			for _, c := range commentList(i) {
+				values = append(values, nonEmpty(text(get(issue(c.(map[string]interface{})), "body")))...)
+			}
+			return values
+		}
+	case "text":
+		f.values = func(i issue) []string {
+			values := nonEmpty(str(i, "fields", "summary"), text(get(i, "fields", "description")))
+			for _, c := range commentList(i) {
+				values = append(values, nonEmpty(text(get(issue(c.(map[string]interface{})), "body")))...)
+			}
+			return values
+		}
+	case "created", "createddate", "updated", "updateddate", "resolved", "resolutiondate":
+		f.name, f.date = strings.TrimSuffix(name, "date"), true
+		if f.name == "resolved" || f.name == "resolution" {
+			f.name = "resolutiondate"
+		}
+		f.values = path("fields", f.name)
+	case "fixversion":
+		f.values = names("fields", "fixVersions")
+	case "affectedversion":
+		f.values = names("fields", "versions")
+	case "component":
+		f.values = names("fields", "components")
+	case "labels":
+		f.values = names("fields", "labels")
+	case "sprint":
+		f.values = names("fields", s.fixture.SprintField)
+	case "parent":
+		f.values = path("fields", "parent", "key")
+	case "epic link":
+		if s.fixture.EpicLinkField == "" {
+			return field{}, false
+		}
+		f.values = path("fields", s.fixture.EpicLinkField)
+	default:
+		return field{}, false
+	}
+	return f, true
+}
+
+// resolveDates заменяет даты вида now-2d на настоящие
+func resolveDates(i issue, now time.Time) {
+	fields, _ := i["fields"].(map[string]interface{})
+	for _, name := range []string{"created", "updated", "resolutiondate"} {
+		if value, ok := fields[name].(string); ok {
+			fields[name] = relativeDate(value, now)
+		}
+	}
+	for _, c := range commentList(i) {
+		if comment, ok := c.(map[string]interface{}); ok {
+			for _, name := range []string{"created", "updated"} {
+				if value, ok := comment[name].(string); ok {
+					comment[name] = relativeDate(value, now)
+				}
+			}
+		}
+	}
+}
+
+func relativeDate(value string, now time.Time) string {
+	rest, ok := strings.CutPrefix(value, "now")
+	if !ok {
+		return value
+	}
+	if rest == "" {
+		return now.Format(timeLayout)
+	}
+	offset, err := relative(strings.TrimPrefix(rest, "+"))
+	if err != nil {
+		return value
+	}
+	return now.Add(offset).Format(timeLayout)
+}
+
+func commentList(i issue) []interface{} {
+	list, _ := get(i, "fields", "comment", "comments").([]interface{})
+	return list
+}
+
+// get возвращает значение по пути в JSON-объекте задачи
+func get(m map[string]interface{}, path ...string) interface{} {
+	var value interface{} = m
+	for _, p := range path {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = obj[p]
+	}
+	return value
+}
+
+func str(m map[string]interface{}, path ...string) string {
+	switch v := get(m, path...).(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// text возвращает текст описания или комментария: строку wiki или текст из ADF
+func text(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		var parts []string
+		if t, ok := v["text"].(string); ok {
+			parts = append(parts, t)
+		}
+		content, _ := v["content"].([]interface{})
+		for _, c := range content {
+			parts = append(parts, text(c))
+		}
+		return strings.Join(parts, " ")
+	default:
+		return ""
+	}
+}
+
+func nonEmpty(values ...string) []string {
+	var result []string
+	for _, v := range values {
+		if v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func parseTime(value string) (time.Time, error) {
+	return time.Parse(timeLayout, value)
+}
+
+// copyJSON делает глубокую копию через JSON, чтобы изменения не попадали в фикстуру
+func copyJSON(v interface{}) interface{} {
+	data, _ := json.Marshal(v)
+	var out interface{}
+	json.Unmarshal(data, &out)
+	return out
+}
+
+func selfURL(r *http.Request, path string) string {
+	return "http://" + r.Host + path
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeErrors отвечает ошибкой в формате Jira: {"errorMessages": [...], "errors": {}}
+func writeErrors(w http.ResponseWriter, status int, messages ...string) {
+	writeJSON(w, status, map[string]interface{}{"errorMessages": messages, "errors": map[string]string{}})
+}
+
+func writeIssueNotFound(w http.ResponseWriter) {
+	writeErrors(w, http.StatusNotFound, "Issue does not exist or you do not have permission to see it.")
+}
@@ -0,0 +1,200 @@
+package fakejira
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jira-go/pkg/jira"
+	"jira-go/pkg/release"
+	"jira-go/pkg/upstream"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const demoToken = "demo-token"
+
+func start(t *testing.T, change func(*Fixture)) string {
+	t.Helper()
+	fixture, err := DefaultFixture()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change != nil {
+		change(fixture)
+	}
+	server := httptest.NewServer(New(fixture))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func keys(tasks []jira.JiraTask) string {
+	var list []string
+	for _, t := range tasks {
+		list = append(list, t.Key)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
+// Клиент приложения работает с поддельной Jira так же, как с настоящей
+func TestClient(t *testing.T) {
+	url := start(t, nil)
+
+	user, err := jira.GetMyself(url, demoToken)
+	if err != nil || user.Name != "demo" || user.DisplayName != "Демо Пользователь" {
+		t.Errorf("unexpected user %+v: %v", user, err)
+	}
+	if _, err := jira.GetMyself(url, "wrong"); !errors.Is(err, upstream.ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized for wrong token, got %v", err)
+	}
+
+	found, err := jira.GetJiraTask(url, demoToken, "DEMO")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Открытые задачи, созданные за неделю: DEMO-1 и DEMO-7 старше, DEMO-5 и DEMO-6 закрыты
+	if got := keys(found.Issues); got != "DEMO-2,DEMO-3,DEMO-4,DEMO-8" || found.Total != 4 {
+		t.Errorf("unexpected project tasks %s (total %d)", got, found.Total)
+	}
+
+	task, err := jira.GetIssue(url, demoToken, "demo-2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(task.Fields.Comment.Comments) != 2 || len(task.Fields.IssueLinks) != 1 || task.Fields.IssueLinks[0].InwardIssue.Key != "DEMO-3" {
+		t.Errorf("unexpected issue: %+v", task.Fields)
+	}
+	if _, err := jira.ParseTime(task.Fields.Created); err != nil {
+		t.Errorf("relative date is not resolved: %v", err)
+	}
+	if _, err := jira.GetIssue(url, demoToken, "DEMO-99"); !errors.Is(err, upstream.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	comment, err := jira.AddComment(url, demoToken, "DEMO-2", "Ответ модели")
+	if err != nil || comment.Author.DisplayName != "Демо Пользователь" {
+		t.Fatalf("unexpected comment %+v: %v", comment, err)
+	}
+	if task, _ := jira.GetIssue(url, demoToken, "DEMO-2"); len(task.Fields.Comment.Comments) != 3 {
+		t.Errorf("comment is not saved: %d comments", len(task.Fields.Comment.Comments))
+	}
+
+	children, err := jira.GetEpicChildren(url, demoToken, "DEMO-1")
+	if err != nil || keys(children) != "DEMO-2,DEMO-3,DEMO-4,DEMO-5" {
+		t.Errorf("unexpected epic children %s: %v", keys(children), err)
+	}
+
+	jql, _ := release.BuildJQL("DEMO", "", "1.4")
+	issues, err := jira.SearchIssues(url, demoToken, jql)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// ORDER BY issuetype, key: сначала Bug, затем Task
+	if len(issues) != 2 || issues[0].Key != "DEMO-6" || issues[1].Key != "DEMO-5" {
+		t.Errorf("unexpected release issues %v", issues)
+	}
+	jql, _ = release.BuildJQL("DEMO", "Спринт 11", "")
+	if issues, err := jira.SearchIssues(url, demoToken, jql); err != nil || keys(issues) != "DEMO-5,DEMO-6" {
+		t.Errorf("unexpected sprint issues %s: %v", keys(issues), err)
+	}
+}
+
+// Без поля Epic Link (как в Jira Cloud) клиент повторяет поиск только по parent
+func TestEpicLinkMissing(t *testing.T) {
+	url := start(t, func(f *Fixture) { f.EpicLinkField = "" })
+
+	_, err := jira.SearchIssues(url, demoToken, `"Epic Link" = DEMO-1`)
+	if !errors.Is(err, upstream.ErrBadRequest) || !strings.Contains(err.Error(), "Epic Link") {
+		t.Errorf("expected 400 for unknown field, got %v", err)
+	}
+	children, err := jira.GetEpicChildren(url, demoToken, "DEMO-1")
+	if err != nil || keys(children) != "DEMO-4" {
+		t.Errorf("expected children by parent only, got %s: %v", keys(children), err)
+	}
+}
+
+func TestSearchPagination(t *testing.T) {
+	url := start(t, func(f *Fixture) {
+		f.Issues = nil
+		for i := 1; i <= 120; i++ {
+			f.Issues = append(f.Issues, map[string]interface{}{"key": fmt.Sprintf("BIG-%d", i), "fields": map[string]interface{}{"summary": "задача"}})
+		}
+	})
+
+	result, err := jira.Search(url, demoToken, jira.SearchQuery{JQL: "project = BIG ORDER BY key DESC"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Issues) != 120 || result.Total != 120 || result.Partial {
+		t.Fatalf("expected all 120 issues, got %d of %d", len(result.Issues), result.Total)
+	}
+	if result.Issues[0].Key != "BIG-120" || result.Issues[119].Key != "BIG-1" {
+		t.Errorf("unexpected order: %s ... %s", result.Issues[0].Key, result.Issues[119].Key)
+	}
+
+	limited, err := jira.Search(url, demoToken, jira.SearchQuery{JQL: "project = BIG", StartAt: 10, MaxResults: 5})
+	if err != nil || len(limited.Issues) != 5 || limited.Issues[0].Key != "BIG-11" || !limited.Partial {
+		t.Errorf("unexpected page %+v: %v", limited, err)
+	}
+}
+
+func do(t *testing.T, method, url, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+demoToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var data map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&data)
+	return resp.StatusCode, data
+}
+
+func TestCreateAndTransition(t *testing.T) {
+	url := start(t, nil)
+
+	status, data := do(t, "POST", url+"/rest/api/2/issue", `{"fields": {"project": {"key": "DEMO"}, "summary": "Новая задача", "issuetype": {"name": "Task"}}}`)
+	if status != http.StatusCreated || data["key"] != "DEMO-9" {
+		t.Fatalf("unexpected create response %d %v", status, data)
+	}
+	task, err := jira.GetIssue(url, demoToken, "DEMO-9")
+	if err != nil || task.Fields.Status.Name != "To Do" || task.Fields.Summary != "Новая задача" {
+		t.Fatalf("unexpected created issue %+v: %v", task, err)
+	}
+
+	status, data = do(t, "POST", url+"/rest/api/2/issue", `{"fields": {"project": {"key": "DEMO"}}}`)
+	if errs, _ := data["errors"].(map[string]interface{}); status != http.StatusBadRequest || errs["summary"] == nil {
+		t.Errorf("expected validation errors, got %d %v", status, data)
+	}
+
+	status, data = do(t, "GET", url+"/rest/api/2/issue/DEMO-9/transitions", "")
+	if list, _ := data["transitions"].([]interface{}); status != http.StatusOK || len(list) != 2 {
+		t.Errorf("expected transitions except the current status, got %d %v", status, data)
+	}
+	if status, _ := do(t, "POST", url+"/rest/api/2/issue/DEMO-9/transitions", `{"transition": {"id": "31"}}`); status != http.StatusNoContent {
+		t.Fatalf("unexpected transition status %d", status)
+	}
+	task, _ = jira.GetIssue(url, demoToken, "DEMO-9")
+	if !task.Done() || task.Fields.Resolution.Name != "Done" {
+		t.Errorf("issue should be resolved after transition: %+v", task.Fields.Status)
+	}
+	if issues, _ := jira.SearchIssues(url, demoToken, "key = DEMO-9 AND resolution IS NOT EMPTY"); len(issues) != 1 {
+		t.Error("resolved issue is not found by JQL")
+	}
+
+	if status, data := do(t, "POST", url+"/rest/api/2/issue/DEMO-9/transitions", `{"transition": {"id": "99"}}`); status != http.StatusBadRequest || data["errorMessages"] == nil {
+		t.Errorf("expected 400 for unknown transition, got %d %v", status, data)
+	}
+	if status, _ := do(t, "POST", url+"/rest/api/2/issue/DEMO-99/comment", `{"body": "текст"}`); status != http.StatusNotFound {
+		t.Errorf("expected 404 for missing issue, got %d", status)
+	}
+	if status, _ := do(t, "DELETE", url+"/rest/api/2/issue/DEMO-9", ""); status != http.StatusNotFound && status != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status for unsupported request %d", status)
+	}
+}
@@ -0,0 +1,502 @@
+package fakejira
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Разбор JQL в объеме, который нужен приложению и ручной проверке: условия поля с =, !=,
+// ~, !~, >, >=, <, <=, IN, NOT IN, IS [NOT] EMPTY, скобки, AND, OR, NOT, функции
+// startOfDay, endOfDay, now и currentUser, а также ORDER BY.
+
+// query - разобранный запрос
+type query struct {
+	where condition
+	order []orderField
+}
+
+type orderField struct {
+	field field
+	desc  bool
+}
+
+// condition проверяет задачу
+type condition func(i issue) bool
+
+// field - поле, по которому можно искать
+type field struct {
+	name   string
+	values func(i issue) []string
+	date   bool
+}
+
+// jqlError - ошибка в запросе; Jira отвечает на нее 400
+type jqlError struct {
+	message string
+}
+
+func (e *jqlError) Error() string {
+	return e.message
+}
+
+func errorf(format string, args ...interface{}) error {
+	return &jqlError{fmt.Sprintf(format, args...)}
+}
+
+// parser разбирает запрос; fields находит поле по имени (с учетом настроек фикстуры),
+// user - текущий пользователь для currentUser(), now - время для startOfDay() и т.п.
+type parser struct {
+	tokens []token
+	pos    int
+	fields func(name string) (field, bool)
+	user   string
+	now    time.Time
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+func parseJQL(jql string, fields func(string) (field, bool), user string, now time.Time) (*query, error) {
+	tokens, err := tokenize(jql)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, fields: fields, user: user, now: now}
+
+	q := &query{where: func(issue) bool { return true }}
+	if p.more() && !p.keyword("ORDER") {
+		if q.where, err = p.or(); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("ORDER") {
+		p.pos++
+		if !p.keyword("BY") {
+			return nil, errorf("Error in the JQL Query: expecting 'BY' after 'ORDER'")
+		}
+		p.pos++
+		if q.order, err = p.orderBy(); err != nil {
+			return nil, err
+		}
+	}
+	if p.more() {
+		return nil, errorf("Error in the JQL Query: unexpected %q", p.peek().text)
+	}
+	return q, nil
+}
+
+func tokenize(jql string) ([]token, error) {
+	var tokens []token
+	runes := []rune(jql)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				b.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, errorf("Error in the JQL Query: unterminated string")
+			}
+			tokens = append(tokens, token{text: b.String(), quoted: true})
+			i = j + 1
+		case strings.ContainsRune("(),", r):
+			tokens = append(tokens, token{text: string(r)})
+			i++
+		case strings.ContainsRune("=!~<>", r):
+			op := string(r)
+			if i+1 < len(runes) && strings.ContainsRune("!<>", r) && (runes[i+1] == '=' || r == '!' && runes[i+1] == '~') {
+				op += string(runes[i+1])
+			}
+			tokens = append(tokens, token{text: op})
+			i += len([]rune(op))
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune(`(),=!~<>"'`, runes[j]) {
+				j++
+			}
+			tokens = append(tokens, token{text: string(runes[i:j])})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func (p *parser) more() bool {
+	return p.pos < len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	if !p.more() {
+		return token{}
+	}
+	return p.tokens[p.pos]
+}
+
+// keyword сообщает, что следующий токен - ключевое слово (без кавычек, без учета регистра)
+func (p *parser) keyword(word string) bool {
+	t := p.peek()
+	return p.more() && !t.quoted && strings.EqualFold(t.text, word)
+}
+
+func (p *parser) next() (token, error) {
+	if !p.more() {
+		return token{}, errorf("Error in the JQL Query: the query is incomplete")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t, nil
+}
+
+func (p *parser) or() (condition, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(i issue) bool { return l(i) || right(i) }
+	}
+	return left, nil
+}
+
+func (p *parser) and() (condition, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		p.pos++
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(i issue) bool { return l(i) && right(i) }
+	}
+	return left, nil
+}
+
+func (p *parser) not() (condition, error) {
+	if p.keyword("NOT") {
+		p.pos++
+		c, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(i issue) bool { return !c(i) }, nil
+	}
+	if p.peek().text == "(" && !p.peek().quoted {
+		p.pos++
+		c, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t, err := p.next(); err != nil || t.text != ")" {
+			return nil, errorf("Error in the JQL Query: expecting ')'")
+		}
+		return c, nil
+	}
+	return p.clause()
+}
+
+// clause разбирает условие вида поле оператор значение
+func (p *parser) clause() (condition, error) {
+	name, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	f, ok := p.fields(strings.ToLower(name.text))
+	if !ok {
+		return nil, errorf("Field '%s' does not exist or you do not have permission to view it.", name.text)
+	}
+
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToUpper(op.text) {
+	case "IS":
+		negate := false
+		if p.keyword("NOT") {
+			p.pos++
+			negate = true
+		}
+		if !p.keyword("EMPTY") && !p.keyword("NULL") {
+			return nil, errorf("Error in the JQL Query: expecting EMPTY after IS")
+		}
+		p.pos++
+		return func(i issue) bool { return (len(f.values(i)) == 0) != negate }, nil
+	case "IN":
+		return p.in(f, false)
+	case "NOT":
+		if !p.keyword("IN") {
+			return nil, errorf("Error in the JQL Query: expecting IN after NOT")
+		}
+		p.pos++
+		return p.in(f, true)
+	}
+
+	value, err := p.value(f)
+	if err != nil {
+		return nil, err
+	}
+	switch op.text {
+	case "=":
+		return func(i issue) bool { return anyEqual(f.values(i), value) }, nil
+	case "!=":
+		return func(i issue) bool { v := f.values(i); return len(v) > 0 && !anyEqual(v, value) }, nil
+	case "~":
+		return func(i issue) bool { return anyContains(f.values(i), value) }, nil
+	case "!~":
+		return func(i issue) bool { return !anyContains(f.values(i), value) }, nil
+	case ">", ">=", "<", "<=":
+		if !f.date {
+			return nil, errorf("The operator '%s' is not supported by the '%s' field.", op.text, f.name)
+		}
+		bound, err := p.parseDate(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(i issue) bool {
+			for _, v := range f.values(i) {
+				t, err := parseTime(v)
+				if err != nil {
+					continue
+				}
+				switch op.text {
+				case ">":
+					return t.After(bound)
+				case ">=":
+					return !t.Before(bound)
+				case "<":
+					return t.Before(bound)
+				default:
+					return !t.After(bound)
+				}
+			}
+			return false
+		}, nil
+	default:
+		return nil, errorf("Error in the JQL Query: unknown operator %q", op.text)
+	}
+}
+
+func (p *parser) in(f field, negate bool) (condition, error) {
+	if t, err := p.next(); err != nil || t.text != "(" {
+		return nil, errorf("Error in the JQL Query: expecting '(' after IN")
+	}
+	var values []string
+	for {
+		value, err := p.value(f)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		t, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if t.text == ")" {
+			break
+		}
+		if t.text != "," {
+			return nil, errorf("Error in the JQL Query: expecting ',' or ')'")
+		}
+	}
+	return func(i issue) bool {
+		v := f.values(i)
+		for _, value := range values {
+			if anyEqual(v, value) {
+				return !negate
+			}
+		}
+		return negate && len(v) > 0
+	}, nil
+}
+
+// value читает значение; функции вычисляются сразу
+func (p *parser) value(f field) (string, error) {
+	t, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if t.quoted || p.peek().text != "(" {
+		return t.text, nil
+	}
+
+	p.pos++
+	var args []string
+	for p.more() && p.peek().text != ")" {
+		arg, _ := p.next()
+		if arg.text != "," {
+			args = append(args, arg.text)
+		}
+	}
+	if _, err := p.next(); err != nil {
+		return "", err
+	}
+
+	switch strings.ToLower(t.text) {
+	case "currentuser":
+		return p.user, nil
+	case "now":
+		return p.now.Format(timeLayout), nil
+	case "startofday", "endofday":
+		day := time.Date(p.now.Year(), p.now.Month(), p.now.Day(), 0, 0, 0, 0, p.now.Location())
+		if len(args) > 0 {
+			offset, err := relative(args[0])
+			if err != nil {
+				return "", err
+			}
+			day = day.Add(offset)
+		}
+		if strings.EqualFold(t.text, "endofday") {
+			day = day.Add(24*time.Hour - time.Millisecond)
+		}
+		return day.Format(timeLayout), nil
+	default:
+		return "", errorf("Unable to find JQL function '%s(%s)'.", t.text, strings.Join(args, ", "))
+	}
+}
+
+// parseDate разбирает дату в условии: результат функции, 2024-01-31, "2024-01-31 10:00" или -7d
+func (p *parser) parseDate(value string) (time.Time, error) {
+	if t, err := parseTime(value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006/01/02", "2006/01/02 15:04"} {
+		if t, err := time.ParseInLocation(layout, value, p.now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	if offset, err := relative(value); err == nil {
+		return p.now.Add(offset), nil
+	}
+	return time.Time{}, errorf("Date value '%s' for field is invalid.", value)
+}
+
+// relative разбирает смещение вида -7, -7d, 2w, -3h, 30m (без единицы - дни)
+func relative(value string) (time.Duration, error) {
+	units := map[byte]time.Duration{'w': 7 * 24 * time.Hour, 'd': 24 * time.Hour, 'h': time.Hour, 'm': time.Minute}
+	unit := 24 * time.Hour
+	if n := len(value); n > 0 {
+		if u, ok := units[value[n-1]]; ok {
+			unit, value = u, value[:n-1]
+		}
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errorf("Invalid date offset '%s'.", value)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+func (p *parser) orderBy() ([]orderField, error) {
+	var order []orderField
+	for {
+		name, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		f, ok := p.fields(strings.ToLower(name.text))
+		if !ok {
+			return nil, errorf("Not able to sort using field '%s'.", name.text)
+		}
+		o := orderField{field: f}
+		if p.keyword("ASC") || p.keyword("DESC") {
+			o.desc = p.keyword("DESC")
+			p.pos++
+		}
+		order = append(order, o)
+		if p.peek().text != "," {
+			return order, nil
+		}
+		p.pos++
+	}
+}
+
+// sortIssues упорядочивает задачи по ORDER BY; без него сохраняется порядок фикстуры
+func (q *query) sortIssues(issues []issue) {
+	if len(q.order) == 0 {
+		return
+	}
+	sort.SliceStable(issues, func(a, b int) bool {
+		for _, o := range q.order {
+			c := compareValues(first(o.field.values(issues[a])), first(o.field.values(issues[b])), o.field)
+			if c != 0 {
+				return (c < 0) != o.desc
+			}
+		}
+		return false
+	})
+}
+
+func compareValues(a, b string, f field) int {
+	if f.date {
+		ta, errA := parseTime(a)
+		tb, errB := parseTime(b)
+		if errA == nil && errB == nil {
+			return ta.Compare(tb)
+		}
+	}
+	if f.name == "key" {
+		pa, na := splitKey(a)
+		pb, nb := splitKey(b)
+		if pa != pb {
+			return strings.Compare(pa, pb)
+		}
+		return na - nb
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+func splitKey(key string) (string, int) {
+	project, number, _ := strings.Cut(key, "-")
+	n, _ := strconv.Atoi(number)
+	return project, n
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func anyEqual(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func anyContains(values []string, value string) bool {
+	value = strings.ToLower(strings.Trim(value, "*"))
+	for _, v := range values {
+		if strings.Contains(strings.ToLower(v), value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package fakejira
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJQL(t *testing.T) {
+	fixture, err := DefaultFixture()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(fixture)
+
+	tests := []struct {
+		jql  string
+		want string
+	}{
+		{"", "DEMO-1,DEMO-2,DEMO-3,DEMO-4,DEMO-5,DEMO-6,DEMO-7,DEMO-8"},
+		{"project = demo AND status = Open", "DEMO-2,DEMO-7"},
+		{"priority IN (Highest, High) AND NOT issuetype = Epic", "DEMO-2,DEMO-3,DEMO-6"},
+		{"status NOT IN (Done, Open)", "DEMO-1,DEMO-3,DEMO-4,DEMO-8"},
+		{"assignee = currentUser() AND resolution IS EMPTY", "DEMO-2,DEMO-8"},
+		{"assignee IS EMPTY", "DEMO-4,DEMO-6,DEMO-7"},
+		{`summary ~ "сертификат"`, "DEMO-2,DEMO-3"},
+		{"text ~ отпечаток", "DEMO-2"},
+		{"created >= startOfDay(-7) AND statusCategory != Done", "DEMO-2,DEMO-3,DEMO-4,DEMO-8"},
+		{"updated < -7d", "DEMO-6,DEMO-7"},
+		{"(component = Auth OR fixVersion = 1.4) AND statusCategory = Done", "DEMO-5,DEMO-6"},
+		{`sprint = "Спринт 12" ORDER BY key DESC`, "DEMO-8,DEMO-3,DEMO-2"},
+		{`"Epic Link" = DEMO-1 OR parent = DEMO-1 ORDER BY priority`, "DEMO-3,DEMO-2,DEMO-4,DEMO-5"},
+		{"project = DEMO ORDER BY created", "DEMO-7,DEMO-1,DEMO-6,DEMO-5,DEMO-3,DEMO-2,DEMO-4,DEMO-8"},
+	}
+	for _, tt := range tests {
+		q, err := parseJQL(tt.jql, s.field, "demo", time.Now())
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.jql, err)
+			continue
+		}
+		var found []issue
+		for _, i := range s.issues {
+			if q.where(i) {
+				found = append(found, i)
+			}
+		}
+		q.sortIssues(found)
+		var got []string
+		for _, i := range found {
+			got = append(got, str(i, "key"))
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.jql, tt.want, strings.Join(got, ","))
+		}
+	}
+
+	for jql, want := range map[string]string{
+		"owner = demo":               "Field 'owner' does not exist",
+		"project = DEMO AND":         "incomplete",
+		"status IN (Open":            "incomplete",
+		`summary ~ "без конца`:       "unterminated",
+		"created > nextSprint()":     "Unable to find JQL function",
+		"summary > a":                "not supported",
+		"project = DEMO ORDER key":   "BY",
+		"project = DEMO ORDER BY x":  "Not able to sort",
+		"project = DEMO project = X": "unexpected",
+	} {
+		if _, err := parseJQL(jql, s.field, "demo", time.Now()); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error with %q, got %v", jql, want, err)
+		}
+	}
+}
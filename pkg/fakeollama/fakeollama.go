@@ -0,0 +1,604 @@
+// Package fakeollama - поддельная Ollama для тестов и локальной разработки без модели.
+// Отвечает на запросы /api/version, /api/tags, /api/show, /api/chat (потоковый и обычный),
+// /api/embed, /api/embeddings и /api/pull предсказуемыми ответами: заготовленными или эхом
+// последнего сообщения пользователя. Задержку и ошибки можно настроить заранее или во время теста.
+package fakeollama
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"jira-go/models"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version - версия, которую отдает /api/version
+const Version = "0.0.0-fake"
+
+// Model - модель, установленная на поддельном сервере
+type Model struct {
+	Name          string `json:"name"`
+	Family        string `json:"family"`
+	ParameterSize string `json:"parameterSize"`
+	Size          int64  `json:"size"`
+	// ContextLength - максимальный контекст модели (model_info.<family>.context_length)
+	ContextLength int `json:"contextLength"`
+	// NumCtx - num_ctx из Modelfile; 0 - не задан, Ollama использует 2048
+	NumCtx int `json:"numCtx"`
+	// Dimensions - размер векторов /api/embed
+	Dimensions int `json:"dimensions"`
+}
+
+// Failure - ошибка, которой сервер отвечает на запросы к пути
+type Failure struct {
+	Status  int
+	Message string
+	// Times - сколько запросов подряд завершатся ошибкой; 0 - все
+	Times int
+	// Every - ошибкой завершается каждый Every-й запрос (для проверки повторов); 0 - каждый
+	Every int
+}
+
+// Options - настройки поддельной Ollama
+type Options struct {
+	// Models - установленные модели; пусто - DefaultModels
+	Models []Model
+	// Replies - заготовленные ответы: если последнее сообщение пользователя содержит ключ
+	// (без учета регистра), модель отвечает значением. Остальные сообщения получают эхо.
+	Replies map[string]string
+	// Reply, если задана, формирует ответ вместо Replies и эха
+	Reply func(model string, messages []models.Message) string
+	// Latency - задержка перед каждым ответом
+	Latency time.Duration
+	// ChunkDelay - пауза между фрагментами потокового ответа
+	ChunkDelay time.Duration
+	// Failures - ошибки по путям, например "/api/chat": {Status: 503}
+	Failures map[string]Failure
+}
+
+// ChatRequest - запрос к /api/chat, сохраненный для проверок в тестах
+type ChatRequest struct {
+	Model    string           `json:"model"`
+	Messages []models.Message `json:"messages"`
+	// Options - параметры генерации из запроса, например temperature
+	Options map[string]interface{} `json:"options"`
+	Stream  bool                   `json:"-"`
+}
+
+// DefaultModels возвращает модели, установленные по умолчанию
+func DefaultModels() []Model {
+	return []Model{
+		{Name: "llama3:8b", Family: "llama", ParameterSize: "8.0B", Size: 4661224676, ContextLength: 8192},
+		{Name: "mistral:7b", Family: "llama", ParameterSize: "7.2B", Size: 4113301824, ContextLength: 32768, NumCtx: 4096},
+		{Name: "nomic-embed-text:latest", Family: "nomic-bert", ParameterSize: "137M", Size: 274302450, ContextLength: 2048, Dimensions: 768},
+	}
+}
+
+// Server - поддельная Ollama; безопасна для одновременных запросов
+type Server struct {
+	mu       sync.Mutex
+	opts     Options
+	models   []Model
+	failures map[string]*failure
+	counts   map[string]int
+	chats    []ChatRequest
+	mux      *http.ServeMux
+}
+
+type failure struct {
+	Failure
+	seen int
+}
+
+// New создает поддельную Ollama
+func New(opts Options) *Server {
+	s := &Server{opts: opts, failures: map[string]*failure{}, counts: map[string]int{}}
+	list := opts.Models
+	if len(list) == 0 {
+		list = DefaultModels()
+	}
+	for _, m := range list {
+		s.models = append(s.models, withDefaults(m))
+	}
+	for path, f := range opts.Failures {
+		s.Fail(path, f)
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("GET /api/version", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"version": Version})
+	})
+	s.mux.HandleFunc("GET /api/tags", s.tags)
+	s.mux.HandleFunc("POST /api/show", s.show)
+	s.mux.HandleFunc("POST /api/chat", s.chat)
+	s.mux.HandleFunc("POST /api/embed", s.embed)
+	s.mux.HandleFunc("POST /api/embeddings", s.embeddings)
+	s.mux.HandleFunc("POST /api/pull", s.pull)
+	return s
+}
+
+// Models разбирает список имен через запятую, например "llama3:8b,phi3": модели из
+// DefaultModels получают свои параметры, остальные - значения по умолчанию
+func Models(names string) []Model {
+	known := map[string]Model{}
+	for _, m := range DefaultModels() {
+		known[m.Name] = m
+	}
+	var list []Model
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if m, ok := known[name]; ok {
+			list = append(list, m)
+		} else {
+			list = append(list, Model{Name: name})
+		}
+	}
+	return list
+}
+
+// Fail задает ошибку для запросов к пути (например, "/api/chat"); Status 0 снимает ее
+func (s *Server) Fail(path string, f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f.Status == 0 {
+		delete(s.failures, path)
+		return
+	}
+	if f.Message == "" {
+		f.Message = http.StatusText(f.Status)
+	}
+	s.failures[path] = &failure{Failure: f}
+}
+
+// SetLatency меняет задержку ответов
+func (s *Server) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opts.Latency = latency
+}
+
+// Requests возвращает число запросов к пути, включая завершившиеся ошибкой
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[path]
+}
+
+// Chats возвращает принятые запросы к /api/chat по порядку
+func (s *Server) Chats() []ChatRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ChatRequest(nil), s.chats...)
+}
+
+// ServeHTTP учитывает запрос, выдерживает задержку и отвечает заданной ошибкой, если она есть
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("fakeollama: %s %s", r.Method, r.URL.Path)
+
+	s.mu.Lock()
+	s.counts[r.URL.Path]++
+	latency := s.opts.Latency
+	failed := s.failed(r.URL.Path)
+	s.mu.Unlock()
+
+	if !sleep(r.Context(), latency) {
+		return
+	}
+	if failed != nil {
+		writeError(w, failed.Status, failed.Message)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// failed решает, должен ли очередной запрос к пути завершиться ошибкой. Вызывается под s.mu.
+func (s *Server) failed(path string) *Failure {
+	f, ok := s.failures[path]
+	if !ok {
+		return nil
+	}
+	f.seen++
+	if f.Every > 1 && f.seen%f.Every != 0 {
+		return nil
+	}
+	result := f.Failure
+	if f.Times > 0 {
+		if f.Times--; f.Times == 0 {
+			delete(s.failures, path)
+		}
+	}
+	return &result
+}
+
+func (s *Server) tags(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []map[string]interface{}{}
+	for _, m := range s.models {
+		list = append(list, map[string]interface{}{
+			"name":        m.Name,
+			"model":       m.Name,
+			"modified_at": "2024-05-01T12:00:00Z",
+			"size":        m.Size,
+			"digest":      fmt.Sprintf("%x", sha256.Sum256([]byte(m.Name))),
+			"details":     details(m),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"models": list})
+}
+
+func (s *Server) show(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model string `json:"model"`
+		Name  string `json:"name"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	m, ok := s.find(first(req.Model, req.Name))
+	if !ok {
+		writeModelNotFound(w, first(req.Model, req.Name))
+		return
+	}
+	parameters := ""
+	if m.NumCtx > 0 {
+		parameters = fmt.Sprintf("num_ctx                        %d", m.NumCtx)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"modelfile":  "FROM " + m.Name,
+		"parameters": parameters,
+		"template":   "{{ .Prompt }}",
+		"details":    details(m),
+		"model_info": map[string]interface{}{
+			"general.architecture":              m.Family,
+			m.Family + ".context_length":        m.ContextLength,
+			m.Family + ".embedding_length":      m.Dimensions,
+			"general.parameter_count_formatted": m.ParameterSize,
+		},
+	})
+}
+
+func (s *Server) chat(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChatRequest
+		Stream *bool `json:"stream"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	// Как и настоящая Ollama, без "stream": false ответ передается потоком
+	req.ChatRequest.Stream = req.Stream == nil || *req.Stream
+
+	s.mu.Lock()
+	s.chats = append(s.chats, req.ChatRequest)
+	delay := s.opts.ChunkDelay
+	s.mu.Unlock()
+
+	if _, ok := s.find(req.Model); !ok {
+		writeModelNotFound(w, req.Model)
+		return
+	}
+	answer := s.reply(req.Model, req.Messages)
+	started := time.Now()
+
+	message := func(content string, done bool) map[string]interface{} {
+		chunk := map[string]interface{}{
+			"model":      req.Model,
+			"created_at": time.Now().UTC().Format(time.RFC3339Nano),
+			"message":    models.Message{Role: "assistant", Content: content},
+			"done":       done,
+		}
+		if done {
+			chunk["done_reason"] = "stop"
+			chunk["total_duration"] = time.Since(started).Nanoseconds()
+			chunk["prompt_eval_count"] = tokens(req.Messages)
+			chunk["eval_count"] = len(strings.Fields(answer))
+		}
+		return chunk
+	}
+
+	if !req.ChatRequest.Stream {
+		writeJSON(w, http.StatusOK, message(answer, true))
+		return
+	}
+	stream := newStream(w)
+	for _, part := range strings.SplitAfter(answer, " ") {
+		if part == "" {
+			continue
+		}
+		if !stream.send(message(part, false)) || !sleep(r.Context(), delay) {
+			return
+		}
+	}
+	stream.send(message("", true))
+}
+
+// reply формирует ответ модели: Reply, заготовка из Replies или эхо
+func (s *Server) reply(model string, messages []models.Message) string {
+	if s.opts.Reply != nil {
+		return s.opts.Reply(model, messages)
+	}
+	last := ""
+	for _, m := range messages {
+		if m.Role == "user" {
+			last = m.Content
+		}
+	}
+	// Ключи перебираются по порядку, чтобы при нескольких совпадениях ответ не менялся
+	keys := make([]string, 0, len(s.opts.Replies))
+	for key := range s.opts.Replies {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if strings.Contains(strings.ToLower(last), strings.ToLower(key)) {
+			return s.opts.Replies[key]
+		}
+	}
+	return fmt.Sprintf("[%s] %s", model, last)
+}
+
+func (s *Server) embed(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model string          `json:"model"`
+		Input json.RawMessage `json:"input"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	// input - строка или массив строк
+	var inputs []string
+	var single string
+	if err := json.Unmarshal(req.Input, &single); err == nil {
+		inputs = []string{single}
+	} else if err := json.Unmarshal(req.Input, &inputs); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid input type")
+		return
+	}
+	m, ok := s.find(req.Model)
+	if !ok {
+		writeModelNotFound(w, req.Model)
+		return
+	}
+	embeddings := [][]float64{}
+	for _, input := range inputs {
+		embeddings = append(embeddings, vector(input, m.Dimensions))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"model":             m.Name,
+		"embeddings":        embeddings,
+		"prompt_eval_count": len(strings.Fields(strings.Join(inputs, " "))),
+	})
+}
+
+// embeddings - устаревший вариант /api/embed с одним текстом в поле prompt
+func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model  string `json:"model"`
+		Prompt string `json:"prompt"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	m, ok := s.find(req.Model)
+	if !ok {
+		writeModelNotFound(w, req.Model)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"embedding": vector(req.Prompt, m.Dimensions)})
+}
+
+// pull "скачивает" модель: передает те же этапы, что и Ollama, и добавляет модель в список
+func (s *Server) pull(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model  string `json:"model"`
+		Name   string `json:"name"`
+		Stream *bool  `json:"stream"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	name := first(req.Model, req.Name)
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "model is required")
+		return
+	}
+	if !strings.Contains(name, ":") {
+		name += ":latest"
+	}
+	m, ok := s.find(name)
+	if !ok {
+		m = withDefaults(Model{Name: name})
+	}
+
+	if req.Stream == nil || *req.Stream {
+		s.mu.Lock()
+		delay := s.opts.ChunkDelay
+		s.mu.Unlock()
+
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(name)))
+		stream := newStream(w)
+		steps := []map[string]interface{}{
+			{"status": "pulling manifest"},
+			{"status": "pulling " + digest[7:19], "digest": digest, "total": m.Size},
+			{"status": "pulling " + digest[7:19], "digest": digest, "total": m.Size, "completed": m.Size / 2},
+			{"status": "pulling " + digest[7:19], "digest": digest, "total": m.Size, "completed": m.Size},
+			{"status": "verifying sha256 digest"},
+			{"status": "writing manifest"},
+		}
+		for _, step := range steps {
+			if !stream.send(step) || !sleep(r.Context(), delay) {
+				return
+			}
+		}
+		s.install(m)
+		stream.send(map[string]string{"status": "success"})
+		return
+	}
+	s.install(m)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func (s *Server) install(m Model) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.models {
+		if existing.Name == m.Name {
+			return
+		}
+	}
+	s.models = append(s.models, m)
+}
+
+// find ищет модель по имени; имя без тега означает :latest, как в Ollama
+func (s *Server) find(name string) (Model, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.models {
+		if m.Name == name || m.Name == name+":latest" {
+			return m, true
+		}
+	}
+	return Model{}, false
+}
+
+func withDefaults(m Model) Model {
+	if m.Family == "" {
+		m.Family = "llama"
+	}
+	if m.ParameterSize == "" {
+		m.ParameterSize = "7B"
+	}
+	if m.Size == 0 {
+		m.Size = 4 << 30
+	}
+	if m.ContextLength == 0 {
+		m.ContextLength = 8192
+	}
+	if m.Dimensions == 0 {
+		m.Dimensions = 8
+	}
+	return m
+}
+
+func details(m Model) map[string]interface{} {
+	return map[string]interface{}{
+		"format":             "gguf",
+		"family":             m.Family,
+		"families":           []string{m.Family},
+		"parameter_size":     m.ParameterSize,
+		"quantization_level": "Q4_0",
+	}
+}
+
+// vector строит единичный вектор, который зависит только от текста: одинаковые тексты
+// получают одинаковые векторы, разные - разные
+func vector(text string, dimensions int) []float64 {
+	h := fnv.New64a()
+	h.Write([]byte(text))
+	seed := h.Sum64()
+	v := make([]float64, dimensions)
+	var norm float64
+	for i := range v {
+		// xorshift дает воспроизводимую последовательность без math/rand
+		seed ^= seed << 13
+		seed ^= seed >> 7
+		seed ^= seed << 17
+		v[i] = float64(seed%2000)/1000 - 1
+		norm += v[i] * v[i]
+	}
+	if norm = math.Sqrt(norm); norm > 0 {
+		for i := range v {
+			v[i] /= norm
+		}
+	}
+	return v
+}
+
+// tokens грубо оценивает размер промпта в токенах - по числу слов
+func tokens(messages []models.Message) int {
+	n := 0
+	for _, m := range messages {
+		n += len(strings.Fields(m.Content))
+	}
+	return n
+}
+
+// sleep ждет d; false - клиент отменил запрос
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// stream пишет ответ построчно в формате application/x-ndjson, как Ollama
+type stream struct {
+	w       http.ResponseWriter
+	encoder *json.Encoder
+}
+
+func newStream(w http.ResponseWriter) *stream {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	return &stream{w: w, encoder: json.NewEncoder(w)}
+}
+
+func (s *stream) send(v interface{}) bool {
+	if err := s.encoder.Encode(v); err != nil {
+		return false
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return true
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError отвечает ошибкой в формате Ollama: {"error": "..."}
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeModelNotFound(w http.ResponseWriter, model string) {
+	writeError(w, http.StatusNotFound, fmt.Sprintf("model \"%s\" not found, try pulling it first", model))
+}
@@ -0,0 +1,217 @@
+package fakeollama
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"jira-go/models"
+	"jira-go/pkg/ollama"
+	"jira-go/pkg/upstream"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func start(t *testing.T, opts Options) (*Server, string) {
+	t.Helper()
+	fake := New(opts)
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server.URL
+}
+
+func ask(content string) []models.Message {
+	return []models.Message{{Role: "system", Content: "Ты помощник"}, {Role: "user", Content: content}}
+}
+
+// Клиент Ollama работает с поддельным сервером так же, как с настоящим
+func TestClient(t *testing.T) {
+	fake, url := start(t, Options{Replies: map[string]string{"сертификат": "Обновите отпечаток сертификата IdP."}})
+
+	if version, err := ollama.GetVersion(url); err != nil || version != Version {
+		t.Errorf("unexpected version %q: %v", version, err)
+	}
+	list, err := ollama.GetOllamaModels(url)
+	if err != nil || len(list) != 3 || list[0]["name"] != "llama3:8b" {
+		t.Fatalf("unexpected models %v: %v", list, err)
+	}
+
+	info, err := ollama.ShowModel(url, "mistral:7b")
+	if err != nil || info.NumCtx != 4096 || info.ContextLength != 32768 {
+		t.Errorf("unexpected model info %+v: %v", info, err)
+	}
+	if info, _ := ollama.ShowModel(url, "llama3:8b"); info.NumCtx != ollama.DefaultNumCtx {
+		t.Errorf("expected default num_ctx without parameters, got %d", info.NumCtx)
+	}
+
+	answer, err := ollama.SendOllamaMessage(url, "llama3:8b", ask("Что сломалось после обновления СЕРТИФИКАТА?"))
+	if err != nil || answer != "Обновите отпечаток сертификата IdP." {
+		t.Errorf("expected canned reply, got %q: %v", answer, err)
+	}
+	answer, err = ollama.SendOllamaMessage(url, "llama3:8b", ask("Оцени задачу"))
+	if err != nil || answer != "[llama3:8b] Оцени задачу" {
+		t.Errorf("expected echo, got %q: %v", answer, err)
+	}
+
+	var chunks []string
+	answer, err = ollama.StreamOllamaMessage(url, "mistral:7b", ask("раз два три"), func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil || answer != "[mistral:7b] раз два три" || len(chunks) != 4 {
+		t.Errorf("unexpected stream %q in %d chunks: %v", answer, len(chunks), err)
+	}
+
+	_, err = ollama.SendOllamaMessage(url, "phi3", ask("привет"))
+	if !errors.Is(err, upstream.ErrModelNotFound) {
+		t.Errorf("expected ErrModelNotFound, got %v", err)
+	}
+
+	chats := fake.Chats()
+	if len(chats) != 4 || chats[1].Messages[1].Content != "Оцени задачу" || chats[1].Stream || !chats[2].Stream {
+		t.Errorf("unexpected recorded chats %+v", chats)
+	}
+	if n := fake.Requests("/api/chat"); n != 4 {
+		t.Errorf("expected 4 chat requests, got %d", n)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	fake, url := start(t, Options{Failures: map[string]Failure{"/api/tags": {Status: http.StatusServiceUnavailable, Times: 1}}})
+
+	var e *upstream.Error
+	if _, err := ollama.GetOllamaModels(url); !errors.As(err, &e) || e.Status != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %v", err)
+	}
+	if _, err := ollama.GetOllamaModels(url); err != nil {
+		t.Errorf("failure should be used once, got %v", err)
+	}
+
+	fake.Fail("/api/chat", Failure{Status: http.StatusInternalServerError, Message: "CUDA out of memory", Every: 2})
+	var failed int
+	for i := 0; i < 4; i++ {
+		if _, err := ollama.SendOllamaMessage(url, "llama3:8b", ask("вопрос")); err != nil {
+			if !strings.Contains(err.Error(), "CUDA out of memory") {
+				t.Errorf("unexpected error %v", err)
+			}
+			failed++
+		}
+	}
+	if failed != 2 {
+		t.Errorf("expected every second request to fail, got %d of 4", failed)
+	}
+	fake.Fail("/api/chat", Failure{})
+	if _, err := ollama.SendOllamaMessage(url, "llama3:8b", ask("вопрос")); err != nil {
+		t.Errorf("failure should be removed, got %v", err)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	fake, url := start(t, Options{})
+	fake.SetLatency(200 * time.Millisecond)
+
+	ollama.SetTimeout(50 * time.Millisecond)
+	defer ollama.SetTimeout(5 * time.Minute)
+	if _, err := ollama.GetVersion(url); !errors.Is(err, upstream.ErrUpstreamUnavailable) {
+		t.Errorf("expected timeout, got %v", err)
+	}
+
+	fake.SetLatency(0)
+	if _, err := ollama.GetVersion(url); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// Пул переключается на другой сервер, если первый отвечает ошибкой
+func TestPoolFailover(t *testing.T) {
+	broken, brokenURL := start(t, Options{Failures: map[string]Failure{"/api/chat": {Status: http.StatusBadGateway}}})
+	_, workingURL := start(t, Options{Reply: func(model string, messages []models.Message) string { return "ok" }})
+
+	pool := ollama.NewPool([]ollama.Endpoint{{Name: "broken", URL: brokenURL}, {Name: "working", URL: workingURL}})
+	pool.Refresh()
+	for i := 0; i < 2; i++ {
+		if answer, err := pool.Chat("llama3:8b", ask("вопрос")); err != nil || answer != "ok" {
+			t.Fatalf("unexpected answer %q: %v", answer, err)
+		}
+	}
+	if broken.Requests("/api/chat") == 0 {
+		t.Error("expected the broken server to be tried")
+	}
+}
+
+func post(t *testing.T, url, body string) *http.Response {
+	t.Helper()
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestEmbed(t *testing.T) {
+	_, url := start(t, Options{})
+
+	var result struct {
+		Embeddings [][]float64 `json:"embeddings"`
+	}
+	resp := post(t, url+"/api/embed", `{"model": "nomic-embed-text", "input": ["вход через SSO", "вход через SSO", "выгрузка в Excel"]}`)
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected response %d: %v", resp.StatusCode, err)
+	}
+	if len(result.Embeddings) != 3 || len(result.Embeddings[0]) != 768 {
+		t.Fatalf("unexpected embeddings size %d", len(result.Embeddings))
+	}
+	var norm float64
+	for i, v := range result.Embeddings[0] {
+		norm += v * v
+		if v != result.Embeddings[1][i] {
+			t.Fatal("same text should give the same vector")
+		}
+	}
+	if math.Abs(norm-1) > 1e-9 || result.Embeddings[0][0] == result.Embeddings[2][0] {
+		t.Errorf("expected different unit vectors, norm %f", norm)
+	}
+
+	var single struct {
+		Embeddings [][]float64 `json:"embeddings"`
+	}
+	json.NewDecoder(post(t, url+"/api/embed", `{"model": "llama3:8b", "input": "текст"}`).Body).Decode(&single)
+	if len(single.Embeddings) != 1 || len(single.Embeddings[0]) != 8 {
+		t.Errorf("unexpected single embedding %v", single.Embeddings)
+	}
+	if resp := post(t, url+"/api/embed", `{"model": "bge-m3", "input": "текст"}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown model, got %d", resp.StatusCode)
+	}
+}
+
+func TestPull(t *testing.T) {
+	_, url := start(t, Options{Models: Models("llama3:8b")})
+
+	resp := post(t, url+"/api/pull", `{"model": "phi3"}`)
+	var statuses []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var line struct {
+			Status string `json:"status"`
+		}
+		json.Unmarshal(scanner.Bytes(), &line)
+		statuses = append(statuses, line.Status)
+	}
+	if len(statuses) != 7 || statuses[0] != "pulling manifest" || statuses[6] != "success" {
+		t.Errorf("unexpected pull progress %v", statuses)
+	}
+
+	if resp := post(t, url+"/api/pull", `{"name": "mistral:7b", "stream": false}`); resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	list, err := ollama.GetOllamaModels(url)
+	if err != nil || len(list) != 3 || list[1]["name"] != "phi3:latest" {
+		t.Errorf("pulled models are not installed: %v %v", list, err)
+	}
+	if answer, err := ollama.SendOllamaMessage(url, "phi3", ask("привет")); err != nil || answer != "[phi3] привет" {
+		t.Errorf("pulled model does not answer: %q %v", answer, err)
+	}
+}
@@ -1,104 +1,184 @@
 package handlers
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
 	"jira-go/models"
+	"jira-go/pkg/jira"
 	"jira-go/pkg/ollama"
+	"jira-go/pkg/prompt"
+	"jira-go/pkg/summarize"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func modelsHandler(w http.ResponseWriter, r *http.Request) {
-	models, err := ollama.GetOllamaModels(configObj.OllamaHost)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+// modelsHandler отдает объединенный список моделей со всех серверов Ollama;
+// в поле hosts каждой модели указано, на каких серверах она есть
+func (s *Server) modelsHandler(w http.ResponseWriter, r *http.Request) {
+	models, apiErr := s.listModels(r)
+	if apiErr != nil {
+		writeError(w, apiErr)
 		return
 	}
-
-	mu.Lock()
-	appData.Models = models
-	mu.Unlock()
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(models)
 }
 
-func sendAIHandler(w http.ResponseWriter, r *http.Request) {
+// listModels заново опрашивает серверы Ollama и возвращает список моделей
+func (s *Server) listModels(r *http.Request) ([]map[string]interface{}, *APIError) {
+	s.ollamaPool.Refresh()
+	models := s.ollamaPool.Models()
+	if len(models) == 0 {
+		return nil, apiError(http.StatusBadGateway, CodeUpstreamUnavailable, "Нет доступных серверов Ollama с моделями")
+	}
+
+	s.mu.Lock()
+	s.setModels(models)
+	s.mu.Unlock()
+	return models, nil
+}
+
+// maxTemperature - верхняя граница температуры генерации, которую принимает API
+const maxTemperature = 2
+
+// ChatRequest - вопрос к модели; с TaskKey к вопросу добавляется контекст задачи
+type ChatRequest struct {
+	// Model - модель для этого запроса; если не задана, используется выбранная пользователем
+	Model   string `json:"model"`
+	Message string `json:"message"`
+	// Temperature передается в Ollama; если не задана, берется из Modelfile модели
+	Temperature *float64 `json:"temperature,omitempty"`
+	TaskKey     string   `json:"taskKey,omitempty"`
+	Instance    string   `json:"instance,omitempty"`
+}
+
+// ChatResult - ответ модели и отчет о том, как собран контекст задачи
+type ChatResult struct {
+	Answer  string         `json:"answer"`
+	Model   string         `json:"model"`
+	TaskKey string         `json:"taskKey"`
+	TaskRef string         `json:"taskRef"`
+	Context *prompt.Report `json:"context"`
+}
+
+func (s *Server) sendAIHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Читаем тело запроса для логирования
-	bodyBytes, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Ошибка чтения тела запроса", http.StatusBadRequest)
+	var formData struct {
+		Model       string   `json:"model"`
+		Messages    string   `json:"messages"`
+		Temperature *float64 `json:"temperature,omitempty"`
+		TaskKey     string   `json:"taskKey,omitempty"`
+		Instance    string   `json:"instance,omitempty"`
+	}
+	if !decodeJSON(w, r, &formData) {
 		return
 	}
-	defer r.Body.Close()
 
-	// Логируем сырое тело запроса
-	log.Printf("Raw request body: %s", string(bodyBytes))
+	result, apiErr := s.chatWithModel(r, ChatRequest{
+		Model:       formData.Model,
+		Message:     formData.Messages,
+		Temperature: formData.Temperature,
+		TaskKey:     formData.TaskKey,
+		Instance:    formData.Instance,
+	})
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
 
-	// Восстанавливаем тело для декодирования
-	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"answer":  result.Answer,
+		"taskKey": result.TaskKey,
+		"taskRef": result.TaskRef,
+		"context": result.Context,
+	})
+}
 
-	var formData struct {
-		Model       string  `json:"model"`
-		Messages    string  `json:"messages"`
-		Temperature float64 `json:"temperature,omitempty,string"`
-		TaskKey     string  `json:"taskKey,omitempty"`
+// chatWithModel отправляет вопрос модели из запроса или выбранной пользователем, добавляя
+// контекст задачи в пределах окна модели. Выбор модели пользователя запрос не меняет.
+func (s *Server) chatWithModel(r *http.Request, req ChatRequest) (*ChatResult, *APIError) {
+	temperature := "default"
+	if req.Temperature != nil {
+		temperature = strconv.FormatFloat(*req.Temperature, 'f', -1, 64)
 	}
+	// Текст промпта может содержать конфиденциальные данные, поэтому в журнал он попадает только в режиме debug
+	log.Printf("Запрос к модели: Model=%s, Messages=%s, Temperature=%s, TaskKey=%s, Instance=%s",
+		req.Model, s.redact(req.Message), temperature, req.TaskKey, req.Instance)
 
-	if err := json.NewDecoder(r.Body).Decode(&formData); err != nil {
-		log.Printf("JSON parsing error: %v", err)
-		log.Printf("Request body that caused error: %s", string(bodyBytes))
-		http.Error(w, "Ошибка parsing JSON: "+err.Error(), http.StatusBadRequest)
-		return
+	if req.Message == "" {
+		return nil, apiError(http.StatusBadRequest, CodeBadRequest, "Сообщение обязательно")
+	}
+	if req.Temperature != nil && (*req.Temperature < 0 || *req.Temperature > maxTemperature) {
+		return nil, apiError(http.StatusBadRequest, CodeBadRequest, "Температура должна быть от 0 до 2")
+	}
+	req.TaskKey = strings.ToUpper(strings.TrimSpace(req.TaskKey))
+	if req.TaskKey != "" && !jira.ValidIssueKey(req.TaskKey) {
+		return nil, apiError(http.StatusBadRequest, CodeBadRequest, "Неверный ключ задачи, ожидается вид PROJ-123")
 	}
 
-	// Закрываем тело после чтения
-	r.Body.Close()
-
-	log.Printf("Parsed data: Model=%s, Messages=%s, Temperature=%f, TaskKey=%s",
-		formData.Model, formData.Messages, formData.Temperature, formData.TaskKey)
+	model := strings.TrimSpace(req.Model)
+	s.mu.RLock()
+	if model == "" {
+		model = s.userModel(userID(r))
+	} else if len(s.appData.Models) > 0 && !knownModel(s.appData.Models, model) {
+		s.mu.RUnlock()
+		return nil, apiError(http.StatusBadRequest, CodeUnknownModel, "Неизвестная модель: "+model)
+	}
+	s.mu.RUnlock()
+	if model == "" {
+		return nil, apiError(http.StatusBadRequest, CodeModelRequired, "Модель не выбрана")
+	}
 
-	if formData.Messages == "" {
-		http.Error(w, "Сообщение обязательно", http.StatusBadRequest)
-		return
+	ctx, apiErr := s.aiContext(r)
+	if apiErr != nil {
+		return nil, apiErr
 	}
 
-	if appData.SelectedModel == "" {
-		if formData.Model != "" {
-			appData.SelectedModel = formData.Model
+	// Если есть ключ задачи, добавляем контекст задачи в пределах окна модели
+	result := &ChatResult{Model: model, TaskKey: req.TaskKey}
+	fullMessage := req.Message
+	if req.TaskKey != "" {
+		instance, err := s.jiraInstance(r, req.Instance)
+		if err != nil {
+			return nil, jiraInstanceError(err)
+		}
+		result.TaskRef = jira.TaskRef(instance.Name, req.TaskKey)
+
+		// В списке задач нет комментариев и связей, поэтому запрашиваем задачу целиком
+		task, ok := s.findTask(userID(r), result.TaskRef)
+		if full, err := s.getIssue(userID(r), instance, req.TaskKey); err == nil {
+			task = *full
+		} else if ok {
+			log.Printf("Не удалось получить задачу %s целиком, используем данные из списка: %v", result.TaskRef, err)
 		} else {
-			http.Error(w, "Модель не выбрана", http.StatusBadRequest)
-			return
+			return nil, jiraError("Ошибка получения задачи "+result.TaskRef, err)
 		}
 
-	}
+		// Не поместившиеся в окно разделы сжимаются отдельными запросами к той же модели
+		numCtx := s.modelNumCtx(model)
+		builder := prompt.NewBuilder(numCtx)
+		builder.Summarize = summarize.NewWithChat(func(messages []models.Message) (string, error) {
+			return s.ollamaPool.ChatContext(ctx, model, messages)
+		}, numCtx).Summarize
 
-	// Если есть ключ задачи, добавляем информацию о задаче
-	var fullMessage string
-	if formData.TaskKey != "" {
-		// Находим задачу в кэше
-		var taskInfo string
-		mu.RLock()
-		for _, task := range appData.Tasks {
-			if task.Key == formData.TaskKey {
-				taskInfo = fmt.Sprintf("Задача: %s\nОписание: %s\n",
-					task.Fields.Summary, task.Fields.Description)
-				break
-			}
+		message, report := builder.Build(req.Message, prompt.TaskSections(task))
+		if len(report.Summarized) > 0 {
+			log.Printf("Разделы задачи %s сжаты для контекста: %v", result.TaskRef, report.Summarized)
 		}
-		mu.RUnlock()
-
-		fullMessage = formData.Messages + "\n\n" + taskInfo
-	} else {
-		fullMessage = formData.Messages
+		if len(report.Dropped) > 0 {
+			log.Printf("В контекст задачи %s не поместились разделы: %v", result.TaskRef, report.Dropped)
+		}
+		fullMessage = message
+		result.Context = &report
 	}
 
 	mess := []models.Message{
@@ -108,49 +188,142 @@ func sendAIHandler(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	response, err := ollama.SendOllamaMessage(configObj.OllamaHost, appData.SelectedModel, mess)
+	response, err := s.ollamaPool.ChatWith(ctx, model, mess, ollama.ChatOptions{Temperature: req.Temperature})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, ollamaError(err)
 	}
+	result.Answer = response
+	if result.TaskRef != "" {
+		s.rememberAnswer(userID(r), result.TaskRef, taskAnswer{Model: model, Question: req.Message, Answer: response, AnsweredAt: time.Now()})
+	}
+	return result, nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"answer":  response,
-		"taskKey": formData.TaskKey,
-	})
+// findTask ищет задачу в последнем списке задач пользователя по ключу вида instance/KEY
+func (s *Server) findTask(user, taskRef string) (jira.JiraTask, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, task := range s.appData.Tasks[user] {
+		if task.Ref() == taskRef {
+			return task, true
+		}
+	}
+	return jira.JiraTask{}, false
 }
 
-// Обновление моделей
-func RefreshModels() error {
-	models, err := ollama.GetOllamaModels(configObj.OllamaHost)
+// modelNumCtx возвращает окно контекста модели, кэшируя ответы /api/show
+func (s *Server) modelNumCtx(model string) int {
+	s.mu.RLock()
+	numCtx, ok := s.appData.NumCtx[model]
+	s.mu.RUnlock()
+	if ok {
+		return numCtx
+	}
+
+	info, err := s.ollamaPool.ShowModel(model)
 	if err != nil {
-		return err
+		log.Printf("Не удалось получить параметры модели %s, используем контекст по умолчанию: %v", model, err)
+		return ollama.DefaultNumCtx
 	}
 
-	mu.Lock()
-	appData.Models = models
-	mu.Unlock()
+	s.mu.Lock()
+	s.appData.NumCtx[model] = info.NumCtx
+	s.mu.Unlock()
+	return info.NumCtx
+}
+
+// setModels заменяет список моделей и сбрасывает кэш окон контекста: модель могла быть
+// перекачана с другим Modelfile или оказаться на других серверах. Вызывается под s.mu.
+func (s *Server) setModels(models []map[string]interface{}) {
+	s.appData.Models = models
+	s.appData.NumCtx = map[string]int{}
+}
+
+// Обновление моделей
+func (s *Server) RefreshModels() error {
+	s.ollamaPool.Refresh()
+	models := s.ollamaPool.Models()
+	if len(models) == 0 {
+		return fmt.Errorf("нет доступных серверов Ollama с моделями")
+	}
+
+	s.mu.Lock()
+	s.setModels(models)
+	s.mu.Unlock()
 
 	log.Printf("Обновление моделей: %d моделей загружено", len(models))
 	return nil
 }
 
-func selectModelHandler(w http.ResponseWriter, r *http.Request) {
+// ollamaHostsHandler отдает состояние серверов Ollama по результатам последней проверки
+func (s *Server) ollamaHostsHandler(w http.ResponseWriter, r *http.Request) {
+	hosts, _ := s.ollamaHosts(r)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hosts)
+}
+
+func (s *Server) ollamaHosts(r *http.Request) ([]ollama.HostStatus, *APIError) {
+	return s.ollamaPool.Status(), nil
+}
+
+// ModelSelection - модель, выбранная для запросов из интерфейса
+type ModelSelection struct {
+	Model string `json:"model"`
+}
+
+func (s *Server) selectModelHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	modelName := r.FormValue("model")
-	mu.Lock()
-	appData.SelectedModel = modelName
-	mu.Unlock()
+	selection, apiErr := s.selectModel(r, r.FormValue("model"))
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
-		"model":   modelName,
+		"model":   selection.Model,
 	})
 }
+
+// selectModel выбирает модель для вошедшего пользователя; пустое имя сбрасывает выбор
+func (s *Server) selectModel(r *http.Request, name string) (ModelSelection, *APIError) {
+	name = strings.TrimSpace(name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name != "" && len(s.appData.Models) > 0 && !knownModel(s.appData.Models, name) {
+		return ModelSelection{}, apiError(http.StatusBadRequest, CodeUnknownModel, "Неизвестная модель: "+name)
+	}
+	s.appData.SelectedModels[userID(r)] = name
+	return ModelSelection{Model: name}, nil
+}
+
+func (s *Server) selectedModel(r *http.Request) (ModelSelection, *APIError) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return ModelSelection{Model: s.userModel(userID(r))}, nil
+}
+
+// userModel возвращает модель, выбранную пользователем, или модель по умолчанию.
+// Вызывается под s.mu.
+func (s *Server) userModel(user string) string {
+	if model, ok := s.appData.SelectedModels[user]; ok {
+		return model
+	}
+	return s.cfg.Load().DefaultModel
+}
+
+// knownModel сообщает, есть ли модель в списке, полученном от серверов Ollama
+func knownModel(models []map[string]interface{}, name string) bool {
+	for _, m := range models {
+		if m["name"] == name {
+			return true
+		}
+	}
+	return false
+}
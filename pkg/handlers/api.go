@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	_ "embed"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Коды ошибок API: по ним клиент решает, что делать, текст сообщения - для людей
+const (
+	CodeBadRequest          = "bad_request"
+	CodeInvalidJSON         = "invalid_json"
+	CodeUnsupportedMedia    = "unsupported_media_type"
+	CodeTooLarge            = "payload_too_large"
+	CodeMethodNotAllowed    = "method_not_allowed"
+	CodeNotFound            = "not_found"
+	CodeUnknownInstance     = "unknown_instance"
+	CodeNoJiraToken         = "no_jira_token"
+	CodeModelRequired       = "model_required"
+	CodeUnknownModel        = "unknown_model"
+	CodeRateLimited         = "rate_limited"
+	CodeJiraUnauthorized    = "jira_unauthorized"
+	CodeJiraBadRequest      = "jira_bad_request"
+	CodeUpstreamUnavailable = "upstream_unavailable"
+	CodeJira                = "jira_error"
+	CodeOllama              = "ollama_error"
+	CodeInternal            = "internal_error"
+)
+
+// APIError - ошибка запроса: HTTP-статус, код, сообщение и подробности (например, текст
+// ошибки разбора JSON или ответ Jira)
+type APIError struct {
+	Status  int         `json:"-"`
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+	// RetryAfter - через сколько повторить запрос, для ответа 429
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+func apiError(status int, code, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+// withDetails добавляет подробности к ошибке
+func (e *APIError) withDetails(details interface{}) *APIError {
+	e.Details = details
+	return e
+}
+
+// writeError отвечает на запросы к прежним адресам: текст ошибки, как раньше отдавал http.Error
+func writeError(w http.ResponseWriter, e *APIError) {
+	setRetryAfter(w, e)
+	message := e.Message
+	if details, ok := e.Details.(string); ok && details != "" {
+		message += ": " + details
+	}
+	http.Error(w, message, e.Status)
+}
+
+// writeAPIError отвечает ошибкой в конверте API: {"error": {"code", "message", "details"}}
+func writeAPIError(w http.ResponseWriter, e *APIError) {
+	setRetryAfter(w, e)
+	writeJSON(w, e.Status, map[string]interface{}{"error": e})
+}
+
+// writeAPI отвечает данными в конверте API: {"data": ...}
+func writeAPI(w http.ResponseWriter, data interface{}) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": data})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func setRetryAfter(w http.ResponseWriter, e *APIError) {
+	if e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+	}
+}
+
+// apiGet - обработчик /api/v1 без тела запроса
+func apiGet[Resp any](op func(r *http.Request) (Resp, *APIError)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := op(r)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		writeAPI(w, data)
+	}
+}
+
+// apiPost - обработчик /api/v1 с JSON-телом запроса
+func apiPost[Req, Resp any](op func(r *http.Request, req Req) (Resp, *APIError)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req Req
+		if err := readJSON(r, &req); err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		data, err := op(r, req)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		writeAPI(w, data)
+	}
+}
+
+// byMethod выбирает обработчик по методу запроса; на остальные методы отвечает 405
+func byMethod(handlers map[string]http.HandlerFunc) http.HandlerFunc {
+	allowed := make([]string, 0, len(handlers))
+	for method := range handlers {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if handler, ok := handlers[r.Method]; ok {
+			handler(w, r)
+			return
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeAPIError(w, errMethodNotAllowed())
+	}
+}
+
+func errMethodNotAllowed() *APIError {
+	return apiError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Метод не поддерживается")
+}
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// registerAPI регистрирует версию 1 API. Прежние адреса (/get-tasks, /send-to-ai и т.д.)
+// работают через те же операции и отвечают в старом формате.
+func (s *Server) registerAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/openapi.json", byMethod(map[string]http.HandlerFunc{
+		http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(openAPISpec)
+		},
+	}))
+	mux.HandleFunc("/api/v1/tasks", byMethod(map[string]http.HandlerFunc{
+		http.MethodGet:  apiGet(s.currentTasks),
+		http.MethodPost: apiPost(s.loadTasks),
+	}))
+	mux.HandleFunc("/api/v1/chat", byMethod(map[string]http.HandlerFunc{
+		http.MethodPost: apiPost(s.chatWithModel),
+	}))
+	mux.HandleFunc("/api/v1/models", byMethod(map[string]http.HandlerFunc{
+		http.MethodGet: apiGet(s.listModels),
+	}))
+	mux.HandleFunc("/api/v1/model", byMethod(map[string]http.HandlerFunc{
+		http.MethodGet: apiGet(s.selectedModel),
+		http.MethodPost: apiPost(func(r *http.Request, req ModelSelection) (ModelSelection, *APIError) {
+			return s.selectModel(r, req.Model)
+		}),
+	}))
+	mux.HandleFunc("/api/v1/ollama/hosts", byMethod(map[string]http.HandlerFunc{
+		http.MethodGet: apiGet(s.ollamaHosts),
+	}))
+	mux.HandleFunc("/api/v1/queue", byMethod(map[string]http.HandlerFunc{
+		http.MethodGet: apiGet(s.queueStatus),
+	}))
+	mux.HandleFunc("/api/v1/release-notes", byMethod(map[string]http.HandlerFunc{
+		http.MethodPost: apiPost(s.releaseNotes),
+	}))
+	mux.HandleFunc("/api/v1/epic-report", byMethod(map[string]http.HandlerFunc{
+		http.MethodPost: apiPost(s.epicReport),
+	}))
+	mux.HandleFunc("/api/v1/export", byMethod(map[string]http.HandlerFunc{
+		http.MethodGet: s.exportHandler,
+	}))
+	mux.HandleFunc("/api/v1/jira-tokens", byMethod(map[string]http.HandlerFunc{
+		http.MethodGet:  apiGet(s.jiraTokens),
+		http.MethodPost: apiPost(s.setJiraToken),
+		http.MethodDelete: func(w http.ResponseWriter, r *http.Request) {
+			if err := s.deleteJiraToken(r, r.URL.Query().Get("instance")); err != nil {
+				writeAPIError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		},
+	}))
+	mux.HandleFunc("/api/v1/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, apiError(http.StatusNotFound, CodeNotFound, "Неизвестный адрес API: "+r.URL.Path))
+	})
+}
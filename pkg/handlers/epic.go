@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"jira-go/pkg/auth"
+	"jira-go/pkg/epic"
+	"jira-go/pkg/jira"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// epicPageHandler отдает страницу сводки по эпику
+func (s *Server) epicPageHandler(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	data := struct {
+		SelectedModel string
+		JiraInstances []string
+		User          string
+		CSRFToken     string
+	}{s.userModel(userID(r)), s.cfg.Load().JiraNames(), currentUser(r), auth.CSRFToken(r.Context())}
+	s.mu.RUnlock()
+
+	if err := s.tmpl.Load().ExecuteTemplate(w, "epic.html", data); err != nil {
+		log.Printf("Ошибка выполнения шаблона: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// EpicReportRequest - запрос сводки по эпику
+type EpicReportRequest struct {
+	EpicKey  string `json:"epicKey"`
+	Model    string `json:"model"`
+	Instance string `json:"instance"`
+}
+
+/**
+* Handles the epic roll-up report.
+* Accepts a POST request with a JSON payload containing the epic key,
+* fetches the epic and all of its child issues from Jira, computes progress,
+* blockers, stale items and scope creep, and asks the model for a status summary.
+*
+* @param w The HTTP response writer.
+* @param r The HTTP request object.
+ */
+func (s *Server) epicReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var formData EpicReportRequest
+	if !decodeJSON(w, r, &formData) {
+		return
+	}
+
+	report, apiErr := s.epicReport(r, formData)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"report":  report,
+	})
+}
+
+// epicReport получает эпик и все его задачи, считает прогресс, блокеры, зависшие задачи
+// и расширение объема и просит модель составить сводку
+func (s *Server) epicReport(r *http.Request, req EpicReportRequest) (*epic.Report, *APIError) {
+	req.EpicKey = strings.ToUpper(strings.TrimSpace(req.EpicKey))
+	if !jira.ValidIssueKey(req.EpicKey) {
+		return nil, apiError(http.StatusBadRequest, CodeBadRequest, "Неверный ключ эпика, ожидается вид PROJ-123")
+	}
+
+	model := req.Model
+	if model == "" {
+		s.mu.RLock()
+		model = s.userModel(userID(r))
+		s.mu.RUnlock()
+	}
+	if model == "" {
+		return nil, apiError(http.StatusBadRequest, CodeModelRequired, "Модель не выбрана")
+	}
+
+	ctx, apiErr := s.aiContext(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	instance, err := s.jiraInstance(r, req.Instance)
+	if err != nil {
+		return nil, jiraInstanceError(err)
+	}
+
+	epicTask, err := s.taskSource(instance).Issue(req.EpicKey)
+	if err != nil {
+		return nil, jiraError("Ошибка получения эпика "+req.EpicKey, err)
+	}
+
+	children, err := s.taskSource(instance).EpicChildren(req.EpicKey)
+	if err != nil {
+		return nil, jiraError("Ошибка получения задач эпика", err)
+	}
+	if len(children) == 0 {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "У эпика "+req.EpicKey+" нет задач")
+	}
+
+	var report *epic.Report
+	err = s.ollamaPool.DoContext(ctx, model, func(OllamaHost string) error {
+		var err error
+		report, err = epic.Generate(ctx, OllamaHost, model, *epicTask, children)
+		return err
+	})
+	if err != nil {
+		log.Printf("Ошибка формирования сводки по эпику: %v", err)
+		return nil, ollamaError(err)
+	}
+
+	log.Printf("Сводка по эпику %s: %d задач, прогресс %d%%", req.EpicKey, report.Total, report.Progress)
+	return report, nil
+}
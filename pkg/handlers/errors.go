@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"jira-go/pkg/limiter"
+	"jira-go/pkg/upstream"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// jiraError переводит ошибку запроса к Jira в ответ API. action - что не удалось сделать,
+// например "Ошибка получения задач"; сообщения Jira (errorMessages) попадают в details.
+func jiraError(action string, err error) *APIError {
+	log.Printf("%s: %v", action, err)
+	var e *APIError
+	switch {
+	case errors.Is(err, upstream.ErrUnauthorized):
+		// 403, а не 401: на 401 страница считает, что закончилась сессия входа
+		e = apiError(http.StatusForbidden, CodeJiraUnauthorized, action+": Jira не приняла токен или у него нет прав")
+	case errors.Is(err, upstream.ErrNotFound):
+		e = apiError(http.StatusNotFound, CodeNotFound, action+": не найдено в Jira")
+	case errors.Is(err, upstream.ErrBadRequest):
+		e = apiError(http.StatusBadRequest, CodeJiraBadRequest, action+": Jira отклонила запрос")
+	case errors.Is(err, upstream.ErrRateLimited):
+		e = apiError(http.StatusTooManyRequests, CodeRateLimited, action+": Jira ограничила частоту запросов, повторите позже")
+	case errors.Is(err, upstream.ErrUpstreamUnavailable):
+		e = apiError(http.StatusBadGateway, CodeUpstreamUnavailable, action+": Jira недоступна")
+	default:
+		if _, ok := upstream.As(err); ok {
+			e = apiError(http.StatusBadGateway, CodeJira, action)
+		} else {
+			e = apiError(http.StatusInternalServerError, CodeJira, action)
+		}
+	}
+	return e.withUpstream(err)
+}
+
+// ollamaError переводит ошибку Ollama в ответ: 429 с Retry-After, если запрос не дождался
+// места в очереди, 404, если модели нет на серверах, 502, если серверы недоступны
+func ollamaError(err error) *APIError {
+	var busy *limiter.BusyError
+	if errors.As(err, &busy) {
+		e := apiError(http.StatusTooManyRequests, CodeRateLimited, busy.Error())
+		e.RetryAfter = busy.RetryAfter
+		return e
+	}
+
+	var e *APIError
+	switch {
+	case errors.Is(err, upstream.ErrModelNotFound):
+		e = apiError(http.StatusNotFound, CodeUnknownModel, "Модель не найдена на серверах Ollama")
+	case errors.Is(err, upstream.ErrRateLimited):
+		e = apiError(http.StatusTooManyRequests, CodeRateLimited, "Ollama ограничила частоту запросов, повторите позже")
+	case errors.Is(err, upstream.ErrUpstreamUnavailable):
+		e = apiError(http.StatusBadGateway, CodeUpstreamUnavailable, "Серверы Ollama недоступны")
+	default:
+		e = apiError(http.StatusInternalServerError, CodeOllama, "Ошибка запроса к модели")
+	}
+	return e.withUpstream(err)
+}
+
+// withUpstream добавляет в подробности сообщения внешнего сервиса (или текст ошибки)
+// и срок повтора из его ответа 429
+func (e *APIError) withUpstream(err error) *APIError {
+	u, ok := upstream.As(err)
+	if !ok {
+		return e.withDetails(err.Error())
+	}
+	if e.RetryAfter == 0 {
+		e.RetryAfter = u.RetryAfter
+	}
+	if len(u.Messages) > 0 {
+		return e.withDetails(strings.Join(u.Messages, "; "))
+	}
+	return e.withDetails(err.Error())
+}
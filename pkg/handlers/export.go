@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bytes"
+	"jira-go/models"
+	"jira-go/pkg/export"
+	"jira-go/pkg/jira"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportHandler выгружает текущий список задач пользователя вместе с ответами модели:
+// GET /api/v1/export?format=csv|md|xlsx&columns=key,summary,answer
+func (s *Server) exportHandler(w http.ResponseWriter, r *http.Request) {
+	format, err := export.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		writeAPIError(w, apiError(http.StatusBadRequest, CodeBadRequest, "Неверный формат выгрузки").withDetails(err.Error()))
+		return
+	}
+	columns, err := export.ParseColumns(r.URL.Query().Get("columns"))
+	if err != nil {
+		writeAPIError(w, apiError(http.StatusBadRequest, CodeBadRequest, "Неверный список столбцов").withDetails(err.Error()))
+		return
+	}
+
+	items := s.exportItems(userID(r))
+	// Файл собирается в памяти, чтобы при ошибке еще можно было ответить ошибкой API
+	var buf bytes.Buffer
+	if err := export.Write(&buf, format, columns, items); err != nil {
+		log.Printf("Ошибка выгрузки задач: %v", err)
+		writeAPIError(w, apiError(http.StatusInternalServerError, CodeInternal, "Ошибка выгрузки задач"))
+		return
+	}
+
+	name := export.FileName(items, format, time.Now())
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
+
+// exportItems собирает текущий список задач пользователя с последними ответами модели
+func (s *Server) exportItems(user string) []export.Item {
+	cfg := s.cfg.Load()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tasks := s.appData.Tasks[user]
+	answers := s.appData.Answers[user]
+	items := make([]export.Item, 0, len(tasks))
+	for _, task := range tasks {
+		item := export.Item{Task: task}
+		if instance, ok := cfg.JiraByName(task.Instance); ok && !instance.Offline() {
+			item.URL = strings.TrimRight(instance.URL, "/") + "/browse/" + task.Key
+		}
+		if answer, ok := answers[task.Ref()]; ok {
+			item.Model, item.Question, item.Answer, item.AnsweredAt = answer.Model, answer.Question, answer.Answer, answer.AnsweredAt
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// rememberAnswer запоминает последний ответ модели о задаче для выгрузки
+func (s *Server) rememberAnswer(user, taskRef string, answer taskAnswer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.appData.Answers[user] == nil {
+		s.appData.Answers[user] = map[string]taskAnswer{}
+	}
+	s.appData.Answers[user][taskRef] = answer
+}
+
+// keepAnswers оставляет только ответы по задачам из нового списка пользователя,
+// чтобы они не копились при переходе между проектами. Вызывается под s.mu.
+func (s *Server) keepAnswers(user string, tasks []jira.JiraTask) {
+	answers := s.appData.Answers[user]
+	if len(answers) == 0 {
+		return
+	}
+	current := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		current[task.Ref()] = true
+	}
+	for ref := range answers {
+		if !current[ref] {
+			delete(answers, ref)
+		}
+	}
+}
+
+// exportColumns - столбцы выгрузки для страницы; выбранные по умолчанию отмечены
+func exportColumns() []models.ExportColumn {
+	defaults := map[string]bool{}
+	for _, name := range export.DefaultColumns {
+		defaults[name] = true
+	}
+	var columns []models.ExportColumn
+	for _, column := range export.Columns() {
+		columns = append(columns, models.ExportColumn{Name: column.Name, Title: column.Title, Checked: defaults[column.Name]})
+	}
+	return columns
+}
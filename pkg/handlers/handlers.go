@@ -1,14 +1,23 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"html/template"
 	"jira-go/models"
+	"jira-go/pkg/auth"
 	"jira-go/pkg/config"
 	"jira-go/pkg/jira"
+	"jira-go/pkg/limiter"
 	"jira-go/pkg/ollama"
+	"jira-go/pkg/source"
+	"jira-go/pkg/tokens"
 	"log"
 	"net/http"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type AIRequest struct {
@@ -17,18 +26,84 @@ type AIRequest struct {
 	Temperature float64 `json:"temperature,omitempty"`
 }
 
-var (
-	tmpl      *template.Template
-	appData   *AppData
-	configObj *config.Config
-	mu        sync.RWMutex
-)
+// Server - обработчики HTTP-запросов и их общее состояние: конфигурация, шаблоны, списки
+// задач и моделей пользователей, пул серверов Ollama и лимиты. Все методы безопасны для
+// одновременных запросов.
+type Server struct {
+	// tmpl и cfg подменяются целиком при перезагрузке (см. Reload), поэтому
+	// уже начатые запросы дорабатывают со старой версией
+	tmpl    atomic.Pointer[template.Template]
+	cfg     atomic.Pointer[config.Config]
+	appData *AppData
+	mu      sync.RWMutex
+
+	// jira выполняет запросы к Jira
+	jira Jira
+	// ollamaPool распределяет запросы между серверами Ollama из конфигурации
+	ollamaPool *ollama.Pool
+	// ownPool - пул создан по cfg.Ollama и следует за ней при перезагрузке;
+	// внедренный через Deps пул не меняется
+	ownPool bool
+	// authenticator проверяет вход в интерфейс
+	authenticator *auth.Authenticator
+	// userTokens - личные токены Jira пользователей
+	userTokens *tokens.Store
+	// ollamaLimits - очереди к моделям на серверах Ollama
+	ollamaLimits *limiter.Limiter
+	// userRate ограничивает частоту запросов к моделям от одного пользователя
+	userRate *limiter.RateLimiter
+	// readiness - последний результат проверки /readyz
+	readiness struct {
+		sync.Mutex
+		last *Readiness
+	}
+	// stop закрывается в Close и останавливает фоновые задачи
+	stop    chan struct{}
+	handler http.Handler
+}
+
+// Deps - внешние зависимости Server. Незаданные создаются по конфигурации; тесты
+// подставляют свои, например пул с поддельными серверами Ollama.
+type Deps struct {
+	// Jira - клиент Jira; по умолчанию запросы выполняет pkg/jira
+	Jira Jira
+	// Ollama - пул серверов Ollama; по умолчанию создается из cfg.Ollama. Серверы
+	// внедренного пула не меняются при перезагрузке, /readyz проверяет их же.
+	Ollama *ollama.Pool
+	// Tokens - хранилище личных токенов Jira; по умолчанию открывается auth.token_store
+	Tokens *tokens.Store
+}
 
 type AppData struct {
-	Models        []map[string]interface{}
-	Tasks         []jira.JiraTask
-	Error         string
-	SelectedModel string
+	Models []map[string]interface{}
+	// Tasks - последний полученный список задач каждого пользователя: задачи запрашиваются
+	// с его токеном, и другим пользователям они могут быть недоступны
+	Tasks map[string][]jira.JiraTask
+	Error string
+	// SelectedModels - модель, выбранная каждым пользователем; пока пользователь не выбрал,
+	// используется default_model из конфигурации, пустая строка - выбор сброшен
+	SelectedModels map[string]string
+	// NumCtx - кэш окон контекста моделей
+	NumCtx map[string]int
+	// Issues - кэш полных задач Jira по пользователю и ключу вида instance/KEY,
+	// срок жизни задается cache.ttl
+	Issues map[string]cachedIssue
+	// Answers - последний ответ модели по каждой задаче из списка пользователя
+	// (пользователь -> instance/KEY), попадает в выгрузку
+	Answers map[string]map[string]taskAnswer
+}
+
+// taskAnswer - вопрос о задаче и ответ модели
+type taskAnswer struct {
+	Model      string
+	Question   string
+	Answer     string
+	AnsweredAt time.Time
+}
+
+type cachedIssue struct {
+	task      *jira.JiraTask
+	fetchedAt time.Time
 }
 
 type ProjectForm struct {
@@ -36,59 +111,126 @@ type ProjectForm struct {
 	Messages   string `json:"messages"`
 }
 
-// InitHandlers инициализирует обработчики HTTP запросов
-func InitHandlers(cfg *config.Config) {
-	configObj = cfg
+// New создает обработчики HTTP-запросов. Возвращенный Server - маршрутизатор,
+// закрытый проверкой входа; фоновые проверки серверов Ollama работают до вызова Close.
+func New(cfg *config.Config, deps Deps) (*Server, error) {
+	s := &Server{jira: deps.Jira, ollamaPool: deps.Ollama, userTokens: deps.Tokens, stop: make(chan struct{})}
+	s.cfg.Store(cfg)
 
-	// Загружаем модели при запуске
-	models, err := ollama.GetOllamaModels(configObj.OllamaHost)
+	// Загружаем шаблоны
+	parsed, err := loadTemplates(cfg.Server.TemplatesDir)
 	if err != nil {
-		log.Printf("Ошибка загрузки моделей: %v", err)
-		models = []map[string]interface{}{}
+		return nil, fmt.Errorf("ошибка загрузки шаблонов: %v", err)
+	}
+	s.tmpl.Store(parsed)
+
+	if s.userTokens == nil {
+		if s.userTokens, err = openTokenStore(cfg.Auth); err != nil {
+			return nil, fmt.Errorf("ошибка открытия хранилища токенов: %v", err)
+		}
 	}
-	
-	appData = &AppData{
-		Models: models,
-		Tasks:  []jira.JiraTask{},
+	if s.jira == nil {
+		s.jira = source.REST{}
 	}
 
-	// Загружаем шаблоны
-	var errParse error
-	tmpl, errParse = loadTemplates()
-	if errParse != nil {
-		log.Fatal("Ошибка загрузки шаблонов:", errParse)
+	// Пул серверов Ollama: первая проверка заполняет список моделей при запуске
+	if s.ollamaPool == nil {
+		s.ollamaPool = ollama.NewPool(ollamaEndpoints(cfg))
+		s.ownPool = true
+	}
+	s.initLimits(cfg.Limits)
+	s.ollamaPool.Start(cfg.Timeouts.HealthCheck, s.stop)
+
+	models := s.ollamaPool.Models()
+	if len(models) == 0 {
+		log.Printf("Ошибка загрузки моделей: нет доступных серверов Ollama с моделями")
 	}
 
-	// Отладочная информация printTemplateNames(tmpl)
+	s.appData = &AppData{
+		Models:  models,
+		Tasks:   map[string][]jira.JiraTask{},
+		NumCtx:  map[string]int{},
+		Issues:  map[string]cachedIssue{},
+		Answers: map[string]map[string]taskAnswer{},
+		// Пока пользователь не выбрал модель, используется модель по умолчанию из конфигурации
+		SelectedModels: map[string]string{},
+	}
 
-	fs := http.FileServer(http.Dir("./templates/static"))
-	http.Handle("/static/", http.StripPrefix("/static/", fs))
+	// Отладочная информация printTemplateNames(parsed)
+
+	// Каталог статики берется из текущей конфигурации на каждый запрос, чтобы он менялся при перезагрузке
+	fs := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.FileServer(http.Dir(s.cfg.Load().Server.StaticDir)).ServeHTTP(w, r)
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/static/", http.StripPrefix("/static/", fs))
 	// Регистрируем handlers
 
-	http.HandleFunc("/get-tasks", getTasksHandler)
-	http.HandleFunc("/send-to-ai", sendAIHandler)
-	http.HandleFunc("/select-model", selectModelHandler)
-	http.HandleFunc("/api/models", modelsHandler)
-	http.HandleFunc("/api/tasks", tasksHandler)
-	http.HandleFunc("/", indexHandler)
+	mux.HandleFunc("/get-tasks", s.getTasksHandler)
+	mux.HandleFunc("/send-to-ai", s.sendAIHandler)
+	mux.HandleFunc("/select-model", s.selectModelHandler)
+	mux.HandleFunc("/api/models", s.modelsHandler)
+	mux.HandleFunc("/api/ollama-hosts", s.ollamaHostsHandler)
+	mux.HandleFunc("/api/queue", s.queueHandler)
+	mux.HandleFunc("/api/tasks", s.tasksHandler)
+	mux.HandleFunc("/api/jira-token", s.jiraTokenHandler)
+	mux.HandleFunc("/release-notes", s.releaseNotesHandler)
+	mux.HandleFunc("/api/epic-report", s.epicReportHandler)
+	mux.HandleFunc("/epic", s.epicPageHandler)
+	s.registerAPI(mux)
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", s.readyzHandler)
+	mux.HandleFunc("/", s.indexHandler)
+
+	s.authenticator = auth.New(cfg.Auth, func(w http.ResponseWriter, page auth.LoginPage) error {
+		return s.tmpl.Load().ExecuteTemplate(w, "login.html", page)
+	})
+	s.authenticator.Register(mux)
+	if cfg.Auth.Disabled {
+		log.Printf("Внимание: вход отключен (auth.disabled), интерфейс доступен всем")
+	}
+	// Порядок обработки: ограничение размера тела, проверка входа, проверка CSRF-токена
+	s.handler = limitBody(s.authenticator.Middleware(auth.CSRF(mux)))
+	return s, nil
 }
 
-func indexHandler(w http.ResponseWriter, r *http.Request) {
-	mu.RLock()
-	defer mu.RUnlock()
+// ServeHTTP передает запрос маршрутизатору с проверками входа и CSRF
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// Close останавливает фоновые задачи обработчиков и сбрасывает кэши
+func (s *Server) Close() {
+	close(s.stop)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log.Printf("Остановка обработчиков: в кэше %d задач Jira", len(s.appData.Issues))
+	s.appData.Issues = map[string]cachedIssue{}
+	s.appData.NumCtx = map[string]int{}
+}
+
+func (s *Server) indexHandler(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
+	tasks := s.appData.Tasks[userID(r)]
 	data := models.TemplateData{
-		Models:        appData.Models,
-		Tasks:         appData.Tasks,
-		Error:         appData.Error,
-		SelectedModel: appData.SelectedModel,
+		Models:        s.appData.Models,
+		Tasks:         tasks,
+		Error:         s.appData.Error,
+		SelectedModel: s.userModel(userID(r)),
+		JiraInstances: s.cfg.Load().JiraNames(),
+		ExportColumns: exportColumns(),
+		User:          currentUser(r),
+		CSRFToken:     auth.CSRFToken(r.Context()),
 		Stats: models.Stats{
-			ModelCount: len(appData.Models),
-			TaskCount:  len(appData.Tasks),
+			ModelCount: len(s.appData.Models),
+			TaskCount:  len(tasks),
 		},
 	}
 
-	err := tmpl.ExecuteTemplate(w, "index.html", data)
+	err := s.tmpl.Load().ExecuteTemplate(w, "index.html", data)
 	if err != nil {
 		log.Printf("Ошибка выполнения шаблона: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -96,27 +238,107 @@ func indexHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // Загружаем шаблоны
-func loadTemplates() (*template.Template, error) {
-	// Сначала загружаем основной шаблон
-	tmpl, err := template.ParseFiles("templates/index.html")
+func loadTemplates(dir string) (*template.Template, error) {
+	// Сначала загружаем шаблоны страниц
+	tmpl, err := template.ParseFiles(filepath.Join(dir, "index.html"), filepath.Join(dir, "epic.html"), filepath.Join(dir, "login.html"))
 	if err != nil {
 		return nil, err
 	}
 
 	// Затем парсим остальные шаблоны
 	componentTemplates := []string{
-		"templates/static/head.html",
-		"templates/static/header.html",
-		"templates/static/stats.html",
-		"templates/static/models.html",
-		"templates/static/task_form.html",
-		"templates/static/tasks.html",
-		"templates/static/ai_form.html",
+		"head.html",
+		"header.html",
+		"stats.html",
+		"models.html",
+		"task_form.html",
+		"tasks.html",
+		"ai_form.html",
+		"jira_select.html",
+		"jira_token.html",
+	}
+	for i, name := range componentTemplates {
+		componentTemplates[i] = filepath.Join(dir, "static", name)
 	}
 
 	return tmpl.ParseFiles(componentTemplates...)
 }
 
+// currentUser возвращает имя вошедшего пользователя для шаблонов; пусто, если вход отключен
+func currentUser(r *http.Request) string {
+	user, _ := auth.UserFromContext(r.Context())
+	return user.Name
+}
+
+// userID возвращает ключ личных данных вошедшего пользователя (см. auth.User.ID);
+// пусто, если вход отключен
+func userID(r *http.Request) string {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		return ""
+	}
+	return user.ID()
+}
+
+// jiraInstance выбирает подключение Jira по имени из запроса (пустое имя - подключение
+// по умолчанию) и подставляет в него личный токен вошедшего пользователя, чтобы Jira
+// показывала только доступное ему и записывала действия на него. Токен сервиса
+// используется, только если вход отключен.
+func (s *Server) jiraInstance(r *http.Request, name string) (config.JiraInstance, error) {
+	instance, ok := s.cfg.Load().JiraByName(name)
+	if !ok {
+		return config.JiraInstance{}, fmt.Errorf("неизвестное подключение Jira: %s", name)
+	}
+	// Выгрузка из файла доступна всем вошедшим, токен для нее не нужен
+	if instance.Offline() {
+		return instance, nil
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		return instance, nil
+	}
+	token, ok, err := s.userTokens.Get(user.ID(), instance.Name)
+	if err != nil {
+		log.Printf("Ошибка чтения токена Jira пользователя %s: %v", user.Name, err)
+	}
+	if !ok {
+		return config.JiraInstance{}, fmt.Errorf("%w для %s", errNoUserToken, instance.Name)
+	}
+	instance.Token = token
+	return instance, nil
+}
+
+// jiraInstanceError переводит ошибку jiraInstance в ответ API
+func jiraInstanceError(err error) *APIError {
+	if errors.Is(err, errNoUserToken) {
+		return apiError(http.StatusForbidden, CodeNoJiraToken, err.Error())
+	}
+	return apiError(http.StatusBadRequest, CodeUnknownInstance, err.Error())
+}
+
+// getIssue возвращает полную задачу из кэша пользователя или запрашивает ее в Jira (или в выгрузке)
+func (s *Server) getIssue(user string, instance config.JiraInstance, key string) (*jira.JiraTask, error) {
+	ref := user + "|" + jira.TaskRef(instance.Name, key)
+	s.mu.RLock()
+	cached, ok := s.appData.Issues[ref]
+	s.mu.RUnlock()
+	if ok && time.Since(cached.fetchedAt) < s.cfg.Load().Cache.TTL {
+		return cached.task, nil
+	}
+
+	task, err := s.taskSource(instance).Issue(key)
+	if err != nil {
+		return nil, err
+	}
+	task.Instance = instance.Name
+
+	s.mu.Lock()
+	s.appData.Issues[ref] = cachedIssue{task: task, fetchedAt: time.Now()}
+	s.mu.Unlock()
+	return task, nil
+}
+
 // вспомогательную функцию для отладки
 func printTemplateNames(tmpl *template.Template) {
 	log.Printf("Загруженные шаблоны:")
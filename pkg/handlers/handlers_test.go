@@ -0,0 +1,683 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jira-go/pkg/auth"
+	"jira-go/pkg/config"
+	"jira-go/pkg/fakejira"
+	"jira-go/pkg/fakeollama"
+	"jira-go/pkg/jira"
+	"jira-go/pkg/ollama"
+	"jira-go/pkg/source"
+	"jira-go/pkg/tokens"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const csrf = "test-csrf"
+
+// testEnv - Server с поддельными Jira и Ollama
+type testEnv struct {
+	srv    *Server
+	ollama *fakeollama.Server
+	cfg    *config.Config
+}
+
+// newTestEnv поднимает поддельные Jira (проект DEMO) и Ollama и Server с входом без пароля.
+// change меняет конфигурацию до создания Server.
+func newTestEnv(t *testing.T, change func(*config.Config), deps Deps) *testEnv {
+	t.Helper()
+	fixture, err := fakejira.DefaultFixture()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jiraServer := httptest.NewServer(fakejira.New(fixture))
+	t.Cleanup(jiraServer.Close)
+	fakeOllama := fakeollama.New(fakeollama.Options{})
+	ollamaServer := httptest.NewServer(fakeOllama)
+	t.Cleanup(ollamaServer.Close)
+
+	cfg := config.Default()
+	cfg.Server.TemplatesDir = "../../templates"
+	cfg.Server.StaticDir = "../../templates/static"
+	cfg.Jira = []config.JiraInstance{{Name: "demo", URL: jiraServer.URL, Token: "demo-token"}}
+	cfg.Ollama = []config.OllamaHost{{Name: "fake", URL: ollamaServer.URL}}
+	cfg.DefaultModel = "llama3:8b"
+	cfg.Auth.Disabled = true
+	cfg.Limits.UserRate = 0
+	if change != nil {
+		change(cfg)
+	}
+
+	srv, err := New(cfg, deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	return &testEnv{srv: srv, ollama: fakeOllama, cfg: cfg}
+}
+
+// do выполняет запрос с CSRF-токеном; тело с "{" отправляется как JSON, остальное - как форма
+func (e *testEnv) do(t *testing.T, method, path, body string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if strings.HasPrefix(body, "{") {
+		req.Header.Set("Content-Type", "application/json")
+	} else if body != "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.Header.Set(auth.CSRFHeader, csrf)
+	req.AddCookie(&http.Cookie{Name: "csrf_token", Value: csrf})
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	e.srv.ServeHTTP(rec, req)
+	return rec
+}
+
+// login входит пользователем с паролем "secret" и возвращает cookie сессии
+func (e *testEnv) login(t *testing.T, name string) *http.Cookie {
+	t.Helper()
+	form := url.Values{"username": {name}, "password": {"secret"}, auth.CSRFField: {csrf}}
+	rec := e.do(t, "POST", "/login", form.Encode())
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "session" {
+			return c
+		}
+	}
+	t.Fatalf("login as %s failed: %d %s", name, rec.Code, rec.Body.String())
+	return nil
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("invalid JSON %q: %v", rec.Body.String(), err)
+	}
+}
+
+func taskKeys(tasks []jira.JiraTask) string {
+	var keys []string
+	for _, task := range tasks {
+		keys = append(keys, task.Key)
+	}
+	return strings.Join(keys, ",")
+}
+
+func TestIndexHandler(t *testing.T) {
+	env := newTestEnv(t, nil, Deps{})
+
+	rec := env.do(t, "GET", "/", "")
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, body)
+	}
+	for _, want := range []string{`<option value="llama3:8b" selected>`, `content="` + csrf + `"`, `<div class="stat-number">3</div>`, `<div class="stat-number">0</div>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page does not contain %s", want)
+		}
+	}
+
+	env.do(t, "POST", "/get-tasks", `{"projectKey": "DEMO"}`)
+	if body := env.do(t, "GET", "/", "").Body.String(); !strings.Contains(body, `<div class="stat-number">4</div>`) {
+		t.Error("page does not count loaded tasks")
+	}
+}
+
+func TestGetTasksHandler(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Jira = append(cfg.Jira, config.JiraInstance{Name: "down", URL: down.URL, Token: "x"})
+	}, Deps{})
+
+	rec := env.do(t, "POST", "/get-tasks", `{"projectKey": " demo "}`)
+	var result struct {
+		Success  bool            `json:"success"`
+		Tasks    []jira.JiraTask `json:"tasks"`
+		Count    int             `json:"count"`
+		Total    int             `json:"total"`
+		JQL      string          `json:"jql"`
+		Instance string          `json:"instance"`
+	}
+	decode(t, rec, &result)
+	if !result.Success || result.Count != 4 || result.Total != 4 || result.Instance != "demo" || !strings.Contains(result.JQL, "project = DEMO") {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if keys := taskKeys(result.Tasks); keys != "DEMO-2,DEMO-3,DEMO-4,DEMO-8" {
+		t.Errorf("unexpected tasks %s", keys)
+	}
+	if task := result.Tasks[0]; task.Instance != "demo" || !strings.Contains(task.DescriptionHTML, "<h3>Шаги</h3>") {
+		t.Errorf("task is not prepared for the page: %q %q", task.Instance, task.DescriptionHTML)
+	}
+
+	// Пустой проект - не ошибка
+	decode(t, env.do(t, "POST", "/get-tasks", `{"projectKey": "EMPTY"}`), &result)
+	if !result.Success || result.Count != 0 || result.Tasks == nil {
+		t.Errorf("expected empty list, got %+v", result)
+	}
+
+	for _, tt := range []struct {
+		method, body string
+		status       int
+	}{
+		{"GET", "", http.StatusMethodNotAllowed},
+		{"POST", `{"projectKey": ""}`, http.StatusBadRequest},
+		{"POST", `{"projectKey": "DEMO; DROP"}`, http.StatusBadRequest},
+		{"POST", `{"projectKey": "DEMO", "extra": 1}`, http.StatusBadRequest},
+		{"POST", `{"projectKey": "DEMO", "instance": "nope"}`, http.StatusBadRequest},
+		{"POST", `{"projectKey": "DEMO", "instance": "down"}`, http.StatusBadGateway},
+	} {
+		if rec := env.do(t, tt.method, "/get-tasks", tt.body); rec.Code != tt.status {
+			t.Errorf("%s %s: expected %d, got %d %s", tt.method, tt.body, tt.status, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestTasksHandler(t *testing.T) {
+	env := newTestEnv(t, nil, Deps{})
+
+	if body := strings.TrimSpace(env.do(t, "GET", "/api/tasks", "").Body.String()); body != "[]" {
+		t.Errorf("expected empty list before loading, got %s", body)
+	}
+
+	env.do(t, "POST", "/get-tasks", `{"projectKey": "DEMO"}`)
+	var tasks []jira.JiraTask
+	decode(t, env.do(t, "GET", "/api/tasks", ""), &tasks)
+	if keys := taskKeys(tasks); keys != "DEMO-2,DEMO-3,DEMO-4,DEMO-8" {
+		t.Errorf("unexpected tasks %s", keys)
+	}
+
+	var envelope struct {
+		Data []jira.JiraTask `json:"data"`
+	}
+	decode(t, env.do(t, "GET", "/api/v1/tasks", ""), &envelope)
+	if len(envelope.Data) != 4 {
+		t.Errorf("expected the same list in API v1, got %d", len(envelope.Data))
+	}
+}
+
+func TestSendAIHandler(t *testing.T) {
+	env := newTestEnv(t, nil, Deps{})
+	env.do(t, "POST", "/get-tasks", `{"projectKey": "DEMO"}`)
+
+	rec := env.do(t, "POST", "/send-to-ai", `{"messages": "Как исправить?", "taskKey": "demo-2"}`)
+	var result struct {
+		Success bool   `json:"success"`
+		Answer  string `json:"answer"`
+		TaskRef string `json:"taskRef"`
+		Context struct {
+			NumCtx int `json:"numCtx"`
+		} `json:"context"`
+	}
+	decode(t, rec, &result)
+	if !result.Success || result.TaskRef != "demo/DEMO-2" || !strings.HasPrefix(result.Answer, "[llama3:8b] Как исправить?") {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	// Модель получила вопрос вместе с задачей, включая комментарии из полной задачи
+	chats := env.ollama.Chats()
+	if len(chats) != 1 || !strings.Contains(chats[0].Messages[0].Content, "Падает вход через SSO") || !strings.Contains(chats[0].Messages[0].Content, "старый отпечаток") {
+		t.Errorf("task context is not sent to the model: %+v", chats)
+	}
+
+	// Без задачи вопрос уходит как есть
+	decode(t, env.do(t, "POST", "/send-to-ai", `{"messages": "Привет"}`), &result)
+	if result.Answer != "[llama3:8b] Привет" {
+		t.Errorf("unexpected answer %q", result.Answer)
+	}
+
+	// Ответ по задаче попадает в выгрузку
+	if rec := env.do(t, "GET", "/api/v1/export?format=csv&columns=key,answer", ""); !strings.Contains(rec.Body.String(), `DEMO-2,"[llama3:8b] Как исправить?`) {
+		t.Errorf("answer is not exported: %s", rec.Body.String())
+	}
+
+	env.ollama.Fail("/api/chat", fakeollama.Failure{Status: http.StatusServiceUnavailable, Times: 1})
+	if rec := env.do(t, "POST", "/send-to-ai", `{"messages": "Привет"}`); rec.Code != http.StatusBadGateway {
+		t.Errorf("expected 502 when Ollama fails, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	for _, tt := range []struct {
+		body   string
+		status int
+	}{
+		{`{"messages": ""}`, http.StatusBadRequest},
+		{`{"messages": "?", "taskKey": "DEMO"}`, http.StatusBadRequest},
+		{`{"messages": "?", "taskKey": "DEMO-99"}`, http.StatusNotFound},
+		{`{"messages": "?", "taskKey": "DEMO-2", "instance": "nope"}`, http.StatusBadRequest},
+		{`not json`, http.StatusUnsupportedMediaType},
+	} {
+		if rec := env.do(t, "POST", "/send-to-ai", tt.body); rec.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d %s", tt.body, tt.status, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := env.do(t, "GET", "/send-to-ai", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+}
+
+func TestSendAIHandlerModel(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.DefaultModel = ""
+		cfg.Limits.UserRate, cfg.Limits.UserBurst = 1, 1
+	}, Deps{})
+
+	if rec := env.do(t, "POST", "/send-to-ai", `{"messages": "Привет"}`); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "Модель не выбрана") {
+		t.Errorf("expected model_required, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := env.do(t, "POST", "/send-to-ai", `{"messages": "Привет", "model": "gpt-4"}`); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "Неизвестная модель") {
+		t.Errorf("expected unknown model, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := env.do(t, "POST", "/send-to-ai", `{"messages": "Привет", "model": "mistral:7b"}`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "[mistral:7b] Привет") {
+		t.Fatalf("unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+	// Модель из запроса не становится выбранной
+	var envelope struct {
+		Data ModelSelection `json:"data"`
+	}
+	decode(t, env.do(t, "GET", "/api/v1/model", ""), &envelope)
+	if envelope.Data.Model != "" {
+		t.Errorf("request must not change the selection, got %q", envelope.Data.Model)
+	}
+	rec := env.do(t, "POST", "/send-to-ai", `{"messages": "Привет", "model": "mistral:7b"}`)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 429 with Retry-After, got %d %v", rec.Code, rec.Header())
+	}
+}
+
+// API v1 передает температуру в Ollama и проверяет ее
+func TestChatTemperature(t *testing.T) {
+	env := newTestEnv(t, nil, Deps{})
+
+	if rec := env.do(t, "POST", "/api/v1/chat", `{"message": "Привет", "model": "mistral:7b", "temperature": 0.2}`); rec.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+	env.do(t, "POST", "/api/v1/chat", `{"message": "Привет"}`)
+	chats := env.ollama.Chats()
+	if len(chats) != 2 || chats[0].Model != "mistral:7b" || chats[0].Options["temperature"] != 0.2 {
+		t.Fatalf("temperature is not sent to Ollama: %+v", chats)
+	}
+	if chats[1].Model != "llama3:8b" || chats[1].Options != nil {
+		t.Errorf("expected default model without options, got %+v", chats[1])
+	}
+
+	if rec := env.do(t, "POST", "/api/v1/chat", `{"message": "Привет", "temperature": 5}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for temperature out of range, got %d", rec.Code)
+	}
+}
+
+func TestSelectModelHandler(t *testing.T) {
+	env := newTestEnv(t, nil, Deps{})
+
+	rec := env.do(t, "POST", "/select-model", "model=mistral:7b")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"model":"mistral:7b"`) {
+		t.Fatalf("unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+	var envelope struct {
+		Data ModelSelection `json:"data"`
+	}
+	decode(t, env.do(t, "GET", "/api/v1/model", ""), &envelope)
+	if envelope.Data.Model != "mistral:7b" {
+		t.Errorf("selection is not saved: %q", envelope.Data.Model)
+	}
+	if body := env.do(t, "POST", "/send-to-ai", `{"messages": "Привет"}`).Body.String(); !strings.Contains(body, "[mistral:7b]") {
+		t.Errorf("selected model is not used: %s", body)
+	}
+	if body := env.do(t, "POST", "/send-to-ai", `{"messages": "Привет", "model": "llama3:8b"}`).Body.String(); !strings.Contains(body, "[llama3:8b]") {
+		t.Errorf("model from the request is not used: %s", body)
+	}
+
+	if rec := env.do(t, "POST", "/select-model", "model=gpt-4"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown model, got %d", rec.Code)
+	}
+	if rec := env.do(t, "GET", "/select-model", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+	env.do(t, "POST", "/select-model", "model=")
+	if rec := env.do(t, "POST", "/send-to-ai", `{"messages": "Привет"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("empty name should reset the selection, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestModelsHandler(t *testing.T) {
+	env := newTestEnv(t, nil, Deps{})
+
+	var list []map[string]interface{}
+	decode(t, env.do(t, "GET", "/api/models", ""), &list)
+	if len(list) != 3 || list[0]["name"] != "llama3:8b" {
+		t.Fatalf("unexpected models %v", list)
+	}
+	if hosts, _ := list[0]["hosts"].([]interface{}); len(hosts) != 1 || hosts[0] != "fake" {
+		t.Errorf("expected hosts of the model, got %v", list[0]["hosts"])
+	}
+
+	env.ollama.Fail("/api/tags", fakeollama.Failure{Status: http.StatusInternalServerError})
+	if rec := env.do(t, "GET", "/api/models", ""); rec.Code != http.StatusBadGateway {
+		t.Errorf("expected 502 without Ollama, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+// countingJira - клиент Jira для проверки внедрения зависимостей: отдает одну задачу
+// и считает запросы
+type countingJira struct {
+	source.REST
+	issues atomic.Int32
+}
+
+func (c *countingJira) ProjectTasks(url, token, projectKey string) (*jira.SearchResult, error) {
+	task := jira.JiraTask{Key: projectKey + "-1"}
+	task.Fields.Summary = "Задача из внедренного клиента"
+	return &jira.SearchResult{Issues: []jira.JiraTask{task}, Total: 1}, nil
+}
+
+func (c *countingJira) Issue(url, token, key string) (*jira.JiraTask, error) {
+	c.issues.Add(1)
+	task := &jira.JiraTask{Key: key}
+	task.Fields.Summary = "Полная задача " + key
+	return task, nil
+}
+
+// hangingJira не отвечает на проверку токена, пока не отменен контекст
+type hangingJira struct {
+	source.REST
+	returned chan struct{}
+}
+
+func (h *hangingJira) Myself(ctx context.Context, url, token string) (*jira.User, error) {
+	<-ctx.Done()
+	close(h.returned)
+	return nil, ctx.Err()
+}
+
+// Зависшая Jira не делает сервис готовым, а проверка обрывает запрос по таймауту,
+// не оставляя его висеть
+func TestReadinessTimeout(t *testing.T) {
+	timeout := probeTimeout
+	probeTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { probeTimeout = timeout })
+	client := &hangingJira{returned: make(chan struct{})}
+	env := newTestEnv(t, nil, Deps{Jira: client})
+
+	var readiness Readiness
+	rec := env.do(t, "GET", "/readyz", "")
+	decode(t, rec, &readiness)
+	if rec.Code != http.StatusServiceUnavailable || readiness.Ready || !strings.Contains(readiness.Dependencies[0].Error, "нет ответа") {
+		t.Errorf("expected Jira timeout, got %d %+v", rec.Code, readiness)
+	}
+	select {
+	case <-client.returned:
+	default:
+		t.Error("Jira check must be cancelled when the probe times out")
+	}
+}
+
+func TestInjectedJira(t *testing.T) {
+	client := &countingJira{}
+	env := newTestEnv(t, nil, Deps{Jira: client})
+
+	var result TasksResult
+	var envelope struct {
+		Data *TasksResult `json:"data"`
+	}
+	envelope.Data = &result
+	decode(t, env.do(t, "POST", "/api/v1/tasks", `{"projectKey": "ABC"}`), &envelope)
+	if taskKeys(result.Tasks) != "ABC-1" {
+		t.Fatalf("tasks are not loaded from the injected client: %+v", result)
+	}
+
+	// Полная задача запрашивается один раз и дальше берется из кэша
+	for i := 0; i < 3; i++ {
+		if rec := env.do(t, "POST", "/send-to-ai", `{"messages": "?", "taskKey": "ABC-1"}`); !strings.Contains(rec.Body.String(), "Полная задача ABC-1") {
+			t.Fatalf("unexpected answer %s", rec.Body.String())
+		}
+	}
+	if n := client.issues.Load(); n != 1 {
+		t.Errorf("expected one issue request, got %d", n)
+	}
+}
+
+// Внедренный пул Ollama используется для запросов и проверки готовности и не меняется
+// при перезагрузке конфигурации
+func TestInjectedOllama(t *testing.T) {
+	injected := fakeollama.New(fakeollama.Options{Models: fakeollama.Models("phi3:mini")})
+	server := httptest.NewServer(injected)
+	t.Cleanup(server.Close)
+	pool := ollama.NewPool([]ollama.Endpoint{{Name: "injected", URL: server.URL}})
+	env := newTestEnv(t, func(cfg *config.Config) { cfg.DefaultModel = "phi3:mini" }, Deps{Ollama: pool})
+
+	var list []map[string]interface{}
+	decode(t, env.do(t, "GET", "/api/models", ""), &list)
+	if len(list) != 1 || list[0]["name"] != "phi3:mini" {
+		t.Fatalf("models are not taken from the injected pool: %v", list)
+	}
+	if rec := env.do(t, "POST", "/send-to-ai", `{"messages": "Привет"}`); !strings.Contains(rec.Body.String(), "[phi3:mini] Привет") {
+		t.Errorf("unexpected answer %s", rec.Body.String())
+	}
+	if len(injected.Chats()) != 1 || len(env.ollama.Chats()) != 0 {
+		t.Errorf("chat must go to the injected pool: injected=%d config=%d", len(injected.Chats()), len(env.ollama.Chats()))
+	}
+
+	var readiness Readiness
+	decode(t, env.do(t, "GET", "/readyz", ""), &readiness)
+	var hosts []string
+	for _, d := range readiness.Dependencies {
+		if d.Type == "ollama" {
+			hosts = append(hosts, d.Name)
+		}
+	}
+	if !readiness.Ready || strings.Join(hosts, ",") != "injected" {
+		t.Errorf("readiness must probe the injected pool, got %+v", readiness)
+	}
+
+	next := *env.cfg
+	next.Ollama = []config.OllamaHost{{Name: "other", URL: "http://127.0.0.1:1"}}
+	if err := env.srv.Reload(&next); err != nil {
+		t.Fatal(err)
+	}
+	if endpoints := pool.Endpoints(); len(endpoints) != 1 || endpoints[0].Name != "injected" {
+		t.Errorf("reload must not replace hosts of the injected pool: %v", endpoints)
+	}
+}
+
+// После перезагрузки на другой сервер Ollama окно контекста модели запрашивается заново
+func TestNumCtxAfterReload(t *testing.T) {
+	env := newTestEnv(t, nil, Deps{})
+	env.do(t, "POST", "/get-tasks", `{"projectKey": "DEMO"}`)
+	numCtx := func() int {
+		var result struct {
+			Context struct {
+				NumCtx int `json:"numCtx"`
+			} `json:"context"`
+		}
+		decode(t, env.do(t, "POST", "/send-to-ai", `{"messages": "Как исправить?", "taskKey": "DEMO-2"}`), &result)
+		return result.Context.NumCtx
+	}
+	if n := numCtx(); n != ollama.DefaultNumCtx {
+		t.Fatalf("expected default num_ctx, got %d", n)
+	}
+
+	repulled := fakeollama.New(fakeollama.Options{Models: []fakeollama.Model{{Name: "llama3:8b", Family: "llama", ContextLength: 8192, NumCtx: 8192}}})
+	server := httptest.NewServer(repulled)
+	t.Cleanup(server.Close)
+	next := *env.cfg
+	next.Ollama = []config.OllamaHost{{Name: "repulled", URL: server.URL}}
+	if err := env.srv.Reload(&next); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.srv.RefreshModels(); err != nil {
+		t.Fatal(err)
+	}
+	if n := numCtx(); n != 8192 {
+		t.Errorf("num_ctx must be taken from the new host, got %d", n)
+	}
+}
+
+// Отмена запроса заметок о выпуске или сводки по эпику обрывает запрос к модели
+// и освобождает место в очереди
+func TestGenerateCancel(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) { cfg.Limits.PerHost = 1 }, Deps{})
+	env.ollama.SetLatency(time.Second)
+
+	for path, body := range map[string]string{
+		"/release-notes":   `{"projectKey": "DEMO", "fixVersion": "1.4"}`,
+		"/api/epic-report": `{"epicKey": "DEMO-1"}`,
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		req := httptest.NewRequest("POST", path, strings.NewReader(body)).WithContext(ctx)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(auth.CSRFHeader, csrf)
+		req.AddCookie(&http.Cookie{Name: "csrf_token", Value: csrf})
+		start := time.Now()
+		env.srv.ServeHTTP(httptest.NewRecorder(), req)
+		cancel()
+
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("%s: generation was not cancelled, took %v", path, elapsed)
+		}
+		if release, ok := env.srv.ollamaLimits.TryAcquire("fake/llama3:8b"); !ok {
+			t.Errorf("%s: slot must be released after cancel", path)
+		} else {
+			release()
+		}
+	}
+}
+
+// withLogin включает вход для demo, anna и bob с паролем "secret"; у demo и anna
+// сохранены личные токены Jira, у bob токена нет
+func withLogin(t *testing.T) (func(*config.Config), Deps) {
+	t.Helper()
+	hash, err := auth.HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, _ := tokens.NewStore("", nil)
+	store.Set(localUser("demo").ID(), "demo", "demo-token")
+	store.Set(localUser("anna").ID(), "demo", "anna-token")
+	return func(cfg *config.Config) {
+		cfg.Auth.Disabled = false
+		cfg.Auth.Users = []config.AuthUser{{Name: "demo", PasswordHash: hash}, {Name: "anna", PasswordHash: hash}, {Name: "bob", PasswordHash: hash}}
+	}, Deps{Tokens: store}
+}
+
+func localUser(name string) auth.User {
+	return auth.User{Name: name, Method: auth.MethodPassword}
+}
+
+// Пользователь OIDC с именем локального пользователя не получает его токен Jira,
+// загруженные задачи и выбранную модель
+func TestOIDCNameCollision(t *testing.T) {
+	change, deps := withLogin(t)
+	env := newTestEnv(t, change, deps)
+	demo := env.login(t, "demo")
+	env.do(t, "POST", "/get-tasks", `{"projectKey": "DEMO"}`, demo)
+	env.do(t, "POST", "/select-model", "model=mistral:7b", demo)
+
+	oidcUser := auth.User{Name: "demo", Method: auth.MethodOIDC, Subject: "idp-42"}
+	r := httptest.NewRequest("GET", "/", nil)
+	r = r.WithContext(auth.WithUser(r.Context(), oidcUser))
+	if _, err := env.srv.jiraInstance(r, ""); !errors.Is(err, errNoUserToken) {
+		t.Errorf("OIDC user must not get the local user's token, got %v", err)
+	}
+	env.srv.mu.RLock()
+	tasks, model := env.srv.appData.Tasks[userID(r)], env.srv.userModel(userID(r))
+	localTasks := env.srv.appData.Tasks[localUser("demo").ID()]
+	env.srv.mu.RUnlock()
+	if len(localTasks) == 0 {
+		t.Fatal("local user has no tasks")
+	}
+	if len(tasks) != 0 || model != "llama3:8b" {
+		t.Errorf("OIDC user must not see the local user's data: %d tasks, model %s", len(tasks), model)
+	}
+}
+
+// Выбор модели одного пользователя не меняет модель остальных
+func TestSelectModelPerUser(t *testing.T) {
+	change, deps := withLogin(t)
+	env := newTestEnv(t, change, deps)
+	demo, anna := env.login(t, "demo"), env.login(t, "anna")
+
+	if rec := env.do(t, "POST", "/select-model", "model=mistral:7b", demo); rec.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+	for user, want := range map[*http.Cookie]string{demo: "mistral:7b", anna: "llama3:8b"} {
+		var envelope struct {
+			Data ModelSelection `json:"data"`
+		}
+		decode(t, env.do(t, "GET", "/api/v1/model", "", user), &envelope)
+		if envelope.Data.Model != want {
+			t.Errorf("expected %s, got %q", want, envelope.Data.Model)
+		}
+		if body := env.do(t, "GET", "/", "", user).Body.String(); !strings.Contains(body, `<option value="`+want+`" selected>`) {
+			t.Errorf("page does not select %s", want)
+		}
+	}
+}
+
+// Одновременные запросы нескольких пользователей не мешают друг другу; запускать с -race
+func TestConcurrentRequests(t *testing.T) {
+	change, deps := withLogin(t)
+	env := newTestEnv(t, change, deps)
+
+	sessions := map[string]*http.Cookie{"demo": env.login(t, "demo"), "anna": env.login(t, "anna"), "bob": env.login(t, "bob")}
+	projects := map[string]string{"demo": "DEMO", "anna": "EMPTY"}
+
+	const rounds = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	check := func(user string, rec *httptest.ResponseRecorder, status int) {
+		if rec.Code != status {
+			errs <- fmt.Errorf("%s: expected %d, got %d %s", user, status, rec.Code, rec.Body.String())
+		}
+	}
+	for user, project := range projects {
+		session := sessions[user]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				check(user, env.do(t, "POST", "/get-tasks", `{"projectKey": "`+project+`"}`, session), http.StatusOK)
+				check(user, env.do(t, "POST", "/send-to-ai", `{"messages": "вопрос", "taskKey": "DEMO-2"}`, session), http.StatusOK)
+				check(user, env.do(t, "GET", "/api/tasks", "", session), http.StatusOK)
+				check(user, env.do(t, "GET", "/", "", session), http.StatusOK)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			check("bob", env.do(t, "POST", "/get-tasks", `{"projectKey": "DEMO"}`, sessions["bob"]), http.StatusForbidden)
+			check("bob", env.do(t, "GET", "/api/models", "", sessions["bob"]), http.StatusOK)
+			check("bob", env.do(t, "POST", "/select-model", "model=llama3:8b", sessions["bob"]), http.StatusOK)
+			if err := env.srv.Reload(nil); err != nil {
+				errs <- err
+			}
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// У каждого пользователя свой список задач
+	for user, want := range map[string]string{"demo": "DEMO-2,DEMO-3,DEMO-4,DEMO-8", "anna": "", "bob": ""} {
+		var tasks []jira.JiraTask
+		decode(t, env.do(t, "GET", "/api/tasks", "", sessions[user]), &tasks)
+		if keys := taskKeys(tasks); keys != want {
+			t.Errorf("%s: expected tasks %q, got %q", user, want, keys)
+		}
+	}
+	if body := env.do(t, "GET", "/", "", sessions["anna"]).Body.String(); !strings.Contains(body, "anna") {
+		t.Error("page is not rendered for the logged in user")
+	}
+}
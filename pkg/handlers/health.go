@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"jira-go/pkg/importer"
+	"jira-go/pkg/ollama"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// readyCacheTTL - сколько отдавать сохраненный результат проверки, чтобы частые
+	// запросы оркестратора не нагружали Jira и Ollama
+	readyCacheTTL = 10 * time.Second
+)
+
+// probeTimeout - сколько ждать ответа одной зависимости; переменная, чтобы тесты не ждали
+var probeTimeout = 5 * time.Second
+
+// DependencyStatus - результат проверки одной зависимости
+type DependencyStatus struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	OK        bool   `json:"ok"`
+	Detail    string `json:"detail,omitempty"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latencyMs"`
+}
+
+// Readiness - готовность сервиса: все подключения Jira отвечают и хотя бы
+// один сервер Ollama доступен и имеет модели
+type Readiness struct {
+	Ready        bool               `json:"ready"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+	CheckedAt    time.Time          `json:"checkedAt"`
+}
+
+// healthzHandler сообщает, что процесс жив и обрабатывает запросы
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// readyzHandler проверяет Jira и Ollama и отвечает 503, если сервис не готов
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	result := s.checkReadiness()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !result.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// checkReadiness возвращает сохраненный результат или проверяет все зависимости параллельно.
+// Одновременные запросы ждут одну общую проверку.
+func (s *Server) checkReadiness() *Readiness {
+	s.readiness.Lock()
+	defer s.readiness.Unlock()
+
+	if s.readiness.last != nil && time.Since(s.readiness.last.CheckedAt) < readyCacheTTL {
+		return s.readiness.last
+	}
+
+	cfg := s.cfg.Load()
+	// Проверяются серверы, с которыми работает пул, а не только перечисленные в конфигурации
+	hosts := s.ollamaPool.Endpoints()
+	statuses := make([]DependencyStatus, len(cfg.Jira)+len(hosts))
+	var wg sync.WaitGroup
+	// Проверка выполняется без пользователя и только читает данные, поэтому это одно из
+	// немногих мест, где используется токен сервиса
+	for i, instance := range cfg.Jira {
+		wg.Add(1)
+		if instance.Offline() {
+			go func(i int, name, path string) {
+				defer wg.Done()
+				statuses[i] = probe(name, "jira", func(context.Context) (string, error) {
+					snapshot, err := importer.Open(path)
+					if err != nil {
+						return "", err
+					}
+					return fmt.Sprintf("выгрузка, задач: %d", snapshot.Len()), nil
+				})
+			}(i, instance.Name, instance.Import)
+			continue
+		}
+		go func(i int, name, url, token string) {
+			defer wg.Done()
+			statuses[i] = probe(name, "jira", func(ctx context.Context) (string, error) {
+				user, err := s.jira.Myself(ctx, url, token)
+				if err != nil {
+					return "", err
+				}
+				return "пользователь " + user.Name, nil
+			})
+		}(i, instance.Name, instance.URL, instance.Token)
+	}
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, host ollama.Endpoint) {
+			defer wg.Done()
+			statuses[len(cfg.Jira)+i] = probe(host.Name, "ollama", func(ctx context.Context) (string, error) {
+				version, models, err := s.ollamaPool.Probe(ctx, host)
+				if err != nil {
+					return "", err
+				}
+				if models == 0 {
+					return "", fmt.Errorf("версия %s, но нет ни одной модели", version)
+				}
+				return fmt.Sprintf("версия %s, моделей: %d", version, models), nil
+			})
+		}(i, host)
+	}
+	wg.Wait()
+
+	jiraOK, ollamaOK := true, false
+	for _, s := range statuses {
+		switch {
+		case s.Type == "jira" && !s.OK:
+			jiraOK = false
+		case s.Type == "ollama" && s.OK:
+			ollamaOK = true
+		}
+	}
+
+	s.readiness.last = &Readiness{Ready: jiraOK && ollamaOK, Dependencies: statuses, CheckedAt: time.Now()}
+	return s.readiness.last
+}
+
+// probe выполняет проверку с ограничением по времени. Клиенты Jira и Ollama используют
+// общие таймауты из конфигурации, которые для проверки слишком велики, поэтому check
+// получает контекст, который обрывает запросы по истечении probeTimeout.
+func probe(name, kind string, check func(ctx context.Context) (string, error)) DependencyStatus {
+	status := DependencyStatus{Name: name, Type: kind}
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	detail, err := check(ctx)
+	switch {
+	case err == nil:
+		status.OK, status.Detail = true, detail
+	case ctx.Err() == context.DeadlineExceeded:
+		status.Error = fmt.Sprintf("нет ответа за %v", probeTimeout)
+	default:
+		status.Error = err.Error()
+	}
+	status.LatencyMs = time.Since(start).Milliseconds()
+	return status
+}
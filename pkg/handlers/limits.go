@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"jira-go/pkg/auth"
+	"jira-go/pkg/config"
+	"jira-go/pkg/limiter"
+	"net"
+	"net/http"
+)
+
+// initLimits создает ограничения нагрузки и подключает их к пулу Ollama
+func (s *Server) initLimits(cfg config.LimitsConfig) {
+	s.ollamaLimits = limiter.New(limiterConfig(cfg))
+	s.userRate = limiter.NewRate(cfg.UserRate, cfg.UserBurst)
+	s.ollamaPool.SetLimiter(s.ollamaLimits)
+}
+
+// applyLimits применяет новые ограничения после перезагрузки конфигурации
+func (s *Server) applyLimits(cfg config.LimitsConfig) {
+	s.ollamaLimits.SetConfig(limiterConfig(cfg))
+	s.userRate.SetRate(cfg.UserRate, cfg.UserBurst)
+}
+
+func limiterConfig(cfg config.LimitsConfig) limiter.Config {
+	return limiter.Config{PerKey: cfg.PerHost, MaxQueue: cfg.Queue}
+}
+
+// clientName - по кому считаются лимиты: пользователь или, если вход отключен, адрес клиента
+func clientName(r *http.Request) string {
+	if user, ok := auth.UserFromContext(r.Context()); ok {
+		return user.ID()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// aiContext проверяет лимит пользователя на запросы к моделям и возвращает контекст
+// для очереди к Ollama
+func (s *Server) aiContext(r *http.Request) (context.Context, *APIError) {
+	client := clientName(r)
+	if err := s.userRate.Allow(client); err != nil {
+		auth.Audit(r, "rate-limited", "%s %s", r.Method, r.URL.Path)
+		return nil, ollamaError(err)
+	}
+	return limiter.WithClient(r.Context(), client), nil
+}
+
+// QueueStatus - места запросов пользователя в очереди и загрузка серверов
+type QueueStatus struct {
+	Waiting []limiter.Position `json:"waiting"`
+	Queues  []limiter.KeyStats `json:"queues"`
+}
+
+// queueStatus показывает место запросов пользователя в очереди и загрузку серверов.
+// Страница опрашивает его, пока ждет ответа модели.
+func (s *Server) queueStatus(r *http.Request) (QueueStatus, *APIError) {
+	waiting := s.ollamaLimits.Waiting(clientName(r))
+	if waiting == nil {
+		waiting = []limiter.Position{}
+	}
+	return QueueStatus{Waiting: waiting, Queues: s.ollamaLimits.Stats()}, nil
+}
+
+func (s *Server) queueHandler(w http.ResponseWriter, r *http.Request) {
+	status, _ := s.queueStatus(r)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
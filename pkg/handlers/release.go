@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"jira-go/pkg/jira"
+	"jira-go/pkg/release"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ReleaseNotesRequest - запрос заметок о выпуске по спринту или версии
+type ReleaseNotesRequest struct {
+	ProjectKey string `json:"projectKey"`
+	Sprint     string `json:"sprint"`
+	FixVersion string `json:"fixVersion"`
+	GroupBy    string `json:"groupBy"`
+	Model      string `json:"model"`
+	Instance   string `json:"instance"`
+}
+
+/**
+* Handles generation of release notes and a retrospective draft for a sprint or fix version.
+* Accepts a POST request with a JSON payload, pulls all resolved issues from Jira
+* and asks the selected Ollama model to summarize them.
+* The result is returned both as Markdown and as Jira wiki markup.
+*
+* @param w The HTTP response writer.
+* @param r The HTTP request object.
+ */
+func (s *Server) releaseNotesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var formData ReleaseNotesRequest
+	if !decodeJSON(w, r, &formData) {
+		return
+	}
+
+	result, apiErr := s.releaseNotes(r, formData)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"title":    result.Title,
+		"markdown": result.Markdown,
+		"wiki":     result.Wiki,
+		"count":    result.IssueCount,
+	})
+}
+
+// releaseNotes получает решенные задачи спринта или версии и просит модель составить
+// заметки о выпуске и черновик ретроспективы
+func (s *Server) releaseNotes(r *http.Request, req ReleaseNotesRequest) (*release.Result, *APIError) {
+	req.ProjectKey = strings.ToUpper(strings.TrimSpace(req.ProjectKey))
+	if req.ProjectKey != "" && !jira.ValidProjectKey(req.ProjectKey) {
+		return nil, apiError(http.StatusBadRequest, CodeBadRequest, "Неверный ключ проекта, ожидаются латинские буквы, цифры и _, например PROJ")
+	}
+
+	if req.GroupBy == "" {
+		req.GroupBy = release.GroupByComponent
+	}
+	if req.GroupBy != release.GroupByComponent && req.GroupBy != release.GroupByType {
+		return nil, apiError(http.StatusBadRequest, CodeBadRequest, "Группировка должна быть component или type")
+	}
+
+	jql, err := release.BuildJQL(req.ProjectKey, req.Sprint, req.FixVersion)
+	if err != nil {
+		return nil, apiError(http.StatusBadRequest, CodeBadRequest, err.Error())
+	}
+
+	model := req.Model
+	if model == "" {
+		s.mu.RLock()
+		model = s.userModel(userID(r))
+		s.mu.RUnlock()
+	}
+	if model == "" {
+		return nil, apiError(http.StatusBadRequest, CodeModelRequired, "Модель не выбрана")
+	}
+
+	ctx, apiErr := s.aiContext(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	instance, err := s.jiraInstance(r, req.Instance)
+	if err != nil {
+		return nil, jiraInstanceError(err)
+	}
+
+	issues, err := s.taskSource(instance).Resolved(jql, req.ProjectKey, req.Sprint, req.FixVersion)
+	if err != nil {
+		return nil, jiraError("Ошибка получения задач", err)
+	}
+	if len(issues) == 0 {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "Не найдено решенных задач по запросу: "+jql)
+	}
+
+	title := req.FixVersion
+	if req.Sprint != "" {
+		title = "Спринт " + req.Sprint
+	}
+	if req.ProjectKey != "" {
+		title = fmt.Sprintf("%s: %s", req.ProjectKey, title)
+	}
+
+	var result *release.Result
+	err = s.ollamaPool.DoContext(ctx, model, func(OllamaHost string) error {
+		var err error
+		result, err = release.Generate(ctx, OllamaHost, model, title, issues, req.GroupBy)
+		return err
+	})
+	if err != nil {
+		log.Printf("Ошибка генерации заметок о выпуске: %v", err)
+		return nil, ollamaError(err)
+	}
+
+	log.Printf("Заметки о выпуске %q сформированы по %d задачам", title, result.IssueCount)
+	return result, nil
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"fmt"
+	"jira-go/pkg/config"
+	"jira-go/pkg/ollama"
+	"log"
+)
+
+// Reload заново разбирает шаблоны и применяет новую конфигурацию. При ошибке разбора
+// шаблонов ничего не меняется: остаются прежние шаблоны и прежняя конфигурация.
+// Если cfg равен nil, перечитываются только шаблоны.
+func (s *Server) Reload(cfg *config.Config) error {
+	old := s.cfg.Load()
+	if cfg == nil {
+		cfg = old
+	}
+
+	parsed, err := loadTemplates(cfg.Server.TemplatesDir)
+	if err != nil {
+		return fmt.Errorf("ошибка разбора шаблонов, оставлена прежняя версия: %v", err)
+	}
+
+	s.tmpl.Store(parsed)
+	s.cfg.Store(cfg)
+	s.authenticator.SetConfig(cfg.Auth)
+	if cfg == old {
+		log.Printf("Шаблоны перезагружены")
+		return nil
+	}
+
+	if s.ownPool {
+		s.ollamaPool.SetEndpoints(ollamaEndpoints(cfg))
+	}
+	s.applyLimits(cfg.Limits)
+	go func() {
+		if err := s.RefreshModels(); err != nil {
+			log.Printf("Ошибка обновления моделей после перезагрузки: %v", err)
+		}
+	}()
+
+	s.mu.Lock()
+	// Задачи могли прийти из подключений, которых больше нет или которые смотрят на другой адрес
+	s.appData.Issues = map[string]cachedIssue{}
+	// Выбравшие прежнюю модель по умолчанию переходят на новую
+	for user, model := range s.appData.SelectedModels {
+		if model == old.DefaultModel {
+			delete(s.appData.SelectedModels, user)
+		}
+	}
+	s.mu.Unlock()
+
+	// Эти параметры используются только при запуске
+	if cfg.Server.Listen != old.Server.Listen {
+		log.Printf("server.listen изменен на %s, вступит в силу после перезапуска", cfg.Server.Listen)
+	}
+	if cfg.Log.File != old.Log.File {
+		log.Printf("log.file изменен на %q, вступит в силу после перезапуска", cfg.Log.File)
+	}
+	if cfg.Auth.TokenStore != old.Auth.TokenStore || cfg.Auth.TokenKey != old.Auth.TokenKey {
+		log.Printf("auth.token_store или auth.token_key изменены, вступят в силу после перезапуска")
+	}
+	if cfg.Timeouts.HealthCheck != old.Timeouts.HealthCheck {
+		log.Printf("timeouts.health_check изменен на %v, вступит в силу после перезапуска", cfg.Timeouts.HealthCheck)
+	}
+
+	log.Printf("Конфигурация и шаблоны перезагружены")
+	return nil
+}
+
+// ollamaEndpoints переводит серверы Ollama из конфигурации в список для пула
+func ollamaEndpoints(cfg *config.Config) []ollama.Endpoint {
+	endpoints := make([]ollama.Endpoint, 0, len(cfg.Ollama))
+	for _, o := range cfg.Ollama {
+		endpoints = append(endpoints, ollama.Endpoint{Name: o.Name, URL: o.URL})
+	}
+	return endpoints
+}
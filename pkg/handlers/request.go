@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"unicode/utf8"
+)
+
+// maxBodyBytes - предельный размер тела запроса; промпты и формы укладываются с запасом
+const maxBodyBytes = 1 << 20
+
+// limitBody ограничивает размер тела каждого запроса
+func limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodeJSON разбирает тело запроса к прежним адресам (см. readJSON). При ошибке
+// ответ уже отправлен.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if err := readJSON(r, dst); err != nil {
+		writeError(w, err)
+		return false
+	}
+	return true
+}
+
+// readJSON строго разбирает JSON-тело запроса в dst: неизвестные поля, лишние данные
+// после объекта и слишком большое тело отклоняются
+func readJSON(r *http.Request, dst interface{}) *APIError {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return apiError(http.StatusUnsupportedMediaType, CodeUnsupportedMedia, "Неверный Content-Type. Ожидается application/json")
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(dst)
+	if err == nil && decoder.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("после JSON-объекта есть лишние данные")
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return apiError(http.StatusRequestEntityTooLarge, CodeTooLarge, fmt.Sprintf("Тело запроса больше %d байт", tooLarge.Limit))
+		}
+		log.Printf("Ошибка декодирования JSON %s: %v", r.URL.Path, err)
+		return apiError(http.StatusBadRequest, CodeInvalidJSON, "Ошибка разбора JSON").withDetails(err.Error())
+	}
+	return nil
+}
+
+// redact скрывает текст пользователя (промпт, ответ модели) в журнале; полностью он
+// выводится только при log.level: debug
+func (s *Server) redact(text string) string {
+	if s.cfg.Load().Debug() {
+		return text
+	}
+	return fmt.Sprintf("[скрыто, %d символов]", utf8.RuneCountInString(text))
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"jira-go/pkg/config"
+	"jira-go/pkg/source"
+)
+
+// Jira - запросы обработчиков к Jira. По умолчанию их выполняют функции pkg/jira
+// (source.REST); в тестах можно подставить свою реализацию через Deps.
+type Jira = source.Jira
+
+// taskSource возвращает источник задач подключения: Jira или импортированную выгрузку
+// (jira[].import), чтобы обработчикам было все равно
+func (s *Server) taskSource(instance config.JiraInstance) source.Source {
+	return source.New(instance, s.jira)
+}
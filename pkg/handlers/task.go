@@ -5,8 +5,26 @@ import (
 	"jira-go/pkg/jira"
 	"log"
 	"net/http"
+	"strings"
 )
 
+// TasksRequest - запрос задач проекта
+type TasksRequest struct {
+	ProjectKey string `json:"projectKey"`
+	Instance   string `json:"instance"`
+}
+
+// TasksResult - задачи проекта из подключения Jira. Пустой список - обычный ответ, а не ошибка.
+type TasksResult struct {
+	Tasks []jira.JiraTask `json:"tasks"`
+	Count int             `json:"count"`
+	// Total - сколько задач нашла Jira; больше Count, если получены не все (Partial)
+	Total    int    `json:"total"`
+	Partial  bool   `json:"partial"`
+	JQL      string `json:"jql"`
+	Instance string `json:"instance"`
+}
+
 /**
 * Handles the retrieval of Jira tasks for a given project.
 * This function accepts a POST request with a JSON payload containing the project key,
@@ -15,55 +33,79 @@ import (
 * @param w The HTTP response writer.
 * @param r The HTTP request object.
  */
-func getTasksHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) getTasksHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Проверяем Content-Type
-	if r.Header.Get("Content-Type") != "application/json" {
-		http.Error(w, "Неверный Content-Type. Ожидается application/json", http.StatusBadRequest)
+	var formData TasksRequest
+	if !decodeJSON(w, r, &formData) {
 		return
 	}
 
-	var formData struct {
-		ProjectKey string `json:"projectKey"`
+	result, apiErr := s.loadTasks(r, formData)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&formData); err != nil {
-		log.Printf("Ошибка декодирования JSON: %v", err)
-		http.Error(w, "Ошибка parsing JSON: "+err.Error(), http.StatusBadRequest)
-		return
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"tasks":    result.Tasks,
+		"count":    result.Count,
+		"total":    result.Total,
+		"partial":  result.Partial,
+		"jql":      result.JQL,
+		"instance": result.Instance,
+	})
+}
+
+// loadTasks получает задачи проекта с токеном пользователя и запоминает их как его
+// текущий список: по нему работают вопросы к модели и страница
+func (s *Server) loadTasks(r *http.Request, req TasksRequest) (*TasksResult, *APIError) {
+	if req.ProjectKey == "" {
+		return nil, apiError(http.StatusBadRequest, CodeBadRequest, "Ключ проекта обязателен")
+	}
+	req.ProjectKey = strings.ToUpper(strings.TrimSpace(req.ProjectKey))
+	if !jira.ValidProjectKey(req.ProjectKey) {
+		return nil, apiError(http.StatusBadRequest, CodeBadRequest, "Неверный ключ проекта, ожидаются латинские буквы, цифры и _, например PROJ")
 	}
 
-	if formData.ProjectKey == "" {
-		http.Error(w, "Ключ проекта обязателен", http.StatusBadRequest)
-		return
+	instance, err := s.jiraInstance(r, req.Instance)
+	if err != nil {
+		return nil, jiraInstanceError(err)
 	}
 
-	log.Printf("Получение задач для проекта: %s", formData.ProjectKey)
+	log.Printf("Получение задач для проекта %s из %s", req.ProjectKey, instance.Name)
 
-	tasks, err := jira.GetJiraTask(configObj.JiraURL, configObj.JiraToken, formData.ProjectKey)
+	found, err := s.taskSource(instance).ProjectTasks(req.ProjectKey)
 	if err != nil {
-		log.Printf("Ошибка получения задач: %v", err)
-		http.Error(w, "Ошибка получения задач: "+err.Error(), http.StatusInternalServerError)
-		return
+		return nil, jiraError("Ошибка получения задач", err)
 	}
+	tasks := found.Issues
 
-	mu.Lock()
-	appData.Tasks = tasks
-	appData.Error = ""
-	mu.Unlock()
+	for i := range tasks {
+		tasks[i].Instance = instance.Name
+	}
+	renderDescriptions(tasks)
 
-	log.Printf("Получено %d задач для проекта %s", len(tasks), formData.ProjectKey)
+	s.mu.Lock()
+	s.appData.Tasks[userID(r)] = tasks
+	s.appData.Error = ""
+	s.keepAnswers(userID(r), tasks)
+	s.mu.Unlock()
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"tasks":   tasks,
-		"count":   len(tasks),
-	})
+	log.Printf("Получено %d из %d задач для проекта %s", len(tasks), found.Total, req.ProjectKey)
+	return &TasksResult{
+		Tasks:    tasks,
+		Count:    len(tasks),
+		Total:    found.Total,
+		Partial:  found.Partial,
+		JQL:      found.JQL,
+		Instance: instance.Name,
+	}, nil
 }
 
 /**
@@ -74,10 +116,27 @@ func getTasksHandler(w http.ResponseWriter, r *http.Request) {
 * @param w The HTTP response writer to write the response to.
 * @param r The HTTP request object containing the request details.
  */
-func tasksHandler(w http.ResponseWriter, r *http.Request) {
-	mu.RLock()
-	defer mu.RUnlock()
-
+func (s *Server) tasksHandler(w http.ResponseWriter, r *http.Request) {
+	tasks, _ := s.currentTasks(r)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(appData.Tasks)
+	json.NewEncoder(w).Encode(tasks)
+}
+
+// currentTasks возвращает последний полученный пользователем список задач
+func (s *Server) currentTasks(r *http.Request) ([]jira.JiraTask, *APIError) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tasks := s.appData.Tasks[userID(r)]
+	if tasks == nil {
+		tasks = []jira.JiraTask{}
+	}
+	return tasks, nil
+}
+
+// renderDescriptions готовит HTML-описания задач (wiki или ADF) для вывода на странице
+func renderDescriptions(tasks []jira.JiraTask) {
+	for i := range tasks {
+		tasks[i].DescriptionHTML = tasks[i].Fields.Description.HTML()
+	}
 }
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"jira-go/pkg/auth"
+	"jira-go/pkg/config"
+	"jira-go/pkg/jira"
+	"jira-go/pkg/tokens"
+	"jira-go/pkg/upstream"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// errNoUserToken - пользователь еще не указал свой токен Jira для подключения
+var errNoUserToken = errors.New("укажите свой токен Jira (Personal Access Token)")
+
+// JiraTokenStatus - есть ли у пользователя токен для подключения Jira. Сам токен не возвращается.
+type JiraTokenStatus struct {
+	Instance   string `json:"instance"`
+	URL        string `json:"url"`
+	Configured bool   `json:"configured"`
+}
+
+// openTokenStore открывает хранилище личных токенов по настройкам auth
+func openTokenStore(cfg config.AuthConfig) (*tokens.Store, error) {
+	// Без входа запросы идут с токеном сервиса, личные токены не используются
+	if cfg.Disabled {
+		return tokens.NewStore("", nil)
+	}
+	var key []byte
+	if cfg.TokenKey != "" {
+		var err error
+		if key, err = tokens.ParseKey(cfg.TokenKey); err != nil {
+			return nil, err
+		}
+	}
+	store, err := tokens.NewStore(cfg.TokenStore, key)
+	if err != nil {
+		return nil, err
+	}
+	if !store.Persistent() {
+		log.Printf("Внимание: auth.token_store не задан, личные токены Jira хранятся в памяти до перезапуска")
+	}
+	return store, nil
+}
+
+// JiraTokens - для каких подключений у пользователя есть токен и сохраняются ли токены между запусками
+type JiraTokens struct {
+	Tokens     []JiraTokenStatus `json:"tokens"`
+	Persistent bool              `json:"persistent"`
+}
+
+// JiraTokenRequest - личный токен пользователя для подключения Jira
+type JiraTokenRequest struct {
+	Instance string `json:"instance"`
+	Token    string `json:"token"`
+}
+
+// JiraTokenResult - подключение, для которого сохранен токен, и владелец токена в Jira
+type JiraTokenResult struct {
+	Instance string     `json:"instance"`
+	JiraUser *jira.User `json:"jiraUser"`
+}
+
+// jiraTokenHandler показывает, для каких подключений у пользователя есть токен (GET),
+// сохраняет токен после проверки в Jira (POST) и удаляет его (DELETE)
+func (s *Server) jiraTokenHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		status, apiErr := s.jiraTokens(r)
+		if apiErr != nil {
+			writeError(w, apiErr)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+
+	case http.MethodPost:
+		var formData JiraTokenRequest
+		if !decodeJSON(w, r, &formData) {
+			return
+		}
+		result, apiErr := s.setJiraToken(r, formData)
+		if apiErr != nil {
+			writeError(w, apiErr)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":  true,
+			"instance": result.Instance,
+			"jiraUser": result.JiraUser,
+		})
+
+	case http.MethodDelete:
+		name := r.URL.Query().Get("instance")
+		if apiErr := s.deleteJiraToken(r, name); apiErr != nil {
+			writeError(w, apiErr)
+			return
+		}
+		instance, _ := s.cfg.Load().JiraByName(name)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "instance": instance.Name})
+
+	default:
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+	}
+}
+
+// tokenOwner возвращает вошедшего пользователя; без входа личные токены не используются
+func tokenOwner(r *http.Request) (auth.User, *APIError) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		return auth.User{}, apiError(http.StatusBadRequest, CodeBadRequest, "Вход отключен, все запросы выполняются с токеном сервиса")
+	}
+	return user, nil
+}
+
+func (s *Server) jiraTokens(r *http.Request) (*JiraTokens, *APIError) {
+	user, apiErr := tokenOwner(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	configured := map[string]bool{}
+	for _, name := range s.userTokens.Instances(user.ID()) {
+		configured[name] = true
+	}
+	statuses := []JiraTokenStatus{}
+	for _, instance := range s.cfg.Load().Jira {
+		if instance.Offline() {
+			continue
+		}
+		statuses = append(statuses, JiraTokenStatus{Instance: instance.Name, URL: instance.URL, Configured: configured[instance.Name]})
+	}
+	return &JiraTokens{Tokens: statuses, Persistent: s.userTokens.Persistent()}, nil
+}
+
+// setJiraToken проверяет токен в Jira и сохраняет его, чтобы не хранить опечатки
+func (s *Server) setJiraToken(r *http.Request, req JiraTokenRequest) (*JiraTokenResult, *APIError) {
+	user, apiErr := tokenOwner(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	req.Token = strings.TrimSpace(req.Token)
+	if req.Token == "" {
+		return nil, apiError(http.StatusBadRequest, CodeBadRequest, "Токен обязателен")
+	}
+	instance, ok := s.cfg.Load().JiraByName(req.Instance)
+	if !ok {
+		return nil, apiError(http.StatusBadRequest, CodeUnknownInstance, "Неизвестное подключение Jira: "+req.Instance)
+	}
+	if instance.Offline() {
+		return nil, apiError(http.StatusBadRequest, CodeBadRequest, "Подключение "+instance.Name+" работает с выгрузкой из файла, токен не нужен")
+	}
+
+	jiraUser, err := s.jira.Myself(r.Context(), instance.URL, req.Token)
+	if errors.Is(err, upstream.ErrUnauthorized) {
+		auth.Audit(r, "jira-token-rejected", "токен для %s не принят Jira", instance.Name)
+		return nil, apiError(http.StatusBadRequest, CodeJiraUnauthorized, "Jira не приняла токен").withUpstream(err)
+	}
+	if err != nil {
+		return nil, jiraError("Не удалось проверить токен в Jira", err)
+	}
+	if err := s.userTokens.Set(user.ID(), instance.Name, req.Token); err != nil {
+		log.Printf("Ошибка сохранения токена Jira пользователя %s: %v", user.Name, err)
+		return nil, apiError(http.StatusInternalServerError, CodeInternal, "Ошибка сохранения токена")
+	}
+	s.forgetUserIssues(user.ID())
+	auth.Audit(r, "jira-token-set", "токен для %s сохранен (пользователь Jira %s)", instance.Name, jiraUser.Name)
+	return &JiraTokenResult{Instance: instance.Name, JiraUser: jiraUser}, nil
+}
+
+func (s *Server) deleteJiraToken(r *http.Request, name string) *APIError {
+	user, apiErr := tokenOwner(r)
+	if apiErr != nil {
+		return apiErr
+	}
+	instance, ok := s.cfg.Load().JiraByName(name)
+	if !ok {
+		return apiError(http.StatusBadRequest, CodeUnknownInstance, "Неизвестное подключение Jira: "+name)
+	}
+	if err := s.userTokens.Delete(user.ID(), instance.Name); err != nil {
+		log.Printf("Ошибка удаления токена Jira пользователя %s: %v", user.Name, err)
+		return apiError(http.StatusInternalServerError, CodeInternal, "Ошибка удаления токена")
+	}
+	s.forgetUserIssues(user.ID())
+	auth.Audit(r, "jira-token-delete", "токен для %s удален", instance.Name)
+	return nil
+}
+
+// forgetUserIssues сбрасывает задачи, полученные с прежним токеном пользователя
+func (s *Server) forgetUserIssues(user string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.appData.Tasks, user)
+	for ref := range s.appData.Issues {
+		if strings.HasPrefix(ref, user+"|") {
+			delete(s.appData.Issues, ref)
+		}
+	}
+}
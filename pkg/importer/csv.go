@@ -0,0 +1,221 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"jira-go/pkg/jira"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// jiraTimeLayout - формат дат JiraTask (как в ответах Jira REST API)
+const jiraTimeLayout = "2006-01-02T15:04:05.000-0700"
+
+// csvTimeLayouts - форматы дат в CSV-выгрузке: зависят от настроек Jira и пользователя
+var csvTimeLayouts = []string{
+	"02/Jan/06 3:04 PM",
+	"2/Jan/06 3:04 PM",
+	"02/Jan/2006 3:04 PM",
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+	"02.01.2006 15:04",
+	jiraTimeLayout,
+	time.RFC3339,
+}
+
+// linkTypes - тексты направлений для стандартных типов связей Jira; в CSV есть только название типа
+var linkTypes = map[string][2]string{
+	"blocks":    {"blocks", "is blocked by"},
+	"cloners":   {"clones", "is cloned by"},
+	"duplicate": {"duplicates", "is duplicated by"},
+	"relates":   {"relates to", "relates to"},
+}
+
+// linkColumn - столбцы связей вида "Outward issue link (Blocks)"
+var linkColumn = regexp.MustCompile(`^(Inward|Outward) issue link \((.+)\)$`)
+
+// statusCategories - значения столбца Status Category и ключи категорий в API
+var statusCategories = map[string]string{
+	"to do":       "new",
+	"in progress": "indeterminate",
+	"done":        "done",
+}
+
+// doneStatuses - завершающие статусы на случай, если в выгрузке нет столбца Status Category
+var doneStatuses = map[string]bool{"done": true, "closed": true, "resolved": true, "готово": true, "закрыта": true, "закрыт": true, "решена": true}
+
+// csvRow - строка выгрузки; столбцы вроде Comment и Sprint повторяются, поэтому
+// по названию хранятся все значения
+type csvRow map[string][]string
+
+func (r csvRow) get(name string) string {
+	for _, v := range r[name] {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (r csvRow) all(name string) []string {
+	var values []string
+	for _, v := range r[name] {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// parseCSV разбирает CSV-выгрузку Jira (Export -> CSV, все или текущие поля)
+func (s *Snapshot) parseCSV(data []byte) error {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("файл пуст")
+	}
+
+	header := records[0]
+	hasKey := false
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+		hasKey = hasKey || header[i] == "Issue key"
+	}
+	if !hasKey {
+		return fmt.Errorf("нет столбца Issue key - это не CSV-выгрузка задач Jira")
+	}
+
+	rows := make([]csvRow, 0, len(records)-1)
+	// keys - ключи задач по Issue id: в Parent id выгрузка пишет id, а не ключ
+	keys := map[string]string{}
+	for n, record := range records[1:] {
+		row := csvRow{}
+		for i, value := range record {
+			if i < len(header) {
+				row[header[i]] = append(row[header[i]], value)
+			}
+		}
+		if row.get("Issue key") == "" {
+			return fmt.Errorf("строка %d: нет ключа задачи", n+2)
+		}
+		if id := row.get("Issue id"); id != "" {
+			keys[id] = row.get("Issue key")
+		}
+		rows = append(rows, row)
+	}
+
+	for _, row := range rows {
+		task, parent := csvTask(row, header)
+		// В Jira Cloud id родителя записан в столбце Parent
+		for _, column := range []string{"Parent id", "Parent"} {
+			if id := row.get(column); parent == "" && id != "" {
+				parent = keys[id]
+			}
+		}
+		s.add(task, parent, row.all("Sprint"))
+	}
+	return nil
+}
+
+func csvTask(row csvRow, header []string) (jira.JiraTask, string) {
+	var t jira.JiraTask
+	t.Key = strings.ToUpper(row.get("Issue key"))
+	f := &t.Fields
+	f.Summary = row.get("Summary")
+	f.Description = jira.Description(row.get("Description"))
+	f.Status.Name = row.get("Status")
+	f.Status.StatusCategory.Key = statusCategories[strings.ToLower(row.get("Status Category"))]
+	if f.Status.StatusCategory.Key == "" && doneStatuses[strings.ToLower(f.Status.Name)] {
+		f.Status.StatusCategory.Key = "done"
+	}
+	if resolution := row.get("Resolution"); resolution != "Unresolved" {
+		f.Resolution.Name = resolution
+	}
+	f.IssueType.Name = row.get("Issue Type")
+	f.Priority.Name = row.get("Priority")
+	f.Assignee.DisplayName = row.get("Assignee")
+	f.Created = csvTime(row.get("Created"))
+	f.Updated = csvTime(row.get("Updated"))
+	for _, name := range row.all("Component/s") {
+		f.Components = append(f.Components, jira.NamedField{Name: name})
+	}
+	for _, name := range row.all("Fix Version/s") {
+		f.FixVersions = append(f.FixVersions, jira.NamedField{Name: name})
+	}
+	for _, value := range row.all("Comment") {
+		f.Comment.Comments = append(f.Comment.Comments, csvComment(value))
+	}
+
+	seen := map[string]bool{}
+	for _, column := range header {
+		m := linkColumn.FindStringSubmatch(column)
+		if m == nil || seen[column] {
+			continue
+		}
+		seen[column] = true
+		for _, key := range row.all(column) {
+			f.IssueLinks = append(f.IssueLinks, csvLink(m[1] == "Inward", m[2], key))
+		}
+	}
+
+	parent := row.get("Custom field (Epic Link)")
+	if parent == "" {
+		parent = row.get("Epic Link")
+	}
+	if parent == "" && jira.ValidIssueKey(row.get("Parent key")) {
+		parent = row.get("Parent key")
+	}
+	return t, strings.ToUpper(parent)
+}
+
+// csvComment разбирает комментарий вида "31/Jan/24 10:15 AM;jsmith;текст"
+func csvComment(value string) jira.Comment {
+	var c jira.Comment
+	parts := strings.SplitN(value, ";", 3)
+	if len(parts) == 3 {
+		if created := csvTime(parts[0]); created != parts[0] {
+			c.Created = created
+			c.Author.DisplayName = parts[1]
+			c.Body = jira.Description(parts[2])
+			return c
+		}
+	}
+	c.Body = jira.Description(value)
+	return c
+}
+
+// csvLink создает связь: Inward - эта задача на входящей стороне (например, is blocked by key)
+func csvLink(inward bool, typeName, key string) jira.IssueLink {
+	var link jira.IssueLink
+	link.Type.Name = typeName
+	link.Type.Outward, link.Type.Inward = typeName, typeName
+	if names, ok := linkTypes[strings.ToLower(typeName)]; ok {
+		link.Type.Outward, link.Type.Inward = names[0], names[1]
+	}
+	linked := &jira.LinkedIssue{Key: strings.ToUpper(key)}
+	if inward {
+		link.InwardIssue = linked
+	} else {
+		link.OutwardIssue = linked
+	}
+	return link
+}
+
+// csvTime переводит дату из CSV в формат Jira REST API в местном часовом поясе.
+// Нераспознанная дата остается как есть.
+func csvTime(value string) string {
+	value = strings.TrimSpace(value)
+	for _, layout := range csvTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t.Format(jiraTimeLayout)
+		}
+	}
+	return value
+}
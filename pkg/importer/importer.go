@@ -0,0 +1,211 @@
+// Package importer читает задачи из выгрузки Jira (CSV или JSON), чтобы разбирать
+// снимок проекта без доступа к Jira
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"jira-go/pkg/jira"
+	"jira-go/pkg/upstream"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Snapshot - задачи из одного файла выгрузки. После загрузки не меняется, поэтому
+// им можно пользоваться из разных запросов одновременно.
+type Snapshot struct {
+	Path  string
+	tasks []jira.JiraTask
+	index map[string]int
+	// parents - эпик или родительская задача по ключу задачи
+	parents map[string]string
+	// sprints - спринты задачи; в самой JiraTask их нет
+	sprints map[string][]string
+
+	modTime time.Time
+	size    int64
+}
+
+// cache хранит загруженные файлы; файл перечитывается, если он изменился
+var cache = struct {
+	sync.Mutex
+	snapshots map[string]*Snapshot
+}{snapshots: map[string]*Snapshot{}}
+
+// Open возвращает задачи из файла выгрузки, перечитывая его только после изменения
+func Open(path string) (*Snapshot, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("файл выгрузки Jira недоступен: %v", err)
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+	if s, ok := cache.snapshots[path]; ok && s.modTime.Equal(info.ModTime()) && s.size == info.Size() {
+		return s, nil
+	}
+
+	s, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	s.modTime, s.size = info.ModTime(), info.Size()
+	cache.snapshots[path] = s
+	log.Printf("Загружено %d задач из выгрузки %s", len(s.tasks), path)
+	return s, nil
+}
+
+// Load читает выгрузку Jira. Формат определяется по расширению (.csv, .json),
+// а если его нет - по содержимому.
+func Load(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения выгрузки Jira: %v", err)
+	}
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+
+	s := &Snapshot{Path: path, index: map[string]int{}, parents: map[string]string{}, sprints: map[string][]string{}}
+	switch ext := strings.ToLower(filepath.Ext(path)); {
+	case ext == ".json", ext != ".csv" && looksLikeJSON(data):
+		err = s.parseJSON(data)
+	default:
+		err = s.parseCSV(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора выгрузки Jira %s: %v", filepath.Base(path), err)
+	}
+	s.resolveLinks()
+	return s, nil
+}
+
+func looksLikeJSON(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && (data[0] == '{' || data[0] == '[')
+}
+
+// add добавляет задачу; повторный ключ заменяет прежнюю запись
+func (s *Snapshot) add(task jira.JiraTask, parent string, sprints []string) {
+	if i, ok := s.index[task.Key]; ok {
+		s.tasks[i] = task
+	} else {
+		s.index[task.Key] = len(s.tasks)
+		s.tasks = append(s.tasks, task)
+	}
+	if parent != "" {
+		s.parents[task.Key] = parent
+	}
+	if len(sprints) > 0 {
+		s.sprints[task.Key] = sprints
+	}
+}
+
+// resolveLinks дописывает в связи заголовок и статус связанных задач, если они есть в выгрузке:
+// в CSV у связи есть только ключ
+func (s *Snapshot) resolveLinks() {
+	for i := range s.tasks {
+		for _, link := range s.tasks[i].Fields.IssueLinks {
+			for _, linked := range []*jira.LinkedIssue{link.InwardIssue, link.OutwardIssue} {
+				if linked == nil || linked.Fields.Summary != "" {
+					continue
+				}
+				if j, ok := s.index[linked.Key]; ok {
+					other := s.tasks[j]
+					linked.Fields.Summary = other.Fields.Summary
+					linked.Fields.Status.Name = other.Fields.Status.Name
+					linked.Fields.Status.StatusCategory.Key = other.Fields.Status.StatusCategory.Key
+				}
+			}
+		}
+	}
+}
+
+// Len возвращает число задач в выгрузке
+func (s *Snapshot) Len() int {
+	return len(s.tasks)
+}
+
+// Issue возвращает задачу по ключу; если ее нет в выгрузке, ошибка совпадает с upstream.ErrNotFound
+func (s *Snapshot) Issue(key string) (*jira.JiraTask, error) {
+	i, ok := s.index[key]
+	if !ok {
+		return nil, fmt.Errorf("задачи %s нет в выгрузке %s: %w", key, filepath.Base(s.Path), upstream.ErrNotFound)
+	}
+	task := s.tasks[i]
+	return &task, nil
+}
+
+// ProjectTasks возвращает незакрытые задачи проекта. В отличие от jira.GetJiraTask
+// срок создания не учитывается: выгрузка - снимок на какой-то момент в прошлом.
+func (s *Snapshot) ProjectTasks(projectKey string) *jira.SearchResult {
+	tasks := s.filter(func(t jira.JiraTask) bool {
+		return projectOf(t.Key) == projectKey && !t.Done()
+	})
+	return &jira.SearchResult{
+		Issues: tasks,
+		Total:  len(tasks),
+		JQL:    fmt.Sprintf("project = %s AND status != DONE (выгрузка %s)", projectKey, filepath.Base(s.Path)),
+	}
+}
+
+// EpicChildren возвращает задачи эпика (по Epic Link или parent)
+func (s *Snapshot) EpicChildren(epicKey string) []jira.JiraTask {
+	return s.filter(func(t jira.JiraTask) bool {
+		return s.parents[t.Key] == epicKey
+	})
+}
+
+// Resolved возвращает решенные задачи спринта или версии, как release.BuildJQL:
+// сначала по типу, затем по ключу
+func (s *Snapshot) Resolved(projectKey, sprint, fixVersion string) []jira.JiraTask {
+	tasks := s.filter(func(t jira.JiraTask) bool {
+		if projectKey != "" && projectOf(t.Key) != projectKey || t.Fields.Resolution.Name == "" {
+			return false
+		}
+		if sprint != "" {
+			return contains(s.sprints[t.Key], sprint)
+		}
+		for _, version := range t.Fields.FixVersions {
+			if strings.EqualFold(version.Name, fixVersion) {
+				return true
+			}
+		}
+		return false
+	})
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if a, b := tasks[i].Fields.IssueType.Name, tasks[j].Fields.IssueType.Name; a != b {
+			return a < b
+		}
+		return tasks[i].Key < tasks[j].Key
+	})
+	return tasks
+}
+
+// filter возвращает копии подходящих задач в порядке выгрузки; пустой результат - не nil
+func (s *Snapshot) filter(match func(jira.JiraTask) bool) []jira.JiraTask {
+	tasks := []jira.JiraTask{}
+	for _, t := range s.tasks {
+		if match(t) {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
+
+func projectOf(key string) string {
+	project, _, _ := strings.Cut(key, "-")
+	return project
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package importer
+
+import (
+	"errors"
+	"jira-go/pkg/jira"
+	"jira-go/pkg/upstream"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const exportCSV = "\ufeff" + `Summary,Issue key,Issue id,Parent id,Issue Type,Status,Status Category,Priority,Resolution,Assignee,Created,Updated,Description,Fix Version/s,Fix Version/s,Component/s,Sprint,Sprint,Comment,Comment,Outward issue link (Blocks),Inward issue link (Blocks),Custom field (Epic Link)
+Вход через SSO,PROJ-1,10001,,Epic,In Progress,In Progress,High,,Анна,31/Jan/24 10:15 AM,01/Feb/24 9:00 AM,Эпик входа,,,,,,,,,,
+Падает вход,PROJ-2,10002,,Bug,Open,To Do,Highest,Unresolved,Иван,01/Feb/24 11:00 AM,02/Feb/24 3:30 PM,"Шаги:
+# открыть страницу
+# нажать *Войти*",1.0,,Auth,Спринт 1,Спринт 2,"02/Feb/24 10:00 AM;ivan;Воспроизводится, ""всегда""",без даты,,PROJ-3,PROJ-1
+Обновить сертификат,PROJ-3,10003,,Task,Done,Done,Medium,Done,,01/Feb/24 9:00 AM,03/Feb/24 9:00 AM,,1.0,1.1,,Спринт 2,,,,PROJ-2,,
+Подзадача,PROJ-4,10004,10001,Sub-task,Closed,Done,Low,Fixed,,01/Feb/24 9:00 AM,03/Feb/24 9:00 AM,,,,,,,,,,,
+Чужая,OPS-1,20001,,Task,Open,To Do,Low,,,2024-02-01 09:00,,,,,,,,,,,,
+`
+
+const exportJSON = `{
+  "startAt": 0, "total": 3,
+  "names": {"customfield_10008": "Epic Link", "customfield_10020": "Sprint"},
+  "issues": [
+    {"key": "CLOUD-1", "fields": {"summary": "Эпик", "issuetype": {"name": "Epic"}, "status": {"name": "To Do", "statusCategory": {"key": "new"}},
+      "description": {"type": "doc", "version": 1, "content": [{"type": "paragraph", "content": [{"type": "text", "text": "ADF"}]}]}}},
+    {"key": "CLOUD-2", "fields": {"summary": "Через parent", "status": {"name": "Done", "statusCategory": {"key": "done"}}, "resolution": {"name": "Done"},
+      "parent": {"key": "CLOUD-1"}, "fixVersions": [{"name": "2.0"}],
+      "customfield_10020": [{"id": 5, "name": "Sprint 7", "state": "closed", "boardId": 1}]}},
+    {"key": "cloud-3", "fields": {"summary": "Через Epic Link", "status": {"name": "Open"}, "customfield_10008": "CLOUD-1",
+      "customfield_10021": ["com.atlassian.greenhopper.service.sprint.Sprint@1a[id=3,rapidViewId=1,state=ACTIVE,name=Sprint 8,startDate=<null>]"]}}
+  ]
+}`
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadCSV(t *testing.T) {
+	s, err := Load(writeFile(t, "export.csv", exportCSV))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Len() != 5 {
+		t.Fatalf("expected 5 tasks, got %d", s.Len())
+	}
+
+	task, err := s.Issue("PROJ-2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f := task.Fields
+	if f.Summary != "Падает вход" || f.Status.Name != "Open" || f.Status.StatusCategory.Key != "new" || f.Resolution.Name != "" || f.Priority.Name != "Highest" || f.Assignee.DisplayName != "Иван" {
+		t.Errorf("unexpected fields: %+v", f)
+	}
+	if !strings.Contains(string(f.Description), "# нажать *Войти*") {
+		t.Errorf("multiline description lost: %q", f.Description)
+	}
+	created, err := time.ParseInLocation(jiraTimeLayout, f.Created, time.Local)
+	if err != nil || created.Format("2006-01-02 15:04") != "2024-02-01 11:00" {
+		t.Errorf("unexpected created %q: %v", f.Created, err)
+	}
+	if len(f.FixVersions) != 1 || f.FixVersions[0].Name != "1.0" || len(f.Components) != 1 {
+		t.Errorf("unexpected versions or components: %+v %+v", f.FixVersions, f.Components)
+	}
+
+	comments := f.Comment.Comments
+	if len(comments) != 2 || comments[0].Author.DisplayName != "ivan" || comments[0].Body != `Воспроизводится, "всегда"` || comments[0].Created == "" {
+		t.Fatalf("unexpected comments: %+v", comments)
+	}
+	if comments[1].Body != "без даты" || comments[1].Created != "" {
+		t.Errorf("comment without date should keep the whole text: %+v", comments[1])
+	}
+
+	links := f.IssueLinks
+	if len(links) != 1 || links[0].InwardIssue == nil || links[0].InwardIssue.Key != "PROJ-3" || links[0].Type.Inward != "is blocked by" {
+		t.Fatalf("unexpected links: %+v", links)
+	}
+	if linked := links[0].InwardIssue; linked.Fields.Summary != "Обновить сертификат" || linked.Fields.Status.StatusCategory.Key != "done" {
+		t.Errorf("linked issue is not resolved from the export: %+v", linked.Fields)
+	}
+
+	if _, err := s.Issue("PROJ-99"); !errors.Is(err, upstream.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestLoadCSVErrors(t *testing.T) {
+	if _, err := Load(writeFile(t, "other.csv", "Name,Value\na,b\n")); err == nil || !strings.Contains(err.Error(), "Issue key") {
+		t.Errorf("expected missing column error, got %v", err)
+	}
+	if _, err := Load(writeFile(t, "broken.csv", "Summary,Issue key\nБез ключа,\n")); err == nil || !strings.Contains(err.Error(), "строка 2") {
+		t.Errorf("expected row error, got %v", err)
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	// Без расширения формат определяется по содержимому
+	s, err := Load(writeFile(t, "export", exportJSON))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Len() != 3 {
+		t.Fatalf("expected 3 tasks, got %d", s.Len())
+	}
+	task, err := s.Issue("CLOUD-3")
+	if err != nil {
+		t.Fatalf("key should be normalized: %v", err)
+	}
+	if task.Fields.Summary != "Через Epic Link" {
+		t.Errorf("unexpected task: %+v", task.Fields)
+	}
+	if epic, _ := s.Issue("CLOUD-1"); epic.Fields.Description.Markdown() != "ADF" {
+		t.Errorf("ADF description is not kept: %q", epic.Fields.Description)
+	}
+
+	children := s.EpicChildren("CLOUD-1")
+	if len(children) != 2 || children[0].Key != "CLOUD-2" || children[1].Key != "CLOUD-3" {
+		t.Errorf("unexpected epic children: %v", keys(children))
+	}
+	if got := keys(s.Resolved("CLOUD", "Sprint 7", "")); got != "CLOUD-2" {
+		t.Errorf("unexpected sprint issues: %s", got)
+	}
+
+	array := writeFile(t, "issues.json", `[{"key": "A-1", "fields": {"summary": "одна"}}]`)
+	if s, err := Load(array); err != nil || s.Len() != 1 {
+		t.Errorf("expected array of issues to load, got %v", err)
+	}
+	if _, err := Load(writeFile(t, "bad.json", `{"issues": [{"fields": {}}]}`)); err == nil {
+		t.Error("expected error for issue without key")
+	}
+}
+
+func TestQueries(t *testing.T) {
+	s, err := Load(writeFile(t, "export.csv", exportCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := s.ProjectTasks("PROJ")
+	if got := keys(found.Issues); got != "PROJ-1,PROJ-2" || found.Total != 2 || found.Partial {
+		t.Errorf("expected open PROJ tasks, got %s (%+v)", got, found)
+	}
+	if empty := s.ProjectTasks("NONE"); empty.Issues == nil || empty.Total != 0 {
+		t.Errorf("empty project should give an empty list, got %+v", empty)
+	}
+
+	if got := keys(s.EpicChildren("PROJ-1")); got != "PROJ-2,PROJ-4" {
+		t.Errorf("expected children by Epic Link and Parent id, got %s", got)
+	}
+	if got := keys(s.Resolved("PROJ", "", "1.0")); got != "PROJ-3" {
+		t.Errorf("expected resolved issues of version 1.0, got %s", got)
+	}
+	if got := keys(s.Resolved("", "спринт 2", "")); got != "PROJ-3" {
+		t.Errorf("expected resolved issues of sprint, got %s", got)
+	}
+
+	// Изменения задач в ответе не меняют выгрузку
+	found.Issues[0].Fields.Summary = "изменено"
+	if task, _ := s.Issue("PROJ-1"); task.Fields.Summary != "Вход через SSO" {
+		t.Error("snapshot should not be modified through results")
+	}
+}
+
+func TestOpenReloads(t *testing.T) {
+	path := writeFile(t, "export.csv", "Summary,Issue key\nПервая,A-1\n")
+	first, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := Open(path); again != first {
+		t.Error("unchanged file should be cached")
+	}
+
+	if err := os.WriteFile(path, []byte("Summary,Issue key\nПервая,A-1\nВторая,A-2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	reloaded, err := Open(path)
+	if err != nil || reloaded.Len() != 2 {
+		t.Errorf("changed file should be reloaded, got %v", err)
+	}
+
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.csv")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func keys(tasks []jira.JiraTask) string {
+	var list []string
+	for _, t := range tasks {
+		list = append(list, t.Key)
+	}
+	return strings.Join(list, ",")
+}
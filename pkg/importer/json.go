@@ -0,0 +1,106 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"jira-go/pkg/jira"
+	"regexp"
+	"strings"
+)
+
+// sprintName достает название спринта из строкового вида Jira Server:
+// com.atlassian.greenhopper.service.sprint.Sprint@1a2b[id=1,state=CLOSED,name=Спринт 1,...]
+var sprintName = regexp.MustCompile(`[\[,]name=([^,\]]*)`)
+
+// parseJSON разбирает выгрузку в JSON: ответ /rest/api/2/search ({"issues": [...]}),
+// массив задач или одну задачу
+func (s *Snapshot) parseJSON(data []byte) error {
+	var export struct {
+		Issues []json.RawMessage `json:"issues"`
+		// Names - названия полей (expand=names); по ним находятся Epic Link и Sprint
+		Names map[string]string `json:"names"`
+	}
+	switch data = bytes.TrimSpace(data); {
+	case len(data) > 0 && data[0] == '[':
+		if err := json.Unmarshal(data, &export.Issues); err != nil {
+			return err
+		}
+	default:
+		if err := json.Unmarshal(data, &export); err != nil {
+			return err
+		}
+		if export.Issues == nil {
+			export.Issues = []json.RawMessage{data}
+		}
+	}
+
+	for i, raw := range export.Issues {
+		var task jira.JiraTask
+		if err := json.Unmarshal(raw, &task); err != nil {
+			return fmt.Errorf("задача %d: %v", i+1, err)
+		}
+		if task.Key == "" {
+			return fmt.Errorf("задача %d: нет ключа", i+1)
+		}
+		task.Key = strings.ToUpper(task.Key)
+
+		var fields struct {
+			Fields map[string]json.RawMessage `json:"fields"`
+		}
+		json.Unmarshal(raw, &fields)
+		parent, sprints := jsonParent(fields.Fields, export.Names), jsonSprints(fields.Fields, export.Names)
+		s.add(task, parent, sprints)
+	}
+	return nil
+}
+
+// jsonParent возвращает ключ родителя (parent) или эпика (Epic Link, если известно имя поля)
+func jsonParent(fields map[string]json.RawMessage, names map[string]string) string {
+	var parent struct {
+		Key string `json:"key"`
+	}
+	if json.Unmarshal(fields["parent"], &parent) == nil && parent.Key != "" {
+		return strings.ToUpper(parent.Key)
+	}
+	for id, name := range names {
+		var key string
+		if strings.EqualFold(name, "Epic Link") && json.Unmarshal(fields[id], &key) == nil && key != "" {
+			return strings.ToUpper(key)
+		}
+	}
+	return ""
+}
+
+// jsonSprints возвращает названия спринтов. Поле спринта - пользовательское, поэтому оно
+// ищется по названию из names или по виду значения: объекты с boardId (Jira Cloud)
+// или строки Sprint@...[name=...] (Jira Server).
+func jsonSprints(fields map[string]json.RawMessage, names map[string]string) []string {
+	var sprints []string
+	for id, raw := range fields {
+		if !strings.HasPrefix(id, "customfield_") {
+			continue
+		}
+		var objects []struct {
+			Name    string `json:"name"`
+			BoardID *int   `json:"boardId"`
+		}
+		if json.Unmarshal(raw, &objects) == nil {
+			for _, o := range objects {
+				if o.Name != "" && (o.BoardID != nil || strings.EqualFold(names[id], "Sprint")) {
+					sprints = append(sprints, o.Name)
+				}
+			}
+			continue
+		}
+		var values []string
+		if json.Unmarshal(raw, &values) == nil {
+			for _, v := range values {
+				if m := sprintName.FindStringSubmatch(v); m != nil && strings.Contains(v, "Sprint@") {
+					sprints = append(sprints, m[1])
+				}
+			}
+		}
+	}
+	return sprints
+}
@@ -1,36 +1,242 @@
 package jira
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"jira-go/pkg/markup"
+	"jira-go/pkg/upstream"
 	"log"
 	"net/http"
+	"net/url"
+	"regexp"
+	"sync/atomic"
+	"time"
 )
 
+// timeLayout - формат дат в ответах Jira REST API
+const timeLayout = "2006-01-02T15:04:05.000-0700"
+
+// httpClient используется для всех запросов к Jira; таймаут задается через SetTimeout.
+// Клиент подменяется целиком, чтобы таймаут можно было менять при перезагрузке конфигурации.
+var httpClient atomic.Pointer[http.Client]
+
+func init() {
+	SetTimeout(30 * time.Second)
+}
+
+// SetTimeout задает таймаут запросов к Jira API
+func SetTimeout(timeout time.Duration) {
+	httpClient.Store(&http.Client{Timeout: timeout})
+}
+
+// searchPageSize - размер страницы при постраничной выборке задач
+const searchPageSize = 50
+
+// projectTasksLimit - сколько задач проекта получает GetJiraTask
+const projectTasksLimit = 100
+
 type JiraTask struct {
 	Key    string `json:"key"`
 	Fields struct {
-		Summary     string `json:"summary"`
-		Description string `json:"description"`
+		Summary     string      `json:"summary"`
+		Description Description `json:"description"`
 		Status      struct {
-			Name string `json:"name"`
+			Name           string `json:"name"`
+			StatusCategory struct {
+				Key string `json:"key"`
+			} `json:"statusCategory"`
 		} `json:"status"`
 		Resolution struct {
 			Name string `json:"name"`
 		} `json:"resolution"`
+		IssueType struct {
+			Name string `json:"name"`
+		} `json:"issuetype"`
+		Priority struct {
+			Name string `json:"name"`
+		} `json:"priority"`
+		Assignee struct {
+			DisplayName string `json:"displayName"`
+		} `json:"assignee"`
+		Components  []NamedField `json:"components"`
+		FixVersions []NamedField `json:"fixVersions"`
+		Comment     struct {
+			Comments []Comment `json:"comments"`
+		} `json:"comment"`
+		IssueLinks []IssueLink `json:"issuelinks"`
+		Created    string      `json:"created"`
+		Updated    string      `json:"updated"`
+	} `json:"fields"`
+	// DescriptionHTML заполняется при отдаче задач в интерфейс, в ответах Jira его нет
+	DescriptionHTML string `json:"descriptionHtml,omitempty"`
+	// Instance - имя подключения Jira, из которого получена задача. Ключи задач
+	// уникальны только в пределах одного экземпляра Jira.
+	Instance string `json:"instance,omitempty"`
+}
+
+// Ref возвращает ключ задачи с именем подключения, например "cloud/ABC-1"
+func (t JiraTask) Ref() string {
+	return TaskRef(t.Instance, t.Key)
+}
+
+// TaskRef объединяет имя подключения и ключ задачи в ключ, уникальный между экземплярами Jira
+func TaskRef(instance, key string) string {
+	return instance + "/" + key
+}
+
+var (
+	projectKeyPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]{0,49}$`)
+	issueKeyPattern   = regexp.MustCompile(`^[A-Z][A-Z0-9_]{0,49}-[0-9]{1,10}$`)
+)
+
+// ValidProjectKey проверяет формат ключа проекта (PROJ). Ключ подставляется в JQL,
+// поэтому все остальное отклоняется до запроса к Jira.
+func ValidProjectKey(key string) bool {
+	return projectKeyPattern.MatchString(key)
+}
+
+// ValidIssueKey проверяет формат ключа задачи (PROJ-123)
+func ValidIssueKey(key string) bool {
+	return issueKeyPattern.MatchString(key)
+}
+
+// Description - описание задачи в исходном виде: разметка wiki (Jira Server, API v2)
+// или JSON-документ ADF (Jira Cloud, API v3)
+type Description string
+
+func (d *Description) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '{' {
+		*d = Description(data)
+		return nil
+	}
+
+	var s *string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*d = ""
+	if s != nil {
+		*d = Description(*s)
+	}
+	return nil
+}
+
+// Markdown возвращает описание в Markdown для промптов модели
+func (d Description) Markdown() string {
+	return markup.ToMarkdown(string(d))
+}
+
+// HTML возвращает описание в виде безопасного HTML для страницы
+func (d Description) HTML() string {
+	return markup.ToHTML(string(d))
+}
+
+type Comment struct {
+	Author struct {
+		DisplayName string `json:"displayName"`
+	} `json:"author"`
+	Body    Description `json:"body"`
+	Created string      `json:"created"`
+}
+
+// IssueLink - связь задачи; заполнена одна из сторон, InwardIssue или OutwardIssue
+type IssueLink struct {
+	Type struct {
+		Name    string `json:"name"`
+		Inward  string `json:"inward"`
+		Outward string `json:"outward"`
+	} `json:"type"`
+	InwardIssue  *LinkedIssue `json:"inwardIssue,omitempty"`
+	OutwardIssue *LinkedIssue `json:"outwardIssue,omitempty"`
+}
+
+type LinkedIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Summary string `json:"summary"`
+		Status  struct {
+			Name           string `json:"name"`
+			StatusCategory struct {
+				Key string `json:"key"`
+			} `json:"statusCategory"`
+		} `json:"status"`
 	} `json:"fields"`
 }
 
-func GetJiraTask(JiraURL string, JiraToken string, projectKey string) ([]JiraTask, error) {
+// Done сообщает, находится ли задача в завершающем статусе
+func (t JiraTask) Done() bool {
+	return t.Fields.Status.StatusCategory.Key == "done" || t.Fields.Resolution.Name != ""
+}
+
+// ParseTime разбирает дату в формате Jira, например 2024-01-31T10:15:00.000+0300
+func ParseTime(value string) (time.Time, error) {
+	return time.Parse(timeLayout, value)
+}
+
+// NamedField - элемент справочника Jira (компонент, версия и т.п.)
+type NamedField struct {
+	Name string `json:"name"`
+}
+
+// GetJiraTask получает незакрытые задачи проекта, созданные за последнюю неделю. Пустой проект
+// - не ошибка: результат содержит пустой список и Total = 0.
+func GetJiraTask(JiraURL string, JiraToken string, projectKey string) (*SearchResult, error) {
 	log.Printf("Получение задач для проекта %s", projectKey)
+	return Search(JiraURL, JiraToken, SearchQuery{JQL: ProjectTasksJQL(projectKey), MaxResults: projectTasksLimit})
+}
+
+// ProjectTasksJQL - запрос, по которому GetJiraTask выбирает задачи проекта
+func ProjectTasksJQL(projectKey string) string {
+	return fmt.Sprintf("project = %s AND created >= startOfDay(-7) AND status != DONE", projectKey)
+}
+
+// GetIssue получает одну задачу со всеми полями, включая комментарии и связи
+func GetIssue(JiraURL string, JiraToken string, issueKey string) (*JiraTask, error) {
+	log.Printf("Получение задачи %s", issueKey)
+
+	resp, err := makeRequest("GET", JiraURL+"/rest/api/2/issue/"+url.PathEscape(issueKey), JiraToken, nil)
+	if err != nil {
+		return nil, upstream.Unavailable("Jira", err)
+	}
+	defer resp.Body.Close()
 
-	url := fmt.Sprintf(JiraURL+"/rest/api/2/search?jql=project=%s+AND+created>=startOfDay(-7)and+status!=DONE", projectKey)
-	log.Printf("Отправка запроса к Jira API: %s", url)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения тела ответа: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(resp, body)
+	}
+
+	var task JiraTask
+	if err := json.Unmarshal(body, &task); err != nil {
+		return nil, fmt.Errorf("ошибка декодирования JSON: %v", err)
+	}
+	return &task, nil
+}
+
+// User - учетная запись, от имени которой работает токен
+type User struct {
+	Name         string `json:"name"`
+	DisplayName  string `json:"displayName"`
+	EmailAddress string `json:"emailAddress"`
+}
+
+// GetMyself проверяет доступность Jira и действительность токена
+func GetMyself(JiraURL string, JiraToken string) (*User, error) {
+	return GetMyselfContext(context.Background(), JiraURL, JiraToken)
+}
 
-	resp, err := makeRequest("GET", url, JiraToken, nil)
+// GetMyselfContext работает как GetMyself; отмена ctx обрывает запрос
+func GetMyselfContext(ctx context.Context, JiraURL string, JiraToken string) (*User, error) {
+	resp, err := makeRequestContext(ctx, "GET", JiraURL+"/rest/api/2/myself", JiraToken, nil)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка отправки запроса: %v", err)
+		return nil, upstream.Unavailable("Jira", err)
 	}
 	defer resp.Body.Close()
 
@@ -40,23 +246,152 @@ func GetJiraTask(JiraURL string, JiraToken string, projectKey string) ([]JiraTas
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("Ошибка от Jira API: %s, тело ответа: %s", resp.Status, string(body))
-		return nil, fmt.Errorf("ошибка от Jira API: %s", resp.Status)
+		return nil, apiError(resp, body)
+	}
+
+	var user User
+	if err := json.Unmarshal(body, &user); err != nil {
+		return nil, fmt.Errorf("ошибка декодирования JSON: %v", err)
+	}
+	return &user, nil
+}
+
+// AddComment добавляет комментарий к задаче от имени владельца токена
+func AddComment(JiraURL string, JiraToken string, issueKey string, text string) (*Comment, error) {
+	log.Printf("Добавление комментария к задаче %s", issueKey)
+
+	payload, err := json.Marshal(map[string]string{"body": text})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации JSON: %v", err)
+	}
+
+	resp, err := makeRequest("POST", JiraURL+"/rest/api/2/issue/"+url.PathEscape(issueKey)+"/comment", JiraToken, bytes.NewReader(payload))
+	if err != nil {
+		return nil, upstream.Unavailable("Jira", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения тела ответа: %v", err)
 	}
 
-	var response struct {
-		Issues []JiraTask `json:"issues"`
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, apiError(resp, body)
 	}
 
-	if err := json.Unmarshal(body, &response); err != nil {
+	var comment Comment
+	if err := json.Unmarshal(body, &comment); err != nil {
 		return nil, fmt.Errorf("ошибка декодирования JSON: %v", err)
 	}
+	return &comment, nil
+}
+
+// SearchQuery - параметры поиска задач по JQL
+type SearchQuery struct {
+	JQL     string
+	StartAt int
+	// MaxResults - сколько задач получить; 0 - все найденные
+	MaxResults int
+}
+
+// SearchResult - найденные задачи и параметры запроса. Пустой список - не ошибка.
+type SearchResult struct {
+	Issues []JiraTask `json:"issues"`
+	// Total - сколько задач нашла Jira; может быть больше len(Issues), если выборка ограничена
+	Total      int    `json:"total"`
+	JQL        string `json:"jql"`
+	StartAt    int    `json:"startAt"`
+	MaxResults int    `json:"maxResults"`
+	// Partial - получены не все найденные задачи: сработало ограничение MaxResults
+	// или Jira вернула меньше задач, чем сообщила в total
+	Partial bool `json:"partial"`
+}
+
+// Search выполняет JQL-запрос и постранично собирает задачи, пока не получит все
+// найденные или query.MaxResults
+func Search(JiraURL string, JiraToken string, query SearchQuery) (*SearchResult, error) {
+	log.Printf("Поиск задач по JQL: %s", query.JQL)
+
+	result := &SearchResult{Issues: []JiraTask{}, JQL: query.JQL, StartAt: query.StartAt, MaxResults: query.MaxResults}
+	for startAt := query.StartAt; ; {
+		pageSize := searchPageSize
+		if query.MaxResults > 0 {
+			pageSize = min(pageSize, query.MaxResults-len(result.Issues))
+		}
+
+		params := url.Values{}
+		params.Set("jql", query.JQL)
+		params.Set("startAt", fmt.Sprint(startAt))
+		params.Set("maxResults", fmt.Sprint(pageSize))
+
+		resp, err := makeRequest("GET", JiraURL+"/rest/api/2/search?"+params.Encode(), JiraToken, nil)
+		if err != nil {
+			return nil, upstream.Unavailable("Jira", err)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения тела ответа: %v", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, apiError(resp, body)
+		}
+
+		var page struct {
+			Issues []JiraTask `json:"issues"`
+			Total  int        `json:"total"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("ошибка декодирования JSON: %v", err)
+		}
+
+		result.Issues = append(result.Issues, page.Issues...)
+		result.Total = page.Total
+		startAt += len(page.Issues)
+		if len(page.Issues) == 0 || startAt >= page.Total {
+			break
+		}
+		if query.MaxResults > 0 && len(result.Issues) >= query.MaxResults {
+			break
+		}
+	}
+	// Если в ответе нет total, считаем выборку полной
+	result.Total = max(result.Total, result.StartAt+len(result.Issues))
+	result.Partial = result.StartAt+len(result.Issues) < result.Total
+
+	log.Printf("По JQL найдено %d задач, получено %d", result.Total, len(result.Issues))
+	return result, nil
+}
+
+// SearchIssues выполняет произвольный JQL-запрос и возвращает все найденные задачи
+func SearchIssues(JiraURL string, JiraToken string, jql string) ([]JiraTask, error) {
+	result, err := Search(JiraURL, JiraToken, SearchQuery{JQL: jql})
+	if err != nil {
+		return nil, err
+	}
+	return result.Issues, nil
+}
 
-	if len(response.Issues) == 0 {
-		return nil, fmt.Errorf("не найдено задач для проекта %s", projectKey)
+// GetEpicChildren получает все задачи эпика: через поле "Epic Link" (Jira Server)
+// и через parent (Jira Cloud, team-managed проекты)
+func GetEpicChildren(JiraURL string, JiraToken string, epicKey string) ([]JiraTask, error) {
+	issues, err := SearchIssues(JiraURL, JiraToken, fmt.Sprintf(`"Epic Link" = %s OR parent = %s`, epicKey, epicKey))
+	if errors.Is(err, upstream.ErrBadRequest) {
+		// На инстансах без поля "Epic Link" JQL с ним не проходит валидацию
+		log.Printf("Поиск по \"Epic Link\" не удался, ищем только по parent: %v", err)
+		return SearchIssues(JiraURL, JiraToken, fmt.Sprintf("parent = %s", epicKey))
 	}
+	return issues, err
+}
 
-	return response.Issues, nil
+// apiError пишет неуспешный ответ Jira в журнал и возвращает *upstream.Error
+// с сообщениями из errorMessages
+func apiError(resp *http.Response, body []byte) error {
+	log.Printf("Ошибка от Jira API: %s, тело ответа: %s", resp.Status, string(body))
+	return upstream.FromResponse("Jira", resp, body)
 }
 
 // makeRequest creates and executes an HTTP request with optional authorization and content-type headers.
@@ -67,7 +402,12 @@ func GetJiraTask(JiraURL string, JiraToken string, projectKey string) ([]JiraTas
 // @param body The body of the request (optional).
 // @return The HTTP response and any error encountered during the request.
 func makeRequest(method, url, token string, body io.Reader) (*http.Response, error) {
-	req, err := http.NewRequest(method, url, body)
+	return makeRequestContext(context.Background(), method, url, token, body)
+}
+
+// makeRequestContext работает как makeRequest; отмена ctx обрывает запрос
+func makeRequestContext(ctx context.Context, method, url, token string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
@@ -79,6 +419,5 @@ func makeRequest(method, url, token string, body io.Reader) (*http.Response, err
 		req.Header.Set("Content-Type", "application/json")
 	}
 
-	client := &http.Client{}
-	return client.Do(req)
+	return httpClient.Load().Do(req)
 }
@@ -1,8 +1,13 @@
 package jira
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jira-go/pkg/upstream"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -19,6 +24,7 @@ func TestGetJiraTask(t *testing.T) {
 			name:       "Successful response with tasks",
 			projectKey: "TEST",
 			mockResponse: `{
+				"total": 2,
 				"issues": [
 					{
 						"key": "TEST-1",
@@ -63,15 +69,16 @@ func TestGetJiraTask(t *testing.T) {
 		{
 			name:           "No issues in response",
 			projectKey:     "TEST",
-			mockResponse:   `{"issues":[]}`,
+			mockResponse:   `{"total": 0, "issues": []}`,
 			mockStatusCode: http.StatusOK,
-			expectError:    true,
+			expectError:    false,
 			expectedCount:  0,
 		},
 		{
 			name:       "Malformed issues structure",
 			projectKey: "TEST",
 			mockResponse: `{
+				"total": 1,
 				"issues": [
 					{
 						"key": "TEST-1",
@@ -92,10 +99,10 @@ func TestGetJiraTask(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create test server
 			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				// Verify the request URL contains the project key
-				expectedURL := "/rest/api/2/search?jql=project=" + tt.projectKey + "+AND+created>=startOfDay()"
-				if r.URL.String() != expectedURL {
-					t.Errorf("expected URL %s, got %s", expectedURL, r.URL.String())
+				// Verify the request JQL contains the project key
+				expectedJQL := "project = " + tt.projectKey + " AND created >= startOfDay(-7) AND status != DONE"
+				if r.URL.Path != "/rest/api/2/search" || r.URL.Query().Get("jql") != expectedJQL {
+					t.Errorf("expected JQL %s, got %s", expectedJQL, r.URL.String())
 				}
 
 				w.WriteHeader(tt.mockStatusCode)
@@ -104,7 +111,7 @@ func TestGetJiraTask(t *testing.T) {
 			defer server.Close()
 
 			// Call function
-			tasks, err := GetJiraTask(server.URL, "test-token", tt.projectKey)
+			result, err := GetJiraTask(server.URL, "test-token", tt.projectKey)
 
 			// Check error expectation
 			if tt.expectError {
@@ -120,10 +127,14 @@ func TestGetJiraTask(t *testing.T) {
 			}
 
 			// Check tasks count
-			if len(tasks) != tt.expectedCount {
-				t.Errorf("expected %d tasks, got %d", tt.expectedCount, len(tasks))
+			tasks := result.Issues
+			if tasks == nil || len(tasks) != tt.expectedCount || result.Total != tt.expectedCount {
+				t.Errorf("expected %d tasks, got %d (total %d)", tt.expectedCount, len(tasks), result.Total)
 				return
 			}
+			if result.Partial {
+				t.Error("expected complete result")
+			}
 
 			// Check task structure for successful cases
 			if tt.expectedCount > 0 {
@@ -198,11 +209,12 @@ func TestJiraTaskStructure(t *testing.T) {
 	}))
 	defer server.Close()
 
-	tasks, err := GetJiraTask(server.URL, "test-token", "TEST")
+	result, err := GetJiraTask(server.URL, "test-token", "TEST")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
+	tasks := result.Issues
 	if len(tasks) != 1 {
 		t.Fatalf("expected 1 task, got %d", len(tasks))
 	}
@@ -224,3 +236,380 @@ func TestJiraTaskStructure(t *testing.T) {
 		t.Errorf("expected resolution 'Fixed', got '%s'", task.Fields.Resolution.Name)
 	}
 }
+
+func TestSearchIssues(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if jql := r.URL.Query().Get("jql"); jql != `fixVersion = "1.0" AND resolution IS NOT EMPTY` {
+			t.Errorf("unexpected jql: %s", jql)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		switch r.URL.Query().Get("startAt") {
+		case "0":
+			w.Write([]byte(`{"total": 3, "issues": [
+				{"key": "TEST-1", "fields": {"summary": "One", "issuetype": {"name": "Bug"}, "components": [{"name": "API"}]}},
+				{"key": "TEST-2", "fields": {"summary": "Two", "fixVersions": [{"name": "1.0"}]}}
+			]}`))
+		case "2":
+			w.Write([]byte(`{"total": 3, "issues": [{"key": "TEST-3", "fields": {"summary": "Three"}}]}`))
+		default:
+			t.Errorf("unexpected startAt: %s", r.URL.Query().Get("startAt"))
+		}
+	}))
+	defer server.Close()
+
+	issues, err := SearchIssues(server.URL, "test-token", `fixVersion = "1.0" AND resolution IS NOT EMPTY`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 page requests, got %d", requests)
+	}
+	if len(issues) != 3 {
+		t.Fatalf("expected 3 issues, got %d", len(issues))
+	}
+	if issues[0].Fields.IssueType.Name != "Bug" || issues[0].Fields.Components[0].Name != "API" {
+		t.Errorf("issue type or components not decoded: %+v", issues[0].Fields)
+	}
+	if issues[1].Fields.FixVersions[0].Name != "1.0" {
+		t.Errorf("fix versions not decoded: %+v", issues[1].Fields)
+	}
+}
+
+// searchServer отдает total задач постранично, как Jira; returned - сколько из них Jira
+// действительно отдает (меньше total, если у пользователя нет прав на часть задач)
+func searchServer(t *testing.T, total, returned int) (*httptest.Server, *[]string) {
+	t.Helper()
+	var pages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		pages = append(pages, query.Get("startAt")+"/"+query.Get("maxResults"))
+		var startAt, maxResults int
+		fmt.Sscan(query.Get("startAt"), &startAt)
+		fmt.Sscan(query.Get("maxResults"), &maxResults)
+
+		issues := []map[string]interface{}{}
+		for i := startAt; i < returned && i < startAt+maxResults; i++ {
+			issues = append(issues, map[string]interface{}{
+				"key":    fmt.Sprintf("TEST-%d", i+1),
+				"fields": map[string]interface{}{"summary": fmt.Sprintf("Task %d", i+1)},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"total": total, "startAt": startAt, "issues": issues})
+	}))
+	t.Cleanup(server.Close)
+	return server, &pages
+}
+
+func TestSearchEmpty(t *testing.T) {
+	server, pages := searchServer(t, 0, 0)
+
+	result, err := Search(server.URL, "test-token", SearchQuery{JQL: "project = EMPTY"})
+	if err != nil {
+		t.Fatalf("empty result must not be an error: %v", err)
+	}
+	if result.Issues == nil || len(result.Issues) != 0 || result.Total != 0 || result.Partial {
+		t.Errorf("unexpected empty result: %+v", result)
+	}
+	if result.JQL != "project = EMPTY" || len(*pages) != 1 {
+		t.Errorf("unexpected query metadata %+v after pages %v", result, *pages)
+	}
+}
+
+func TestSearchPaginated(t *testing.T) {
+	server, pages := searchServer(t, 120, 120)
+
+	result, err := Search(server.URL, "test-token", SearchQuery{JQL: "project = TEST"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Issues) != 120 || result.Total != 120 || result.Partial {
+		t.Errorf("expected all 120 issues, got %d of %d (partial %v)", len(result.Issues), result.Total, result.Partial)
+	}
+	if result.Issues[119].Key != "TEST-120" {
+		t.Errorf("unexpected last issue %s", result.Issues[119].Key)
+	}
+	if strings.Join(*pages, ",") != "0/50,50/50,100/50" {
+		t.Errorf("unexpected pages: %v", *pages)
+	}
+}
+
+func TestSearchPartial(t *testing.T) {
+	t.Run("limited by MaxResults", func(t *testing.T) {
+		server, pages := searchServer(t, 120, 120)
+
+		result, err := Search(server.URL, "test-token", SearchQuery{JQL: "project = TEST", StartAt: 10, MaxResults: 60})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(result.Issues) != 60 || result.Total != 120 || !result.Partial {
+			t.Errorf("expected partial 60 of 120, got %d of %d (partial %v)", len(result.Issues), result.Total, result.Partial)
+		}
+		if result.Issues[0].Key != "TEST-11" || result.StartAt != 10 || result.MaxResults != 60 {
+			t.Errorf("unexpected result metadata: first %s, %+v", result.Issues[0].Key, result)
+		}
+		if strings.Join(*pages, ",") != "10/50,60/10" {
+			t.Errorf("unexpected pages: %v", *pages)
+		}
+	})
+
+	t.Run("Jira returns fewer issues than total", func(t *testing.T) {
+		server, pages := searchServer(t, 80, 55)
+
+		result, err := Search(server.URL, "test-token", SearchQuery{JQL: "project = TEST"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(result.Issues) != 55 || result.Total != 80 || !result.Partial {
+			t.Errorf("expected partial 55 of 80, got %d of %d (partial %v)", len(result.Issues), result.Total, result.Partial)
+		}
+		// После пустой страницы запросы прекращаются
+		if strings.Join(*pages, ",") != "0/50,50/50,55/50" {
+			t.Errorf("unexpected pages: %v", *pages)
+		}
+	})
+
+	t.Run("project tasks are capped", func(t *testing.T) {
+		server, _ := searchServer(t, 250, 250)
+
+		result, err := GetJiraTask(server.URL, "test-token", "TEST")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(result.Issues) != projectTasksLimit || result.Total != 250 || !result.Partial {
+			t.Errorf("expected %d of 250, got %d of %d", projectTasksLimit, len(result.Issues), result.Total)
+		}
+	})
+}
+
+func TestDescriptionFormats(t *testing.T) {
+	var issues []JiraTask
+	err := json.Unmarshal([]byte(`[
+		{"key": "WIKI-1", "fields": {"description": "h1. Title\n*bold*"}},
+		{"key": "ADF-1", "fields": {"description": {"type": "doc", "version": 1, "content": [
+			{"type": "paragraph", "content": [{"type": "text", "text": "bold", "marks": [{"type": "strong"}]}]}
+		]}}},
+		{"key": "NULL-1", "fields": {"description": null}}
+	]`), &issues)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if md := issues[0].Fields.Description.Markdown(); md != "# Title\n\n**bold**" {
+		t.Errorf("unexpected wiki markdown: %q", md)
+	}
+	if md := issues[1].Fields.Description.Markdown(); md != "**bold**" {
+		t.Errorf("unexpected ADF markdown: %q", md)
+	}
+	if html := issues[1].Fields.Description.HTML(); html != "<p><strong>bold</strong></p>" {
+		t.Errorf("unexpected ADF html: %q", html)
+	}
+	if issues[2].Fields.Description != "" {
+		t.Errorf("expected empty description for null, got %q", issues[2].Fields.Description)
+	}
+}
+
+func TestGetIssue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/issue/TEST-1" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorMessages":["Issue Does Not Exist"]}`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{
+			"key": "TEST-1",
+			"fields": {
+				"summary": "Test Summary",
+				"comment": {"comments": [{"author": {"displayName": "Anna"}, "body": "LGTM", "created": "2024-01-01T10:00:00.000+0000"}]},
+				"issuelinks": [{"type": {"name": "Blocks", "inward": "is blocked by", "outward": "blocks"}, "inwardIssue": {"key": "TEST-2", "fields": {"summary": "Other", "status": {"name": "Open"}}}}]
+			}
+		}`))
+	}))
+	defer server.Close()
+
+	task, err := GetIssue(server.URL, "test-token", "TEST-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(task.Fields.Comment.Comments) != 1 || task.Fields.Comment.Comments[0].Author.DisplayName != "Anna" {
+		t.Errorf("comments not decoded: %+v", task.Fields.Comment)
+	}
+	if len(task.Fields.IssueLinks) != 1 || task.Fields.IssueLinks[0].InwardIssue.Key != "TEST-2" || task.Fields.IssueLinks[0].OutwardIssue != nil {
+		t.Errorf("issue links not decoded: %+v", task.Fields.IssueLinks)
+	}
+
+	if _, err := GetIssue(server.URL, "test-token", "TEST-404"); err == nil {
+		t.Error("expected error for missing issue but got none")
+	}
+}
+
+func TestGetEpicChildren(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jql := r.URL.Query().Get("jql")
+		queries = append(queries, jql)
+		if strings.Contains(jql, "Epic Link") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errorMessages":["Field 'Epic Link' does not exist"]}`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"total": 1, "issues": [{"key": "TEST-2", "fields": {"summary": "Child", "status": {"name": "Done", "statusCategory": {"key": "done"}}}}]}`))
+	}))
+	defer server.Close()
+
+	children, err := GetEpicChildren(server.URL, "test-token", "TEST-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(children) != 1 || !children[0].Done() {
+		t.Errorf("unexpected children: %+v", children)
+	}
+	expected := []string{`"Epic Link" = TEST-1 OR parent = TEST-1`, "parent = TEST-1"}
+	if strings.Join(queries, ";") != strings.Join(expected, ";") {
+		t.Errorf("expected queries %v, got %v", expected, queries)
+	}
+}
+
+func TestGetMyself(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/myself" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer good-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"name": "jdoe", "displayName": "John Doe"}`))
+	}))
+	defer server.Close()
+
+	user, err := GetMyself(server.URL, "good-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.Name != "jdoe" || user.DisplayName != "John Doe" {
+		t.Errorf("unexpected user: %+v", user)
+	}
+
+	if _, err := GetMyself(server.URL, "bad-token"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected 401 error, got %v", err)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/api/2/myself":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/rest/api/2/issue/TEST-404":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorMessages":["Issue Does Not Exist"],"errors":{}}`))
+		case "/rest/api/2/search":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errorMessages":["The value 'NOPE' does not exist for the field 'project'."],"errors":{"jql":"bad query"}}`))
+		case "/rest/api/2/issue/TEST-1/comment":
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("<html>maintenance</html>"))
+		}
+	}))
+	defer server.Close()
+
+	_, err := GetMyself(server.URL, "bad-token")
+	if !errors.Is(err, upstream.ErrUnauthorized) {
+		t.Errorf("expected unauthorized, got %v", err)
+	}
+
+	_, err = GetIssue(server.URL, "token", "TEST-404")
+	if !errors.Is(err, upstream.ErrNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+	if e, ok := upstream.As(err); !ok || e.Status != http.StatusNotFound || strings.Join(e.Messages, ";") != "Issue Does Not Exist" {
+		t.Errorf("expected decoded errorMessages, got %#v", err)
+	}
+
+	_, err = SearchIssues(server.URL, "token", "project = NOPE")
+	if !errors.Is(err, upstream.ErrBadRequest) {
+		t.Errorf("expected bad request, got %v", err)
+	}
+	expected := "ошибка от Jira API: 400 Bad Request: The value 'NOPE' does not exist for the field 'project'.; jql: bad query"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+
+	_, err = AddComment(server.URL, "token", "TEST-1", "text")
+	if e, ok := upstream.As(err); !ok || !errors.Is(err, upstream.ErrRateLimited) || e.RetryAfter.Seconds() != 7 {
+		t.Errorf("expected rate limit with Retry-After, got %#v", err)
+	}
+
+	_, err = GetIssue(server.URL, "token", "TEST-1")
+	if e, ok := upstream.As(err); !ok || !errors.Is(err, upstream.ErrUpstreamUnavailable) || e.Body != "<html>maintenance</html>" {
+		t.Errorf("expected unavailable with body, got %#v", err)
+	}
+
+	server.Close()
+	if _, err := GetIssue(server.URL, "token", "TEST-1"); !errors.Is(err, upstream.ErrUpstreamUnavailable) {
+		t.Errorf("expected unavailable for closed server, got %v", err)
+	}
+}
+
+func TestAddComment(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/rest/api/2/issue/TEST-1/comment" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var payload struct {
+			Body string `json:"body"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"author":  map[string]string{"displayName": "John Doe"},
+			"body":    payload.Body,
+			"created": "2024-01-01T10:00:00.000+0000",
+		})
+	}))
+	defer server.Close()
+
+	comment, err := AddComment(server.URL, "token", "TEST-1", "Ответ модели")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if comment.Author.DisplayName != "John Doe" || comment.Body.Markdown() != "Ответ модели" {
+		t.Errorf("unexpected comment: %+v", comment)
+	}
+}
+
+func TestValidKeys(t *testing.T) {
+	for key, want := range map[string]bool{
+		"PROJ":            true,
+		"AB_2":            true,
+		"proj":            false,
+		"2PROJ":           false,
+		"PROJ OR 1=1":     false,
+		"PROJ\" OR key=X": false,
+		"":                false,
+	} {
+		if got := ValidProjectKey(key); got != want {
+			t.Errorf("ValidProjectKey(%q) = %v, want %v", key, got, want)
+		}
+	}
+	for key, want := range map[string]bool{
+		"PROJ-123": true,
+		"A-1":      true,
+		"PROJ-":    false,
+		"PROJ":     false,
+		"proj-1":   false,
+		"PROJ-1 ":  false,
+	} {
+		if got := ValidIssueKey(key); got != want {
+			t.Errorf("ValidIssueKey(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
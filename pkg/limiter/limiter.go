@@ -0,0 +1,304 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultHold - предполагаемое время одного запроса, пока нет замеров; нужно для Retry-After
+const defaultHold = 30 * time.Second
+
+// Config - ограничения очереди
+type Config struct {
+	// PerKey - сколько запросов с одним ключом выполняется одновременно; 0 - без ограничения
+	PerKey int
+	// MaxQueue - сколько запросов с одним ключом может ждать; при переполнении возвращается BusyError
+	MaxQueue int
+}
+
+// BusyError - запрос отклонен, потому что очередь заполнена или превышен лимит пользователя
+type BusyError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("%s, повторите через %v", e.Reason, e.RetryAfter.Round(time.Second))
+}
+
+// Position - место ожидающего запроса в очереди
+type Position struct {
+	Key      string    `json:"key"`
+	Position int       `json:"position"`
+	Queued   int       `json:"queued"`
+	Since    time.Time `json:"since"`
+}
+
+// KeyStats - состояние очереди одного ключа
+type KeyStats struct {
+	Key    string `json:"key"`
+	Active int    `json:"active"`
+	Limit  int    `json:"limit"`
+	Queued int    `json:"queued"`
+}
+
+type clientKey struct{}
+
+// WithClient добавляет в контекст имя клиента, по которому очередь чередует запросы
+func WithClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// Client возвращает имя клиента из контекста
+func Client(ctx context.Context) string {
+	client, _ := ctx.Value(clientKey{}).(string)
+	return client
+}
+
+type waiter struct {
+	client string
+	since  time.Time
+	ready  chan struct{}
+}
+
+type queue struct {
+	active int
+	// clients - клиенты с ожидающими запросами в порядке обслуживания: после выдачи места
+	// клиент уходит в конец, поэтому один клиент не может занять всю очередь
+	clients []string
+	waiting map[string][]*waiter
+	// hold - скользящее среднее времени выполнения запроса
+	hold time.Duration
+}
+
+func (q *queue) queued() int {
+	n := 0
+	for _, w := range q.waiting {
+		n += len(w)
+	}
+	return n
+}
+
+// Limiter ограничивает число одновременных запросов по ключу (например, сервер и модель)
+// и выдает освободившиеся места ожидающим клиентам по очереди
+type Limiter struct {
+	mu     sync.Mutex
+	cfg    Config
+	queues map[string]*queue
+}
+
+// New создает Limiter
+func New(cfg Config) *Limiter {
+	return &Limiter{cfg: cfg, queues: map[string]*queue{}}
+}
+
+// SetConfig меняет ограничения; если мест стало больше, ожидающие запросы сразу получают их
+func (l *Limiter) SetConfig(cfg Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = cfg
+	for _, q := range l.queues {
+		l.grant(q)
+	}
+}
+
+// TryAcquire занимает место без ожидания. Если кто-то уже ждет, место не выдается,
+// чтобы не обходить очередь.
+func (l *Limiter) TryAcquire(key string) (release func(), ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	q := l.queue(key)
+	if !l.free(q) || q.queued() > 0 {
+		return nil, false
+	}
+	q.active++
+	return l.releaser(q), true
+}
+
+// Acquire занимает место, при необходимости дожидаясь своей очереди. Клиент берется из
+// контекста (WithClient). Если очередь заполнена, сразу возвращается *BusyError;
+// если контекст отменен во время ожидания - ошибка контекста.
+func (l *Limiter) Acquire(ctx context.Context, key string) (release func(), err error) {
+	l.mu.Lock()
+	q := l.queue(key)
+	if l.free(q) && q.queued() == 0 {
+		q.active++
+		l.mu.Unlock()
+		return l.releaser(q), nil
+	}
+	if queued := q.queued(); queued >= l.cfg.MaxQueue {
+		retry := l.retryAfter(q, queued)
+		l.mu.Unlock()
+		return nil, &BusyError{Reason: "очередь к " + key + " заполнена", RetryAfter: retry}
+	}
+
+	client := Client(ctx)
+	w := &waiter{client: client, since: time.Now(), ready: make(chan struct{})}
+	if len(q.waiting[client]) == 0 {
+		q.clients = append(q.clients, client)
+	}
+	q.waiting[client] = append(q.waiting[client], w)
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return l.releaser(q), nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		select {
+		case <-w.ready:
+			// Место выдано одновременно с отменой - возвращаем его следующему
+			q.active--
+			l.grant(q)
+		default:
+			l.remove(q, w)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Waiting возвращает места в очереди для запросов клиента
+func (l *Limiter) Waiting(client string) []Position {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var result []Position
+	for key, q := range l.queues {
+		own := q.waiting[client]
+		if len(own) == 0 {
+			continue
+		}
+		k := indexOf(q.clients, client)
+		queued := q.queued()
+		for i, w := range own {
+			// Очередь обслуживает клиентов по кругу: до i-го запроса клиента каждый клиент
+			// впереди него успеет получить i+1 мест, а каждый позади - i
+			position := i + 1
+			for j, other := range q.clients {
+				if j == k {
+					continue
+				}
+				turns := i
+				if j < k {
+					turns++
+				}
+				position += min(len(q.waiting[other]), turns)
+			}
+			result = append(result, Position{Key: key, Position: position, Queued: queued, Since: w.since})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Since.Before(result[j].Since) })
+	return result
+}
+
+// Stats возвращает состояние всех очередей
+func (l *Limiter) Stats() []KeyStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := make([]KeyStats, 0, len(l.queues))
+	for key, q := range l.queues {
+		result = append(result, KeyStats{Key: key, Active: q.active, Limit: l.cfg.PerKey, Queued: q.queued()})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
+
+func (l *Limiter) queue(key string) *queue {
+	q, ok := l.queues[key]
+	if !ok {
+		q = &queue{waiting: map[string][]*waiter{}}
+		l.queues[key] = q
+	}
+	return q
+}
+
+func (l *Limiter) free(q *queue) bool {
+	return l.cfg.PerKey <= 0 || q.active < l.cfg.PerKey
+}
+
+// releaser возвращает функцию освобождения места. Очереди ключей не удаляются: ключей
+// немного (сервер и модель), а замеры времени нужны для оценки Retry-After.
+func (l *Limiter) releaser(q *queue) func() {
+	start := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			held := time.Since(start)
+			if q.hold == 0 {
+				q.hold = held
+			} else {
+				q.hold = (q.hold*4 + held) / 5
+			}
+			q.active--
+			l.grant(q)
+		})
+	}
+}
+
+// grant выдает свободные места ожидающим, по одному запросу каждого клиента по кругу
+func (l *Limiter) grant(q *queue) {
+	for l.free(q) && len(q.clients) > 0 {
+		client := q.clients[0]
+		w := q.waiting[client][0]
+		q.waiting[client] = q.waiting[client][1:]
+		q.clients = q.clients[1:]
+		if len(q.waiting[client]) > 0 {
+			q.clients = append(q.clients, client)
+		} else {
+			delete(q.waiting, client)
+		}
+		q.active++
+		close(w.ready)
+	}
+}
+
+func (l *Limiter) remove(q *queue, w *waiter) {
+	own := q.waiting[w.client]
+	for i, other := range own {
+		if other == w {
+			own = append(own[:i], own[i+1:]...)
+			break
+		}
+	}
+	if len(own) > 0 {
+		q.waiting[w.client] = own
+		return
+	}
+	delete(q.waiting, w.client)
+	if i := indexOf(q.clients, w.client); i >= 0 {
+		q.clients = append(q.clients[:i], q.clients[i+1:]...)
+	}
+}
+
+// retryAfter оценивает, когда в очереди освободится место
+func (l *Limiter) retryAfter(q *queue, queued int) time.Duration {
+	hold := q.hold
+	if hold == 0 {
+		hold = defaultHold
+	}
+	slots := l.cfg.PerKey
+	if slots <= 0 {
+		slots = 1
+	}
+	retry := hold * time.Duration(queued+1) / time.Duration(slots)
+	if retry < time.Second {
+		retry = time.Second
+	}
+	return retry
+}
+
+func indexOf(list []string, value string) int {
+	for i, v := range list {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
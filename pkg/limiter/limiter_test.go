@@ -0,0 +1,131 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func acquireAsync(l *Limiter, ctx context.Context, client string) <-chan func() {
+	granted := make(chan func(), 1)
+	go func() {
+		release, err := l.Acquire(WithClient(ctx, client), "host/model")
+		if err == nil {
+			granted <- release
+		}
+		close(granted)
+	}()
+	return granted
+}
+
+// waitQueued ждет, пока в очереди окажется n запросов
+func waitQueued(t *testing.T, l *Limiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		for _, s := range l.Stats() {
+			if s.Queued == n {
+				return
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("queue did not reach %d: %+v", n, l.Stats())
+}
+
+func TestLimiterFairQueue(t *testing.T) {
+	l := New(Config{PerKey: 1, MaxQueue: 10})
+	ctx := context.Background()
+
+	release, err := l.Acquire(WithClient(ctx, "alice"), "host/model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.TryAcquire("host/model"); ok {
+		t.Fatal("TryAcquire must fail when the key is busy")
+	}
+
+	// alice ставит в очередь два запроса, затем bob - один
+	a1 := acquireAsync(l, ctx, "alice")
+	waitQueued(t, l, 1)
+	a2 := acquireAsync(l, ctx, "alice")
+	waitQueued(t, l, 2)
+	b1 := acquireAsync(l, ctx, "bob")
+	waitQueued(t, l, 3)
+
+	if got := l.Waiting("bob"); len(got) != 1 || got[0].Position != 2 {
+		t.Errorf("bob must be second in line, got %+v", got)
+	}
+
+	// Места выдаются по кругу: alice, bob, снова alice
+	release()
+	r := <-a1
+	r()
+	r = <-b1
+	if r == nil {
+		t.Fatal("bob must be served before alice's second request")
+	}
+	select {
+	case <-a2:
+		t.Fatal("alice's second request served out of turn")
+	default:
+	}
+	r()
+	(<-a2)()
+
+	if s := l.Stats(); s[0].Active != 0 || s[0].Queued != 0 {
+		t.Errorf("expected empty queue, got %+v", s)
+	}
+}
+
+func TestLimiterQueueFull(t *testing.T) {
+	l := New(Config{PerKey: 1, MaxQueue: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	release, _ := l.Acquire(ctx, "host/model")
+	waiting := acquireAsync(l, ctx, "alice")
+	waitQueued(t, l, 1)
+
+	_, err := l.Acquire(ctx, "host/model")
+	var busy *BusyError
+	if !errors.As(err, &busy) || busy.RetryAfter < time.Second {
+		t.Fatalf("expected BusyError with Retry-After, got %v", err)
+	}
+
+	// Отмененный запрос уходит из очереди
+	cancel()
+	if r := <-waiting; r != nil {
+		t.Fatal("cancelled request must not get a slot")
+	}
+	waitQueued(t, l, 0)
+	release()
+	if _, ok := l.TryAcquire("host/model"); !ok {
+		t.Error("slot must be free after release")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	r := NewRate(6, 2)
+	r.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if err := r.Allow("alice"); err != nil {
+			t.Fatalf("request %d within burst rejected: %v", i, err)
+		}
+	}
+	err := r.Allow("alice")
+	var busy *BusyError
+	if !errors.As(err, &busy) || busy.RetryAfter != 10*time.Second {
+		t.Fatalf("expected retry after 10s, got %v", err)
+	}
+	if err := r.Allow("bob"); err != nil {
+		t.Errorf("other clients must not be limited: %v", err)
+	}
+
+	now = now.Add(10 * time.Second)
+	if err := r.Allow("alice"); err != nil {
+		t.Errorf("token must be restored after 10s: %v", err)
+	}
+}
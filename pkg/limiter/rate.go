@@ -0,0 +1,77 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// maxBuckets - после стольких клиентов полные (давно не использованные) корзины удаляются
+const maxBuckets = 1000
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter ограничивает частоту запросов каждого клиента (алгоритм token bucket):
+// клиент может сделать burst запросов подряд, дальше - perMinute запросов в минуту
+type RateLimiter struct {
+	mu        sync.Mutex
+	perMinute int
+	burst     int
+	buckets   map[string]*bucket
+	now       func() time.Time
+}
+
+// NewRate создает RateLimiter; perMinute <= 0 отключает ограничение
+func NewRate(perMinute, burst int) *RateLimiter {
+	return &RateLimiter{perMinute: perMinute, burst: burst, buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// SetRate меняет ограничение; накопленные запросы клиентов сохраняются
+func (r *RateLimiter) SetRate(perMinute, burst int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.perMinute, r.burst = perMinute, burst
+}
+
+// Allow расходует один запрос клиента или возвращает *BusyError со временем,
+// через которое запрос станет доступен
+func (r *RateLimiter) Allow(client string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.perMinute <= 0 {
+		return nil
+	}
+
+	now := r.now()
+	burst := float64(max(r.burst, 1))
+	rate := float64(r.perMinute) / float64(time.Minute)
+
+	b, ok := r.buckets[client]
+	if !ok {
+		if len(r.buckets) >= maxBuckets {
+			r.cleanup(now, burst, rate)
+		}
+		b = &bucket{tokens: burst, last: now}
+		r.buckets[client] = b
+	}
+	b.tokens = min(burst, b.tokens+float64(now.Sub(b.last))*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate)
+		return &BusyError{Reason: "слишком много запросов к модели", RetryAfter: max(wait, time.Second)}
+	}
+	b.tokens--
+	return nil
+}
+
+// cleanup удаляет корзины клиентов, которые успели полностью восстановиться
+func (r *RateLimiter) cleanup(now time.Time, burst, rate float64) {
+	for client, b := range r.buckets {
+		if b.tokens+float64(now.Sub(b.last))*rate >= burst {
+			delete(r.buckets, client)
+		}
+	}
+}
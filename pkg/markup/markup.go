@@ -0,0 +1,444 @@
+package markup
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Node - узел документа в формате Atlassian Document Format (ADF).
+// Разметка Jira wiki разбирается в такое же дерево, поэтому оба формата
+// выводятся одними и теми же функциями.
+type Node struct {
+	Type    string                 `json:"type"`
+	Text    string                 `json:"text,omitempty"`
+	Attrs   map[string]interface{} `json:"attrs,omitempty"`
+	Marks   []Mark                 `json:"marks,omitempty"`
+	Content []*Node                `json:"content,omitempty"`
+}
+
+type Mark struct {
+	Type  string                 `json:"type"`
+	Attrs map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// IsADF определяет, является ли строка JSON-документом ADF (Jira Cloud, API v3)
+func IsADF(s string) bool {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") {
+		return false
+	}
+	var probe struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal([]byte(s), &probe) == nil && probe.Type == "doc"
+}
+
+// ParseADF разбирает документ ADF
+func ParseADF(data []byte) (*Node, error) {
+	var doc Node
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("ошибка декодирования ADF: %v", err)
+	}
+	if doc.Type != "doc" {
+		return nil, fmt.Errorf("неожиданный корневой узел ADF: %q", doc.Type)
+	}
+	dropNil(&doc)
+	return &doc, nil
+}
+
+// dropNil убирает пустые узлы (null в массиве content), чтобы их не приходилось
+// проверять при выводе
+func dropNil(n *Node) {
+	content := n.Content[:0]
+	for _, child := range n.Content {
+		if child != nil {
+			dropNil(child)
+			content = append(content, child)
+		}
+	}
+	n.Content = content
+}
+
+// Parse разбирает описание задачи: ADF, если это JSON-документ, иначе разметку Jira wiki
+func Parse(s string) *Node {
+	if IsADF(s) {
+		if doc, err := ParseADF([]byte(s)); err == nil {
+			return doc
+		}
+	}
+	return ParseWiki(s)
+}
+
+// ToMarkdown переводит описание (wiki или ADF) в Markdown для промпта модели
+func ToMarkdown(s string) string {
+	return Parse(s).Markdown()
+}
+
+// ToPlainText переводит описание (wiki или ADF) в простой текст без разметки
+func ToPlainText(s string) string {
+	return Parse(s).PlainText()
+}
+
+// ToHTML переводит описание (wiki или ADF) в безопасный HTML для страницы
+func ToHTML(s string) string {
+	return Parse(s).HTML()
+}
+
+// Markdown выводит документ в Markdown
+func (n *Node) Markdown() string {
+	r := &renderer{format: formatMarkdown}
+	return strings.TrimSpace(r.blocks(n.Content, ""))
+}
+
+// PlainText выводит документ простым текстом
+func (n *Node) PlainText() string {
+	r := &renderer{format: formatPlain}
+	return strings.TrimSpace(r.blocks(n.Content, ""))
+}
+
+// HTML выводит документ в HTML. Весь текст экранируется, а ссылки допускаются
+// только со схемами http, https и mailto.
+func (n *Node) HTML() string {
+	var b strings.Builder
+	htmlBlocks(&b, n.Content)
+	return b.String()
+}
+
+const (
+	formatMarkdown = iota
+	formatPlain
+)
+
+type renderer struct {
+	format int
+}
+
+func (r *renderer) blocks(nodes []*Node, prefix string) string {
+	var parts []string
+	for _, n := range nodes {
+		if s := r.block(n, prefix); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func (r *renderer) block(n *Node, prefix string) string {
+	md := r.format == formatMarkdown
+
+	switch n.Type {
+	case "paragraph":
+		return r.inlines(n.Content)
+	case "heading":
+		text := r.inlines(n.Content)
+		if !md {
+			return text
+		}
+		return strings.Repeat("#", clamp(intAttr(n, "level", 1), 1, 6)) + " " + text
+	case "bulletList", "orderedList":
+		return r.list(n, "")
+	case "codeBlock":
+		code := textContent(n)
+		if !md {
+			return code
+		}
+		return "```" + stringAttr(n, "language") + "\n" + code + "\n```"
+	case "blockquote", "panel":
+		inner := r.blocks(n.Content, prefix)
+		if !md {
+			return inner
+		}
+		lines := strings.Split(inner, "\n")
+		for i, l := range lines {
+			lines[i] = strings.TrimRight("> "+l, " ")
+		}
+		return strings.Join(lines, "\n")
+	case "rule":
+		if !md {
+			return ""
+		}
+		return "---"
+	case "table":
+		return r.table(n)
+	case "mediaSingle", "mediaGroup", "media":
+		return "[вложение]"
+	default:
+		if len(n.Content) > 0 && isBlock(n.Content[0]) {
+			return r.blocks(n.Content, prefix)
+		}
+		return strings.TrimSpace(r.inline(n))
+	}
+}
+
+func (r *renderer) list(n *Node, indent string) string {
+	var lines []string
+	for i, item := range n.Content {
+		marker := "- "
+		if n.Type == "orderedList" {
+			marker = fmt.Sprintf("%d. ", i+1)
+		}
+
+		var text []string
+		var nested []string
+		for _, child := range item.Content {
+			if child.Type == "bulletList" || child.Type == "orderedList" {
+				nested = append(nested, r.list(child, indent+"  "))
+			} else {
+				text = append(text, r.block(child, ""))
+			}
+		}
+		lines = append(lines, indent+marker+strings.Join(text, " "))
+		lines = append(lines, nested...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *renderer) table(n *Node) string {
+	var rows [][]string
+	for _, row := range n.Content {
+		var cells []string
+		for _, cell := range row.Content {
+			text := strings.ReplaceAll(r.blocks(cell.Content, ""), "\n", " ")
+			cells = append(cells, strings.ReplaceAll(text, "|", `\|`))
+		}
+		rows = append(rows, cells)
+	}
+	if len(rows) == 0 {
+		return ""
+	}
+
+	var lines []string
+	for i, cells := range rows {
+		if r.format == formatPlain {
+			lines = append(lines, strings.Join(cells, "\t"))
+			continue
+		}
+		lines = append(lines, "| "+strings.Join(cells, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", len(cells)))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *renderer) inlines(nodes []*Node) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		b.WriteString(r.inline(n))
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func (r *renderer) inline(n *Node) string {
+	switch n.Type {
+	case "text":
+		return r.marked(n.Text, n.Marks)
+	case "hardBreak":
+		return "\n"
+	case "mention":
+		return "@" + strings.TrimPrefix(stringAttr(n, "text"), "@")
+	case "emoji":
+		if text := stringAttr(n, "text"); text != "" {
+			return text
+		}
+		return stringAttr(n, "shortName")
+	case "inlineCard":
+		return stringAttr(n, "url")
+	case "status":
+		return "[" + stringAttr(n, "text") + "]"
+	case "date":
+		return stringAttr(n, "timestamp")
+	default:
+		if len(n.Content) > 0 {
+			return r.inlines(n.Content)
+		}
+		return n.Text
+	}
+}
+
+func (r *renderer) marked(text string, marks []Mark) string {
+	if r.format == formatPlain || text == "" {
+		return text
+	}
+	for _, m := range marks {
+		switch m.Type {
+		case "strong":
+			text = "**" + text + "**"
+		case "em":
+			text = "_" + text + "_"
+		case "code":
+			text = "`" + text + "`"
+		case "strike":
+			text = "~~" + text + "~~"
+		case "link":
+			if href, _ := m.Attrs["href"].(string); href != "" {
+				text = "[" + text + "](" + href + ")"
+			}
+		}
+	}
+	return text
+}
+
+var htmlMarks = map[string]string{
+	"strong":    "strong",
+	"em":        "em",
+	"code":      "code",
+	"strike":    "del",
+	"underline": "u",
+}
+
+var safeLanguage = regexp.MustCompile(`^[A-Za-z0-9_+-]+$`)
+
+func htmlBlocks(b *strings.Builder, nodes []*Node) {
+	for _, n := range nodes {
+		htmlBlock(b, n)
+	}
+}
+
+func htmlBlock(b *strings.Builder, n *Node) {
+	switch n.Type {
+	case "paragraph":
+		b.WriteString("<p>")
+		htmlInlines(b, n.Content)
+		b.WriteString("</p>")
+	case "heading":
+		level := clamp(intAttr(n, "level", 1), 1, 6)
+		fmt.Fprintf(b, "<h%d>", level)
+		htmlInlines(b, n.Content)
+		fmt.Fprintf(b, "</h%d>", level)
+	case "bulletList":
+		wrap(b, "ul", n.Content)
+	case "orderedList":
+		wrap(b, "ol", n.Content)
+	case "listItem":
+		b.WriteString("<li>")
+		for _, child := range n.Content {
+			if child.Type == "paragraph" {
+				htmlInlines(b, child.Content)
+			} else {
+				htmlBlock(b, child)
+			}
+		}
+		b.WriteString("</li>")
+	case "codeBlock":
+		b.WriteString("<pre><code")
+		if lang := stringAttr(n, "language"); safeLanguage.MatchString(lang) {
+			b.WriteString(` class="language-` + lang + `"`)
+		}
+		b.WriteString(">" + html.EscapeString(textContent(n)) + "</code></pre>")
+	case "blockquote", "panel":
+		wrap(b, "blockquote", n.Content)
+	case "rule":
+		b.WriteString("<hr>")
+	case "table":
+		wrap(b, "table", n.Content)
+	case "tableRow":
+		wrap(b, "tr", n.Content)
+	case "tableHeader":
+		wrap(b, "th", n.Content)
+	case "tableCell":
+		wrap(b, "td", n.Content)
+	case "mediaSingle", "mediaGroup", "media":
+		b.WriteString("<p><em>[вложение]</em></p>")
+	default:
+		if len(n.Content) > 0 && isBlock(n.Content[0]) {
+			htmlBlocks(b, n.Content)
+			return
+		}
+		htmlInline(b, n)
+	}
+}
+
+func wrap(b *strings.Builder, tag string, nodes []*Node) {
+	b.WriteString("<" + tag + ">")
+	htmlBlocks(b, nodes)
+	b.WriteString("</" + tag + ">")
+}
+
+func htmlInlines(b *strings.Builder, nodes []*Node) {
+	for _, n := range nodes {
+		htmlInline(b, n)
+	}
+}
+
+func htmlInline(b *strings.Builder, n *Node) {
+	switch n.Type {
+	case "text":
+		text := html.EscapeString(n.Text)
+		for _, m := range n.Marks {
+			if tag, ok := htmlMarks[m.Type]; ok {
+				text = "<" + tag + ">" + text + "</" + tag + ">"
+			} else if m.Type == "link" {
+				if href, _ := m.Attrs["href"].(string); safeURL(href) {
+					text = `<a href="` + html.EscapeString(href) + `" target="_blank" rel="noopener noreferrer">` + text + "</a>"
+				}
+			}
+		}
+		b.WriteString(text)
+	case "hardBreak":
+		b.WriteString("<br>")
+	case "inlineCard":
+		url := stringAttr(n, "url")
+		if safeURL(url) {
+			b.WriteString(`<a href="` + html.EscapeString(url) + `" target="_blank" rel="noopener noreferrer">` + html.EscapeString(url) + "</a>")
+		}
+	default:
+		if len(n.Content) > 0 {
+			htmlInlines(b, n.Content)
+			return
+		}
+		r := &renderer{format: formatPlain}
+		b.WriteString(html.EscapeString(r.inline(n)))
+	}
+}
+
+func safeURL(u string) bool {
+	lower := strings.ToLower(strings.TrimSpace(u))
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "mailto:")
+}
+
+func isBlock(n *Node) bool {
+	switch n.Type {
+	case "paragraph", "heading", "bulletList", "orderedList", "listItem", "codeBlock", "blockquote",
+		"panel", "rule", "table", "tableRow", "tableHeader", "tableCell", "mediaSingle", "mediaGroup":
+		return true
+	}
+	return false
+}
+
+func textContent(n *Node) string {
+	var b strings.Builder
+	b.WriteString(n.Text)
+	for _, c := range n.Content {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
+
+func stringAttr(n *Node, name string) string {
+	v, _ := n.Attrs[name].(string)
+	return v
+}
+
+func intAttr(n *Node, name string, def int) int {
+	switch v := n.Attrs[name].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return def
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
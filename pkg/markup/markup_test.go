@@ -0,0 +1,154 @@
+package markup
+
+import (
+	"strings"
+	"testing"
+)
+
+const wikiSample = `h2. Проблема
+Пользователи *не могут* войти на _production_.
+Логи: {{auth.log}}
+
+* шаг один
+** вложенный шаг
+* шаг [два|https://example.com/step]
+# первый
+# второй
+
+{code:java}
+String s = "*not bold*";
+{code}
+
+||Поле||Значение||
+|Статус|[ссылка|http://x.io/a]|
+
+bq. цитата -зачеркнуто-
+----
+[~jdoe] well-known_snake_case`
+
+const adfSample = `{
+	"type": "doc",
+	"version": 1,
+	"content": [
+		{"type": "heading", "attrs": {"level": 3}, "content": [{"type": "text", "text": "Шаги"}]},
+		{"type": "paragraph", "content": [
+			{"type": "text", "text": "Откройте "},
+			{"type": "text", "text": "страницу", "marks": [{"type": "link", "attrs": {"href": "https://example.com"}}]},
+			{"type": "hardBreak"},
+			{"type": "text", "text": "<script>", "marks": [{"type": "strong"}]},
+			{"type": "mention", "attrs": {"text": "@Иван"}}
+		]},
+		{"type": "bulletList", "content": [
+			{"type": "listItem", "content": [{"type": "paragraph", "content": [{"type": "text", "text": "пункт"}]}]}
+		]},
+		{"type": "codeBlock", "attrs": {"language": "go"}, "content": [{"type": "text", "text": "x := 1"}]},
+		{"type": "paragraph", "content": [
+			{"type": "text", "text": "плохая ссылка", "marks": [{"type": "link", "attrs": {"href": "javascript:alert(1)"}}]}
+		]}
+	]
+}`
+
+func TestWikiToMarkdown(t *testing.T) {
+	expected := strings.Join([]string{
+		"## Проблема",
+		"",
+		"Пользователи **не могут** войти на _production_.",
+		"Логи: `auth.log`",
+		"",
+		"- шаг один",
+		"  - вложенный шаг",
+		"- шаг [два](https://example.com/step)",
+		"",
+		"1. первый",
+		"2. второй",
+		"",
+		"```java",
+		`String s = "*not bold*";`,
+		"```",
+		"",
+		"| Поле | Значение |",
+		"| --- | --- |",
+		"| Статус | [ссылка](http://x.io/a) |",
+		"",
+		"> цитата ~~зачеркнуто~~",
+		"",
+		"---",
+		"",
+		"@jdoe well-known_snake_case",
+	}, "\n")
+
+	if got := ToMarkdown(wikiSample); got != expected {
+		t.Errorf("unexpected markdown:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestWikiToHTML(t *testing.T) {
+	got := ToHTML("h1. <b>Title</b>\n*bold* and [link|javascript:alert(1)]\n{code:js\"onload}x < y{code}")
+
+	for _, want := range []string{
+		"<h1>&lt;b&gt;Title&lt;/b&gt;</h1>",
+		"<strong>bold</strong>",
+		"[link|javascript:alert(1)]",
+		"<pre><code>x &lt; y</code></pre>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in %s", want, got)
+		}
+	}
+	if strings.Contains(got, "<a ") || strings.Contains(got, "<b>") {
+		t.Errorf("unsafe markup leaked into HTML: %s", got)
+	}
+}
+
+func TestADF(t *testing.T) {
+	if !IsADF(adfSample) {
+		t.Fatal("expected sample to be detected as ADF")
+	}
+	if IsADF(`{"type": "paragraph"}`) || IsADF("h1. Title") {
+		t.Error("non-ADF input detected as ADF")
+	}
+
+	md := ToMarkdown(adfSample)
+	for _, want := range []string{"### Шаги", "Откройте [страницу](https://example.com)\n**<script>**@Иван", "- пункт", "```go\nx := 1\n```"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected %q in markdown:\n%s", want, md)
+		}
+	}
+
+	html := ToHTML(adfSample)
+	for _, want := range []string{
+		"<h3>Шаги</h3>",
+		`<a href="https://example.com" target="_blank" rel="noopener noreferrer">страницу</a><br><strong>&lt;script&gt;</strong>@Иван`,
+		"<ul><li>пункт</li></ul>",
+		`<pre><code class="language-go">x := 1</code></pre>`,
+		"<p>плохая ссылка</p>",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected %q in html:\n%s", want, html)
+		}
+	}
+
+	plain := ToPlainText(adfSample)
+	if strings.Contains(plain, "**") || !strings.Contains(plain, "Шаги\n\nОткройте страницу") {
+		t.Errorf("unexpected plain text:\n%s", plain)
+	}
+}
+
+func TestParseADFErrors(t *testing.T) {
+	if _, err := ParseADF([]byte(`{"type": "paragraph"}`)); err == nil {
+		t.Error("expected error for non-doc root")
+	}
+	if _, err := ParseADF([]byte(`{invalid`)); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+}
+
+func TestADFNullContent(t *testing.T) {
+	doc := `{"type": "doc", "content": [null, {"type": "paragraph", "content": [null, {"type": "text", "text": "Текст"}]}, {"type": "bulletList", "content": [null]}]}`
+	if md := ToMarkdown(doc); md != "Текст" {
+		t.Errorf("unexpected markdown %q", md)
+	}
+	if html := ToHTML(doc); !strings.Contains(html, "<p>Текст</p>") {
+		t.Errorf("unexpected HTML %q", html)
+	}
+}
@@ -0,0 +1,375 @@
+package markup
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	wikiHeading   = regexp.MustCompile(`^h([1-6])\.\s*(.*)$`)
+	wikiList      = regexp.MustCompile(`^\s*([*#-]+)\s+(.*)$`)
+	wikiRule      = regexp.MustCompile(`^-{4,}\s*$`)
+	wikiBlockOpen = regexp.MustCompile(`^\{(code|noformat|quote|panel)(?::([^}]*))?\}(.*)$`)
+)
+
+// inlineRule - правило разбора строчной разметки wiki
+type inlineRule struct {
+	re      *regexp.Regexp
+	mark    string
+	bounded bool // разметка должна стоять на границе слова (*bold*, _em_ и т.п.)
+	handle  func(p []string, marks []Mark) []*Node
+}
+
+var inlineRules []inlineRule
+
+func init() {
+	// Порядок важен: при совпадении позиций побеждает правило, стоящее раньше
+	inlineRules = []inlineRule{
+		{re: regexp.MustCompile(`\{\{(.+?)\}\}`), handle: func(p []string, marks []Mark) []*Node {
+			return []*Node{textNode(p[1], withMark(marks, Mark{Type: "code"}))}
+		}},
+		{re: regexp.MustCompile(`\{color(?::[^}]*)?\}(.*?)\{color\}`), handle: func(p []string, marks []Mark) []*Node {
+			return parseInline(p[1], marks)
+		}},
+		{re: regexp.MustCompile(`\[([^\[\]]+)\]`), handle: wikiLink},
+		{re: regexp.MustCompile(`\\\\`), handle: func(p []string, marks []Mark) []*Node {
+			return []*Node{{Type: "hardBreak"}}
+		}},
+		{re: regexp.MustCompile(`!([^!\s|][^!|]*)(?:\|[^!]*)?!`), bounded: true, handle: func(p []string, marks []Mark) []*Node {
+			return []*Node{textNode("[вложение: "+p[1]+"]", marks)}
+		}},
+		{re: regexp.MustCompile(`\*([^*\s]|[^*\s][^*]*[^*\s])\*`), mark: "strong", bounded: true},
+		{re: regexp.MustCompile(`_([^_\s]|[^_\s][^_]*[^_\s])_`), mark: "em", bounded: true},
+		{re: regexp.MustCompile(`\?\?([^?\s]|[^?\s].*?[^?\s])\?\?`), mark: "em", bounded: true},
+		{re: regexp.MustCompile(`-([^-\s]|[^-\s][^-]*[^-\s])-`), mark: "strike", bounded: true},
+		{re: regexp.MustCompile(`\+([^+\s]|[^+\s][^+]*[^+\s])\+`), mark: "underline", bounded: true},
+		{re: regexp.MustCompile(`\^([^^\s]|[^^\s][^^]*[^^\s])\^`), bounded: true},
+		{re: regexp.MustCompile(`~([^~\s]|[^~\s][^~]*[^~\s])~`), bounded: true},
+	}
+}
+
+// ParseWiki разбирает разметку Jira wiki (Jira Server, API v2) в дерево ADF
+func ParseWiki(s string) *Node {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	return &Node{Type: "doc", Content: parseBlocks(lines)}
+}
+
+func parseBlocks(lines []string) []*Node {
+	var nodes []*Node
+	var paragraph []string
+
+	flush := func() {
+		if len(paragraph) > 0 {
+			nodes = append(nodes, paragraphNode(paragraph))
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			flush()
+
+		case wikiBlockOpen.MatchString(trimmed):
+			flush()
+			m := wikiBlockOpen.FindStringSubmatch(trimmed)
+			inner, next := collectBlock(lines, i, m[1], m[3])
+			i = next
+			switch m[1] {
+			case "code", "noformat":
+				node := &Node{Type: "codeBlock", Content: []*Node{{Type: "text", Text: strings.Join(inner, "\n")}}}
+				if lang := codeLanguage(m[2]); m[1] == "code" && lang != "" {
+					node.Attrs = map[string]interface{}{"language": lang}
+				}
+				nodes = append(nodes, node)
+			case "quote":
+				nodes = append(nodes, &Node{Type: "blockquote", Content: parseBlocks(inner)})
+			case "panel":
+				nodes = append(nodes, &Node{Type: "panel", Content: parseBlocks(inner)})
+			}
+
+		case strings.HasPrefix(trimmed, "bq. "):
+			flush()
+			nodes = append(nodes, &Node{Type: "blockquote", Content: []*Node{paragraphNode([]string{trimmed[4:]})}})
+
+		case wikiHeading.MatchString(trimmed):
+			flush()
+			m := wikiHeading.FindStringSubmatch(trimmed)
+			nodes = append(nodes, &Node{
+				Type:    "heading",
+				Attrs:   map[string]interface{}{"level": float64(m[1][0] - '0')},
+				Content: parseInline(m[2], nil),
+			})
+
+		case wikiRule.MatchString(trimmed):
+			flush()
+			nodes = append(nodes, &Node{Type: "rule"})
+
+		case wikiList.MatchString(line):
+			flush()
+			// Список продолжается, пока строки начинаются с того же маркера верхнего уровня
+			var items []listLine
+			for ; i < len(lines) && wikiList.MatchString(lines[i]) && !wikiRule.MatchString(strings.TrimSpace(lines[i])); i++ {
+				m := wikiList.FindStringSubmatch(lines[i])
+				if len(items) > 0 && m[1][0] != items[0].markers[0] {
+					break
+				}
+				items = append(items, listLine{markers: m[1], text: m[2]})
+			}
+			i--
+			nodes = append(nodes, buildList(items, 1))
+
+		case strings.HasPrefix(trimmed, "|"):
+			flush()
+			table := &Node{Type: "table"}
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "|"); i++ {
+				table.Content = append(table.Content, tableRow(strings.TrimSpace(lines[i])))
+			}
+			i--
+			nodes = append(nodes, table)
+
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+	return nodes
+}
+
+// collectBlock собирает строки до закрывающего тега {name}; возвращает содержимое
+// и индекс последней строки блока
+func collectBlock(lines []string, start int, name, rest string) ([]string, int) {
+	closing := "{" + name + "}"
+	if idx := strings.Index(rest, closing); idx >= 0 {
+		return []string{rest[:idx]}, start
+	}
+
+	var inner []string
+	if strings.TrimSpace(rest) != "" {
+		inner = append(inner, rest)
+	}
+	for i := start + 1; i < len(lines); i++ {
+		if idx := strings.Index(lines[i], closing); idx >= 0 {
+			if before := lines[i][:idx]; strings.TrimSpace(before) != "" {
+				inner = append(inner, before)
+			}
+			return inner, i
+		}
+		inner = append(inner, lines[i])
+	}
+	return inner, len(lines) - 1
+}
+
+// codeLanguage извлекает язык из параметров {code:java} или {code:language=java|title=...}
+func codeLanguage(params string) string {
+	for _, p := range strings.Split(params, "|") {
+		p = strings.TrimSpace(p)
+		if strings.HasPrefix(p, "language=") {
+			return strings.TrimPrefix(p, "language=")
+		}
+		if p != "" && !strings.Contains(p, "=") {
+			return p
+		}
+	}
+	return ""
+}
+
+type listLine struct {
+	markers string
+	text    string
+}
+
+func buildList(items []listLine, depth int) *Node {
+	list := &Node{Type: listType(items[0].markers, depth)}
+	for i := 0; i < len(items); {
+		if len(items[i].markers) <= depth {
+			list.Content = append(list.Content, &Node{Type: "listItem", Content: []*Node{paragraphNode([]string{items[i].text})}})
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(items) && len(items[j].markers) > depth {
+			j++
+		}
+		if len(list.Content) == 0 {
+			list.Content = append(list.Content, &Node{Type: "listItem"})
+		}
+		last := list.Content[len(list.Content)-1]
+		last.Content = append(last.Content, buildList(items[i:j], depth+1))
+		i = j
+	}
+	return list
+}
+
+func listType(markers string, depth int) string {
+	if depth <= len(markers) && markers[depth-1] == '#' {
+		return "orderedList"
+	}
+	return "bulletList"
+}
+
+// tableRow разбирает строку таблицы вида ||заголовок||заголовок|| или |ячейка|ячейка|,
+// не разрывая ссылки [текст|url] и моноширинный текст {{...}}
+func tableRow(line string) *Node {
+	row := &Node{Type: "tableRow"}
+	var cell strings.Builder
+	cellType := ""
+	depth := 0
+
+	closeCell := func() {
+		if cellType != "" {
+			row.Content = append(row.Content, &Node{Type: cellType, Content: []*Node{paragraphNode([]string{strings.TrimSpace(cell.String())})}})
+		}
+		cell.Reset()
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '[' || c == '{':
+			depth++
+		case (c == ']' || c == '}') && depth > 0:
+			depth--
+		case c == '|' && depth == 0:
+			closeCell()
+			cellType = "tableCell"
+			if i+1 < len(line) && line[i+1] == '|' {
+				cellType = "tableHeader"
+				i++
+			}
+			continue
+		}
+		cell.WriteByte(c)
+	}
+	if strings.TrimSpace(cell.String()) != "" {
+		closeCell()
+	}
+	return row
+}
+
+func paragraphNode(lines []string) *Node {
+	p := &Node{Type: "paragraph"}
+	for i, l := range lines {
+		if i > 0 {
+			p.Content = append(p.Content, &Node{Type: "hardBreak"})
+		}
+		p.Content = append(p.Content, parseInline(l, nil)...)
+	}
+	return p
+}
+
+// parseInline разбирает строчную разметку: на каждом шаге берется самое раннее совпадение
+// среди всех правил, текст до него остается обычным, а содержимое разбирается рекурсивно
+func parseInline(s string, marks []Mark) []*Node {
+	var nodes []*Node
+	for s != "" {
+		bestStart, bestRule := -1, -1
+		var bestMatch []int
+		for ri, rule := range inlineRules {
+			for _, m := range rule.re.FindAllStringSubmatchIndex(s, -1) {
+				if bestStart >= 0 && m[0] >= bestStart {
+					break
+				}
+				if rule.bounded && !atBoundary(s, m[0], m[1]) {
+					continue
+				}
+				bestStart, bestRule, bestMatch = m[0], ri, m
+				break
+			}
+		}
+
+		if bestRule < 0 {
+			nodes = appendText(nodes, s, marks)
+			break
+		}
+
+		nodes = appendText(nodes, s[:bestStart], marks)
+		parts := make([]string, len(bestMatch)/2)
+		for k := range parts {
+			if bestMatch[2*k] >= 0 {
+				parts[k] = s[bestMatch[2*k]:bestMatch[2*k+1]]
+			}
+		}
+
+		rule := inlineRules[bestRule]
+		switch {
+		case rule.handle != nil:
+			nodes = append(nodes, rule.handle(parts, marks)...)
+		case rule.mark != "":
+			nodes = append(nodes, parseInline(parts[1], withMark(marks, Mark{Type: rule.mark}))...)
+		default:
+			nodes = append(nodes, parseInline(parts[1], marks)...)
+		}
+		s = s[bestMatch[1]:]
+	}
+	return nodes
+}
+
+// wikiLink обрабатывает [url], [текст|url], [~user] и [^attachment]
+func wikiLink(p []string, marks []Mark) []*Node {
+	body := p[1]
+	switch {
+	case strings.HasPrefix(body, "~"):
+		return []*Node{{Type: "mention", Attrs: map[string]interface{}{"text": "@" + body[1:]}}}
+	case strings.HasPrefix(body, "^"):
+		return []*Node{textNode("[вложение: "+body[1:]+"]", marks)}
+	}
+
+	text, href := body, body
+	if idx := strings.LastIndex(body, "|"); idx >= 0 {
+		text, href = body[:idx], strings.TrimSpace(body[idx+1:])
+	}
+	if !strings.Contains(href, "://") && !strings.HasPrefix(href, "mailto:") {
+		return []*Node{textNode(p[0], marks)}
+	}
+	link := Mark{Type: "link", Attrs: map[string]interface{}{"href": href}}
+	return parseInline(text, withMark(marks, link))
+}
+
+func atBoundary(s string, start, end int) bool {
+	if start > 0 && isWordChar(lastRune(s[:start])) {
+		return false
+	}
+	if end < len(s) && isWordChar(firstRune(s[end:])) {
+		return false
+	}
+	return true
+}
+
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func firstRune(s string) rune {
+	for _, r := range s {
+		return r
+	}
+	return 0
+}
+
+func lastRune(s string) rune {
+	r := []rune(s)
+	return r[len(r)-1]
+}
+
+func appendText(nodes []*Node, text string, marks []Mark) []*Node {
+	if text == "" {
+		return nodes
+	}
+	return append(nodes, textNode(text, marks))
+}
+
+func textNode(text string, marks []Mark) *Node {
+	return &Node{Type: "text", Text: text, Marks: marks}
+}
+
+func withMark(marks []Mark, m Mark) []Mark {
+	out := make([]Mark, 0, len(marks)+1)
+	out = append(out, marks...)
+	return append(out, m)
+}
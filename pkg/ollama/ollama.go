@@ -2,15 +2,36 @@ package ollama
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"jira-go/models"
+	"jira-go/pkg/upstream"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// httpClient используется для всех запросов к Ollama; генерация может идти долго,
+// поэтому таймаут по умолчанию больше, чем у Jira
+var httpClient atomic.Pointer[http.Client]
+
+func init() {
+	SetTimeout(5 * time.Minute)
+}
+
+// SetTimeout задает таймаут запросов к Ollama API
+func SetTimeout(timeout time.Duration) {
+	httpClient.Store(&http.Client{Timeout: timeout})
+}
+
+// DefaultNumCtx - размер контекста, который Ollama использует, если в Modelfile не задан num_ctx
+const DefaultNumCtx = 2048
+
 type OllamaModel struct {
 	Details struct {
 		Families          []string `json:"families"`
@@ -27,38 +48,56 @@ type OllamaModel struct {
 	Size       int       `json:"size"`
 }
 
-// sendOllamaMessage - отправка сообщения в модель Ollama
-func SendOllamaMessage(OllamaHost string, model string, messages []models.Message) (string, error) {
-	log.Printf("Отправка сообщения в модель %s", model)
+// ChatOptions - параметры генерации; незаданные Ollama берет из Modelfile модели
+type ChatOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+}
 
+// chatBody собирает тело запроса к /api/chat; options передаются, только если что-то задано
+func chatBody(model string, messages []models.Message, opts ChatOptions, stream bool) map[string]interface{} {
 	data := map[string]interface{}{
 		"model":    model,
 		"messages": messages,
-		"stream":   false,
+		"stream":   stream,
 	}
+	if opts != (ChatOptions{}) {
+		data["options"] = opts
+	}
+	return data
+}
+
+// sendOllamaMessage - отправка сообщения в модель Ollama
+func SendOllamaMessage(OllamaHost string, model string, messages []models.Message) (string, error) {
+	return SendOllamaMessageContext(context.Background(), OllamaHost, model, messages, ChatOptions{})
+}
+
+// SendOllamaMessageContext отправляет сообщения в модель с параметрами генерации opts;
+// отмена ctx обрывает запрос, и Ollama прекращает генерацию
+func SendOllamaMessageContext(ctx context.Context, OllamaHost string, model string, messages []models.Message, opts ChatOptions) (string, error) {
+	log.Printf("Отправка сообщения в модель %s", model)
+
+	data := chatBody(model, messages, opts, false)
 
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return "", fmt.Errorf("ошибка сериализации JSON: %v", err)
 	}
 
-	url := fmt.Sprintf("%s/api/chat", OllamaHost)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	url := fmt.Sprintf("%s/api/chat", baseURL(OllamaHost))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", fmt.Errorf("ошибка создания запроса: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpClient.Load().Do(req)
 	if err != nil {
-		return "", fmt.Errorf("ошибка отправки запроса: %v", err)
+		return "", upstream.Unavailable("Ollama", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("ошибка от API: %s, %s", resp.Status, string(body))
+		return "", apiError(resp, model)
 	}
 
 	var result map[string]interface{}
@@ -74,20 +113,88 @@ func SendOllamaMessage(OllamaHost string, model string, messages []models.Messag
 	return "", fmt.Errorf("не удалось извлечь ответ")
 }
 
+// StreamOllamaMessage отправляет сообщения в модель в потоковом режиме: каждый фрагмент
+// ответа передается в onChunk по мере генерации. Возвращает ответ целиком.
+func StreamOllamaMessage(OllamaHost string, model string, messages []models.Message, onChunk func(string)) (string, error) {
+	return StreamOllamaMessageContext(context.Background(), OllamaHost, model, messages, ChatOptions{}, onChunk)
+}
+
+// StreamOllamaMessageContext - StreamOllamaMessage с параметрами генерации и отменой через ctx
+func StreamOllamaMessageContext(ctx context.Context, OllamaHost string, model string, messages []models.Message, opts ChatOptions, onChunk func(string)) (string, error) {
+	log.Printf("Потоковая отправка сообщения в модель %s", model)
+
+	jsonData, err := json.Marshal(chatBody(model, messages, opts, true))
+	if err != nil {
+		return "", fmt.Errorf("ошибка сериализации JSON: %v", err)
+	}
+
+	url := fmt.Sprintf("%s/api/chat", baseURL(OllamaHost))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("ошибка создания запроса: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Load().Do(req)
+	if err != nil {
+		return "", upstream.Unavailable("Ollama", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", apiError(resp, model)
+	}
+
+	// Ollama отдает поток JSON-объектов, по одному на фрагмент; последний с done=true
+	var answer strings.Builder
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var chunk struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			Done  bool   `json:"done"`
+			Error string `json:"error"`
+		}
+		if err := decoder.Decode(&chunk); err != nil {
+			if err == io.EOF {
+				return "", fmt.Errorf("поток ответа оборвался")
+			}
+			return "", fmt.Errorf("ошибка декодирования ответа: %v", err)
+		}
+		if chunk.Error != "" {
+			return "", fmt.Errorf("ошибка от API: %s", chunk.Error)
+		}
+		if chunk.Message.Content != "" {
+			answer.WriteString(chunk.Message.Content)
+			onChunk(chunk.Message.Content)
+		}
+		if chunk.Done {
+			return answer.String(), nil
+		}
+	}
+}
+
 func GetOllamaModels(OllamaHost string) ([]map[string]interface{}, error) {
+	return GetOllamaModelsContext(context.Background(), OllamaHost)
+}
+
+// GetOllamaModelsContext работает как GetOllamaModels; отмена ctx обрывает запрос
+func GetOllamaModelsContext(ctx context.Context, OllamaHost string) ([]map[string]interface{}, error) {
 	log.Printf("Получение списка моделей Ollama")
 
-	tagsURL := OllamaHost + "/api/tags"
-	resp, err := http.Get(tagsURL)
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL(OllamaHost)+"/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Load().Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка запроса списка моделей: %v", err)
+		return nil, upstream.Unavailable("Ollama", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("Ошибка от Ollama API: %s, тело ответа: %s", resp.Status, string(body))
-		return nil, fmt.Errorf("ошибка от Ollama API: %s", resp.Status)
+		return nil, apiError(resp, "")
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -111,3 +218,115 @@ func GetOllamaModels(OllamaHost string) ([]map[string]interface{}, error) {
 
 	return response.Models, nil
 }
+
+// GetVersion возвращает версию сервера Ollama; используется для проверки доступности
+func GetVersion(OllamaHost string) (string, error) {
+	return GetVersionContext(context.Background(), OllamaHost)
+}
+
+// GetVersionContext работает как GetVersion; отмена ctx обрывает запрос
+func GetVersionContext(ctx context.Context, OllamaHost string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL(OllamaHost)+"/api/version", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := httpClient.Load().Do(req)
+	if err != nil {
+		return "", upstream.Unavailable("Ollama", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", apiError(resp, "")
+	}
+
+	var result struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("ошибка декодирования ответа: %v", err)
+	}
+	return result.Version, nil
+}
+
+// ModelInfo - сведения о модели из /api/show, нужные для расчета бюджета контекста
+type ModelInfo struct {
+	Name string `json:"name"`
+	// NumCtx - фактический размер окна контекста, с которым Ollama запускает модель
+	NumCtx int `json:"numCtx"`
+	// ContextLength - максимальный контекст, на который обучена модель
+	ContextLength int `json:"contextLength"`
+}
+
+// ShowModel запрашивает параметры модели и определяет ее окно контекста
+func ShowModel(OllamaHost string, model string) (*ModelInfo, error) {
+	log.Printf("Получение параметров модели %s", model)
+
+	jsonData, err := json.Marshal(map[string]string{"model": model})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации JSON: %v", err)
+	}
+
+	resp, err := httpClient.Load().Post(baseURL(OllamaHost)+"/api/show", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, upstream.Unavailable("Ollama", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(resp, model)
+	}
+
+	var result struct {
+		Parameters string                 `json:"parameters"`
+		ModelInfo  map[string]interface{} `json:"model_info"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("ошибка декодирования ответа: %v", err)
+	}
+
+	info := &ModelInfo{Name: model, NumCtx: DefaultNumCtx}
+	for key, value := range result.ModelInfo {
+		if strings.HasSuffix(key, ".context_length") {
+			if n, ok := value.(float64); ok {
+				info.ContextLength = int(n)
+			}
+		}
+	}
+	// parameters - текст Modelfile вида "num_ctx 8192\nstop \"<|eot|>\""
+	for _, line := range strings.Split(result.Parameters, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "num_ctx" {
+			if n, err := strconv.Atoi(fields[1]); err == nil && n > 0 {
+				info.NumCtx = n
+			}
+		}
+	}
+	if info.ContextLength > 0 && info.NumCtx > info.ContextLength {
+		info.NumCtx = info.ContextLength
+	}
+
+	return info, nil
+}
+
+// apiError читает тело неуспешного ответа Ollama и возвращает *upstream.Error.
+// Для запросов к модели 404 означает, что модели нет на сервере.
+func apiError(resp *http.Response, model string) error {
+	body, _ := io.ReadAll(resp.Body)
+	log.Printf("Ошибка от Ollama API: %s, тело ответа: %s", resp.Status, string(body))
+	e := upstream.FromResponse("Ollama", resp, body)
+	if model != "" && resp.StatusCode == http.StatusNotFound {
+		e.Kind = upstream.ErrModelNotFound
+	}
+	return e
+}
+
+// baseURL дополняет адрес Ollama схемой http://, если она не указана
+// (значение по умолчанию OLLAMA_HOST задается без схемы)
+func baseURL(OllamaHost string) string {
+	host := strings.TrimRight(OllamaHost, "/")
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = "http://" + host
+	}
+	return host
+}
@@ -2,7 +2,9 @@ package ollama
 
 import (
 	"encoding/json"
+	"errors"
 	"jira-go/models"
+	"jira-go/pkg/upstream"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -160,8 +162,128 @@ func TestSendOllamaMessage(t *testing.T) {
 
 		_, err := SendOllamaMessage("localhost:99999", "test-model", messages)
 
-		if err == nil {
-			t.Error("Expected error for unavailable server, got nil")
+		if !errors.Is(err, upstream.ErrUpstreamUnavailable) {
+			t.Errorf("Expected unavailable error, got %v", err)
+		}
+	})
+}
+
+func TestOllamaErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/chat", "/api/show":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"model 'missing' not found, try pulling it first"}`))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	_, err := SendOllamaMessage(server.URL, "missing", nil)
+	if !errors.Is(err, upstream.ErrModelNotFound) {
+		t.Fatalf("expected model not found, got %v", err)
+	}
+	if e, ok := upstream.As(err); !ok || e.Status != http.StatusNotFound || len(e.Messages) != 1 {
+		t.Errorf("expected upstream error with Ollama message, got %#v", err)
+	}
+	if _, err := StreamOllamaMessage(server.URL, "missing", nil, func(string) {}); !errors.Is(err, upstream.ErrModelNotFound) {
+		t.Errorf("expected model not found for stream, got %v", err)
+	}
+	if _, err := ShowModel(server.URL, "missing"); !errors.Is(err, upstream.ErrModelNotFound) {
+		t.Errorf("expected model not found for show, got %v", err)
+	}
+	if _, err := GetOllamaModels(server.URL); !errors.Is(err, upstream.ErrUpstreamUnavailable) {
+		t.Errorf("expected unavailable for 503, got %v", err)
+	}
+}
+
+func TestShowModel(t *testing.T) {
+	tests := []struct {
+		name            string
+		response        string
+		expectedNumCtx  int
+		expectedContext int
+	}{
+		{
+			name:            "num_ctx from parameters",
+			response:        `{"parameters": "num_ctx 8192\nstop \"<|eot_id|>\"", "model_info": {"llama.context_length": 131072}}`,
+			expectedNumCtx:  8192,
+			expectedContext: 131072,
+		},
+		{
+			name:            "Default num_ctx",
+			response:        `{"parameters": "stop \"<|eot_id|>\"", "model_info": {"qwen2.context_length": 32768}}`,
+			expectedNumCtx:  DefaultNumCtx,
+			expectedContext: 32768,
+		},
+		{
+			name:            "num_ctx capped by context length",
+			response:        `{"parameters": "num_ctx 8192", "model_info": {"phi.context_length": 4096}}`,
+			expectedNumCtx:  4096,
+			expectedContext: 4096,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != "POST" || r.URL.Path != "/api/show" {
+					t.Errorf("Expected POST /api/show, got %s %s", r.Method, r.URL.Path)
+				}
+				var req map[string]string
+				json.NewDecoder(r.Body).Decode(&req)
+				if req["model"] != "llama3" {
+					t.Errorf("Expected model llama3, got %v", req)
+				}
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			info, err := ShowModel(server.URL, "llama3")
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if info.NumCtx != tt.expectedNumCtx {
+				t.Errorf("Expected num_ctx %d, got %d", tt.expectedNumCtx, info.NumCtx)
+			}
+			if info.ContextLength != tt.expectedContext {
+				t.Errorf("Expected context length %d, got %d", tt.expectedContext, info.ContextLength)
+			}
+		})
+	}
+
+	t.Run("Model not found", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "model not found"}`))
+		}))
+		defer server.Close()
+
+		if _, err := ShowModel(server.URL, "missing"); err == nil {
+			t.Error("Expected error for missing model, got nil")
 		}
 	})
 }
+
+func TestGetVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/version" {
+			t.Errorf("Expected request to /api/version, got %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"version": "0.5.7"}`))
+	}))
+	defer server.Close()
+
+	version, err := GetVersion(server.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if version != "0.5.7" {
+		t.Errorf("Expected version 0.5.7, got %s", version)
+	}
+
+	if _, err := GetVersion("http://127.0.0.1:1"); err == nil {
+		t.Error("Expected error for unreachable server, got nil")
+	}
+}
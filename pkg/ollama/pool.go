@@ -0,0 +1,416 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"jira-go/models"
+	"jira-go/pkg/limiter"
+	"jira-go/pkg/upstream"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Endpoint - один сервер Ollama в пуле
+type Endpoint struct {
+	Name string
+	URL  string
+}
+
+// HostStatus - состояние сервера по результатам последней проверки
+type HostStatus struct {
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Healthy   bool      `json:"healthy"`
+	Models    []string  `json:"models"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+type host struct {
+	Endpoint
+	healthy   bool
+	models    map[string]map[string]interface{}
+	err       string
+	checkedAt time.Time
+}
+
+// Pool распределяет запросы между несколькими серверами Ollama: запрос уходит на сервер,
+// где есть нужная модель, а при ошибке повторяется на следующем
+type Pool struct {
+	mu    sync.RWMutex
+	hosts []*host
+	// next - счетчик для чередования подходящих серверов
+	next int
+	// limits ограничивает одновременные генерации модели на одном сервере; nil - без ограничений
+	limits *limiter.Limiter
+}
+
+// NewPool создает пул. До первой проверки все серверы считаются доступными.
+func NewPool(endpoints []Endpoint) *Pool {
+	p := &Pool{}
+	for _, e := range endpoints {
+		p.hosts = append(p.hosts, &host{Endpoint: e, healthy: true})
+	}
+	return p
+}
+
+// SetLimiter включает ограничение одновременных запросов к модели на каждом сервере
+func (p *Pool) SetLimiter(l *limiter.Limiter) {
+	p.mu.Lock()
+	p.limits = l
+	p.mu.Unlock()
+}
+
+// SetEndpoints заменяет список серверов, сохраняя состояние тех, что не изменились
+func (p *Pool) SetEndpoints(endpoints []Endpoint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	known := map[Endpoint]*host{}
+	for _, h := range p.hosts {
+		known[h.Endpoint] = h
+	}
+	hosts := make([]*host, 0, len(endpoints))
+	for _, e := range endpoints {
+		if h, ok := known[e]; ok {
+			hosts = append(hosts, h)
+		} else {
+			hosts = append(hosts, &host{Endpoint: e, healthy: true})
+		}
+	}
+	p.hosts = hosts
+}
+
+// Refresh проверяет все серверы параллельно и обновляет списки их моделей
+func (p *Pool) Refresh() {
+	p.mu.RLock()
+	hosts := p.hosts
+	p.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, h := range hosts {
+		wg.Add(1)
+		go func(h *host) {
+			defer wg.Done()
+			p.check(h)
+		}(h)
+	}
+	wg.Wait()
+}
+
+func (p *Pool) check(h *host) {
+	list, err := GetOllamaModels(h.URL)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h.checkedAt = time.Now()
+	if err != nil {
+		if h.healthy {
+			log.Printf("Сервер Ollama %s недоступен: %v", h.Name, err)
+		}
+		h.healthy, h.err = false, err.Error()
+		return
+	}
+	if !h.healthy {
+		log.Printf("Сервер Ollama %s снова доступен", h.Name)
+	}
+	h.healthy, h.err = true, ""
+	h.models = map[string]map[string]interface{}{}
+	for _, m := range list {
+		if name, ok := m["name"].(string); ok {
+			h.models[name] = m
+		}
+	}
+}
+
+// Start периодически проверяет серверы, пока не будет закрыт stop
+func (p *Pool) Start(interval time.Duration, stop <-chan struct{}) {
+	p.Refresh()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.Refresh()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// candidates возвращает серверы в порядке попыток: доступные с моделью (по очереди),
+// доступные без сведений о модели, затем недоступные на случай, если они уже поднялись
+func (p *Pool) candidates(model string) []*host {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var withModel, unknown, down []*host
+	for _, h := range p.hosts {
+		switch {
+		case !h.healthy:
+			down = append(down, h)
+		case model == "" || h.models == nil:
+			unknown = append(unknown, h)
+		case h.models[model] != nil:
+			withModel = append(withModel, h)
+		}
+	}
+
+	if len(withModel) > 1 {
+		shift := p.next % len(withModel)
+		withModel = append(withModel[shift:], withModel[:shift]...)
+		p.next++
+	}
+	return append(append(withModel, unknown...), down...)
+}
+
+// Do выполняет fn на подходящем сервере, при ошибке переходя к следующему.
+// Сервер, до которого не удалось достучаться, помечается недоступным до следующей проверки.
+func (p *Pool) Do(model string, fn func(OllamaHost string) error) error {
+	return p.DoContext(context.Background(), model, fn)
+}
+
+// DoContext работает как Do, но занимает место в очереди к модели на сервере (см. SetLimiter).
+// Пока мест нет, запрос ждет своей очереди; если очередь заполнена, возвращается
+// *limiter.BusyError. Отмена ctx снимает запрос с очереди.
+func (p *Pool) DoContext(ctx context.Context, model string, fn func(OllamaHost string) error) error {
+	return p.do(ctx, model, true, fn)
+}
+
+func (p *Pool) do(ctx context.Context, model string, limited bool, fn func(OllamaHost string) error) error {
+	hosts := p.candidates(model)
+	if len(hosts) == 0 {
+		// Кандидатов нет, если все серверы доступны и модели нет ни на одном из них
+		return fmt.Errorf("нет серверов Ollama с моделью %s: %w", model, upstream.ErrModelNotFound)
+	}
+
+	p.mu.RLock()
+	limits := p.limits
+	p.mu.RUnlock()
+	if !limited {
+		limits = nil
+	}
+
+	// Если на каком-то сервере есть свободное место, начинаем с него, иначе ждем
+	// очереди на первом по порядку
+	var held func()
+	if limits != nil {
+		for i, h := range hosts {
+			if release, ok := limits.TryAcquire(limitKey(h, model)); ok {
+				held = release
+				hosts = append([]*host{h}, append(hosts[:i:i], hosts[i+1:]...)...)
+				break
+			}
+		}
+	}
+
+	var errs []error
+	for _, h := range hosts {
+		release := held
+		held = nil
+		if release == nil && limits != nil {
+			var err error
+			if release, err = limits.Acquire(ctx, limitKey(h, model)); err != nil {
+				return errors.Join(append(errs, err)...)
+			}
+		}
+
+		err := fn(h.URL)
+		if release != nil {
+			release()
+		}
+		if err == nil {
+			p.markHealthy(h)
+			return nil
+		}
+		// Запрос отменил клиент: сервер исправен, и повторять на другом незачем
+		if ctx.Err() != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		log.Printf("Ошибка на сервере Ollama %s: %v", h.Name, err)
+		errs = append(errs, fmt.Errorf("%s: %w", h.Name, err))
+		if unreachable(err) {
+			p.markDown(h, err)
+		}
+		if !retryable(err) {
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Chat отправляет сообщения в модель на одном из серверов пула
+func (p *Pool) Chat(model string, messages []models.Message) (string, error) {
+	return p.ChatContext(context.Background(), model, messages)
+}
+
+// ChatContext отправляет сообщения в модель, соблюдая очередь к серверам (см. DoContext).
+// Отмена ctx снимает запрос с очереди или обрывает уже идущую генерацию.
+func (p *Pool) ChatContext(ctx context.Context, model string, messages []models.Message) (string, error) {
+	return p.ChatWith(ctx, model, messages, ChatOptions{})
+}
+
+// ChatWith - ChatContext с параметрами генерации
+func (p *Pool) ChatWith(ctx context.Context, model string, messages []models.Message, opts ChatOptions) (string, error) {
+	var answer string
+	err := p.DoContext(ctx, model, func(OllamaHost string) error {
+		var err error
+		answer, err = SendOllamaMessageContext(ctx, OllamaHost, model, messages, opts)
+		return err
+	})
+	return answer, err
+}
+
+// ChatStream отправляет сообщения в модель в потоковом режиме (см. StreamOllamaMessage).
+// На другой сервер запрос переходит, только пока не получено ни одного фрагмента:
+// иначе часть ответа повторилась бы.
+func (p *Pool) ChatStream(ctx context.Context, model string, messages []models.Message, onChunk func(string)) (string, error) {
+	var answer string
+	var streamErr error
+	err := p.DoContext(ctx, model, func(OllamaHost string) error {
+		started := false
+		var err error
+		answer, err = StreamOllamaMessageContext(ctx, OllamaHost, model, messages, ChatOptions{}, func(chunk string) {
+			started = true
+			onChunk(chunk)
+		})
+		if err != nil && started {
+			streamErr = err
+			return nil
+		}
+		return err
+	})
+	if streamErr != nil {
+		return "", streamErr
+	}
+	return answer, err
+}
+
+// ShowModel запрашивает параметры модели на одном из серверов пула. Запрос быстрый
+// и не генерирует текст, поэтому идет в обход очереди.
+func (p *Pool) ShowModel(model string) (*ModelInfo, error) {
+	var info *ModelInfo
+	err := p.do(context.Background(), model, false, func(OllamaHost string) error {
+		var err error
+		info, err = ShowModel(OllamaHost, model)
+		return err
+	})
+	return info, err
+}
+
+// Models возвращает объединенный список моделей со всех доступных серверов.
+// В поле hosts каждой модели перечислены серверы, на которых она есть.
+func (p *Pool) Models() []map[string]interface{} {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	merged := map[string]map[string]interface{}{}
+	var names []string
+	for _, h := range p.hosts {
+		if !h.healthy {
+			continue
+		}
+		for name, m := range h.models {
+			entry, ok := merged[name]
+			if !ok {
+				entry = map[string]interface{}{}
+				for k, v := range m {
+					entry[k] = v
+				}
+				entry["hosts"] = []string{}
+				merged[name] = entry
+				names = append(names, name)
+			}
+			entry["hosts"] = append(entry["hosts"].([]string), h.Name)
+		}
+	}
+
+	sort.Strings(names)
+	result := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		result = append(result, merged[name])
+	}
+	return result
+}
+
+// Endpoints возвращает серверы пула
+func (p *Pool) Endpoints() []Endpoint {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	endpoints := make([]Endpoint, len(p.hosts))
+	for i, h := range p.hosts {
+		endpoints[i] = h.Endpoint
+	}
+	return endpoints
+}
+
+// Probe проверяет сервер для /readyz: запрашивает версию Ollama и число установленных
+// моделей. Состояние сервера в пуле не меняется; отмена ctx обрывает запросы.
+func (p *Pool) Probe(ctx context.Context, e Endpoint) (version string, models int, err error) {
+	if version, err = GetVersionContext(ctx, e.URL); err != nil {
+		return "", 0, err
+	}
+	list, err := GetOllamaModelsContext(ctx, e.URL)
+	if err != nil {
+		return "", 0, err
+	}
+	return version, len(list), nil
+}
+
+// Status возвращает состояние всех серверов пула
+func (p *Pool) Status() []HostStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result := make([]HostStatus, 0, len(p.hosts))
+	for _, h := range p.hosts {
+		status := HostStatus{Name: h.Name, URL: h.URL, Healthy: h.healthy, Models: []string{}, Error: h.err, CheckedAt: h.checkedAt}
+		for name := range h.models {
+			status.Models = append(status.Models, name)
+		}
+		sort.Strings(status.Models)
+		result = append(result, status)
+	}
+	return result
+}
+
+func (p *Pool) markHealthy(h *host) {
+	p.mu.Lock()
+	h.healthy, h.err = true, ""
+	p.mu.Unlock()
+}
+
+func (p *Pool) markDown(h *host, err error) {
+	p.mu.Lock()
+	h.healthy, h.err = false, err.Error()
+	p.mu.Unlock()
+}
+
+// limitKey - ключ очереди: модель на конкретном сервере
+func limitKey(h *host, model string) string {
+	return h.Name + "/" + model
+}
+
+// unreachable отличает сетевые ошибки (сервер выключен, таймаут) от ответов API с ошибкой
+func unreachable(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// retryable определяет, стоит ли повторять запрос на другом сервере: да, если сервер
+// недоступен, ответил 5xx или на нем нет модели. Ошибка в самом запросе (400 и т.п.)
+// повторится на любом сервере, поэтому возвращается сразу.
+func retryable(err error) bool {
+	if unreachable(err) || errors.Is(err, upstream.ErrUpstreamUnavailable) || errors.Is(err, upstream.ErrModelNotFound) {
+		return true
+	}
+	e, ok := upstream.As(err)
+	return ok && e.Status >= http.StatusInternalServerError
+}
@@ -0,0 +1,292 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"jira-go/models"
+	"jira-go/pkg/limiter"
+	"jira-go/pkg/upstream"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeOllama поднимает сервер с заданными моделями и считает запросы к /api/chat
+func fakeOllama(t *testing.T, answer string, modelNames ...string) (*httptest.Server, *int32) {
+	t.Helper()
+	var chats int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/tags":
+			var list []map[string]interface{}
+			for _, name := range modelNames {
+				list = append(list, map[string]interface{}{"name": name})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"models": list})
+		case "/api/chat":
+			atomic.AddInt32(&chats, 1)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"message": map[string]string{"role": "assistant", "content": answer},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &chats
+}
+
+func TestPoolRoutesByModel(t *testing.T) {
+	small, smallChats := fakeOllama(t, "small", "llama3")
+	big, bigChats := fakeOllama(t, "big", "llama3", "mixtral")
+
+	pool := NewPool([]Endpoint{{Name: "small", URL: small.URL}, {Name: "big", URL: big.URL}})
+	pool.Refresh()
+
+	answer, err := pool.Chat("mixtral", []models.Message{{Role: "user", Content: "hi"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if answer != "big" || atomic.LoadInt32(smallChats) != 0 {
+		t.Errorf("expected mixtral to be served by big only, got %q (small chats: %d)", answer, *smallChats)
+	}
+
+	// llama3 есть на обоих серверах, запросы чередуются
+	for i := 0; i < 4; i++ {
+		if _, err := pool.Chat("llama3", nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if atomic.LoadInt32(smallChats) != 2 || atomic.LoadInt32(bigChats) != 3 {
+		t.Errorf("expected requests to alternate, got small=%d big=%d", *smallChats, *bigChats)
+	}
+
+	if _, err := pool.Chat("unknown", nil); err == nil {
+		t.Error("expected error for a model no host serves")
+	}
+}
+
+func TestPoolFailover(t *testing.T) {
+	down, _ := fakeOllama(t, "down", "llama3")
+	up, upChats := fakeOllama(t, "up", "llama3")
+
+	pool := NewPool([]Endpoint{{Name: "down", URL: down.URL}, {Name: "up", URL: up.URL}})
+	pool.Refresh()
+	down.Close()
+
+	for i := 0; i < 2; i++ {
+		answer, err := pool.Chat("llama3", nil)
+		if err != nil || answer != "up" {
+			t.Fatalf("expected failover to up, got %q, %v", answer, err)
+		}
+	}
+	if atomic.LoadInt32(upChats) != 2 {
+		t.Errorf("expected 2 chats on up, got %d", *upChats)
+	}
+
+	status := pool.Status()
+	if status[0].Healthy || status[0].Error == "" {
+		t.Errorf("expected down host to be marked unhealthy, got %+v", status[0])
+	}
+	if !status[1].Healthy {
+		t.Errorf("expected up host to stay healthy, got %+v", status[1])
+	}
+}
+
+func TestPoolModelNotFound(t *testing.T) {
+	first, firstChats := fakeOllama(t, "first", "llama3")
+	second, _ := fakeOllama(t, "second", "mistral")
+
+	pool := NewPool([]Endpoint{{Name: "first", URL: first.URL}, {Name: "second", URL: second.URL}})
+	pool.Refresh()
+
+	if _, err := pool.Chat("codellama", nil); !errors.Is(err, upstream.ErrModelNotFound) {
+		t.Errorf("expected model not found, got %v", err)
+	}
+	if atomic.LoadInt32(firstChats) != 0 {
+		t.Errorf("expected no chats without the model, got %d", *firstChats)
+	}
+
+	first.Close()
+	second.Close()
+	if _, err := pool.Chat("llama3", nil); !errors.Is(err, upstream.ErrUpstreamUnavailable) {
+		t.Errorf("expected unavailable when all hosts are down, got %v", err)
+	}
+}
+
+// Запрос, отклоненный сервером, не повторяется на других серверах
+func TestPoolNoFailoverOnBadRequest(t *testing.T) {
+	var badChats int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&badChats, 1)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "invalid message format"}`))
+	}))
+	t.Cleanup(bad.Close)
+	up, upChats := fakeOllama(t, "up", "llama3")
+
+	pool := NewPool([]Endpoint{{Name: "bad", URL: bad.URL}, {Name: "up", URL: up.URL}})
+	if _, err := pool.Chat("llama3", nil); !errors.Is(err, upstream.ErrBadRequest) {
+		t.Errorf("expected bad request, got %v", err)
+	}
+	if atomic.LoadInt32(&badChats) != 1 || atomic.LoadInt32(upChats) != 0 {
+		t.Errorf("expected no failover, got bad=%d up=%d", badChats, *upChats)
+	}
+	if !pool.Status()[0].Healthy {
+		t.Error("host answering 400 must stay healthy")
+	}
+}
+
+func TestPoolModels(t *testing.T) {
+	a, _ := fakeOllama(t, "", "llama3", "qwen")
+	b, _ := fakeOllama(t, "", "llama3")
+
+	pool := NewPool([]Endpoint{{Name: "a", URL: a.URL}, {Name: "b", URL: b.URL}})
+	pool.Refresh()
+
+	merged := pool.Models()
+	if len(merged) != 2 {
+		t.Fatalf("expected 2 merged models, got %d", len(merged))
+	}
+	if merged[0]["name"] != "llama3" {
+		t.Fatalf("expected models sorted by name, got %v", merged[0]["name"])
+	}
+	hosts := merged[0]["hosts"].([]string)
+	if len(hosts) != 2 || hosts[0] != "a" || hosts[1] != "b" {
+		t.Errorf("expected llama3 on a and b, got %v", hosts)
+	}
+	if hosts := merged[1]["hosts"].([]string); len(hosts) != 1 || hosts[0] != "a" {
+		t.Errorf("expected qwen on a only, got %v", hosts)
+	}
+}
+
+func TestPoolLimiterPrefersFreeHost(t *testing.T) {
+	first, firstChats := fakeOllama(t, "first", "llama3")
+	second, secondChats := fakeOllama(t, "second", "llama3")
+
+	pool := NewPool([]Endpoint{{Name: "first", URL: first.URL}, {Name: "second", URL: second.URL}})
+	pool.Refresh()
+	limits := limiter.New(limiter.Config{PerKey: 1, MaxQueue: 0})
+	pool.SetLimiter(limits)
+
+	// Оба сервера заняты - очереди нет, запрос отклоняется
+	releaseFirst, _ := limits.TryAcquire("first/llama3")
+	releaseSecond, _ := limits.TryAcquire("second/llama3")
+	_, err := pool.Chat("llama3", []models.Message{{Role: "user", Content: "hi"}})
+	var busy *limiter.BusyError
+	if !errors.As(err, &busy) {
+		t.Fatalf("expected BusyError, got %v", err)
+	}
+
+	// Свободен только второй сервер - запрос уходит на него
+	releaseSecond()
+	answer, err := pool.Chat("llama3", []models.Message{{Role: "user", Content: "hi"}})
+	if err != nil || answer != "second" {
+		t.Fatalf("expected answer from free host, got %q, %v", answer, err)
+	}
+	if atomic.LoadInt32(firstChats) != 0 || atomic.LoadInt32(secondChats) != 1 {
+		t.Errorf("unexpected chats: first=%d second=%d", *firstChats, *secondChats)
+	}
+	releaseFirst()
+}
+
+// streamingOllama отдает ответ фрагментами; при broken поток обрывается после первого фрагмента
+func streamingOllama(t *testing.T, broken bool, chunks ...string) (*httptest.Server, *int32) {
+	t.Helper()
+	var chats int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			json.NewEncoder(w).Encode(map[string]interface{}{"models": []map[string]string{{"name": "llama3"}}})
+		case "/api/chat":
+			atomic.AddInt32(&chats, 1)
+			enc := json.NewEncoder(w)
+			for i, chunk := range chunks {
+				enc.Encode(map[string]interface{}{"message": map[string]string{"content": chunk}})
+				if broken && i == 0 {
+					return
+				}
+			}
+			enc.Encode(map[string]interface{}{"done": true})
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &chats
+}
+
+func TestPoolChatStream(t *testing.T) {
+	down, _ := fakeOllama(t, "", "llama3")
+	up, _ := streamingOllama(t, false, "При", "вет")
+
+	pool := NewPool([]Endpoint{{Name: "down", URL: down.URL}, {Name: "up", URL: up.URL}})
+	pool.Refresh()
+	down.Close()
+
+	var chunks []string
+	answer, err := pool.ChatStream(context.Background(), "llama3", nil, func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil || answer != "Привет" || len(chunks) != 2 {
+		t.Fatalf("expected streamed answer after failover, got %q %v, %v", answer, chunks, err)
+	}
+
+	// Оборванный поток не повторяется на другом сервере, иначе начало ответа задвоится
+	broken, brokenChats := streamingOllama(t, true, "При", "вет")
+	other, otherChats := streamingOllama(t, false, "При", "вет")
+	pool = NewPool([]Endpoint{{Name: "broken", URL: broken.URL}, {Name: "other", URL: other.URL}})
+	pool.Refresh()
+	chunks = nil
+	if _, err := pool.ChatStream(context.Background(), "llama3", nil, func(chunk string) {
+		chunks = append(chunks, chunk)
+	}); err == nil {
+		t.Fatal("expected error for a broken stream")
+	}
+	if len(chunks) != 1 || atomic.LoadInt32(brokenChats) != 1 || atomic.LoadInt32(otherChats) != 0 {
+		t.Errorf("broken stream must not be retried: chunks %v, broken=%d other=%d", chunks, *brokenChats, *otherChats)
+	}
+}
+
+// Отмена запроса обрывает генерацию на сервере, освобождает место в очереди
+// и не переводит запрос на другой сервер
+func TestPoolChatCancel(t *testing.T) {
+	cancelled := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Разрыв соединения сервер замечает только после чтения тела запроса
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(slow.Close)
+	other, otherChats := fakeOllama(t, "other", "llama3")
+
+	pool := NewPool([]Endpoint{{Name: "slow", URL: slow.URL}, {Name: "other", URL: other.URL}})
+	limits := limiter.New(limiter.Config{PerKey: 1, MaxQueue: 0})
+	pool.SetLimiter(limits)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := pool.ChatContext(ctx, "llama3", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("request to Ollama was not cancelled")
+	}
+	if atomic.LoadInt32(otherChats) != 0 || !pool.Status()[0].Healthy {
+		t.Error("cancelled request must not fail over or mark the host down")
+	}
+	if release, ok := limits.TryAcquire("slow/llama3"); !ok {
+		t.Error("slot must be released after cancel")
+	} else {
+		release()
+	}
+}
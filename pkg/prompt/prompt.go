@@ -0,0 +1,311 @@
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"jira-go/pkg/jira"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// Приоритеты разделов контекста: при нехватке места первыми отбрасываются
+// разделы с большим значением
+const (
+	PrioritySummary = iota
+	PriorityDescription
+	PriorityComments
+	PriorityLinks
+)
+
+// Действия над разделом, попадающие в отчет
+const (
+	ActionIncluded   = "included"
+	ActionTruncated  = "truncated"
+	ActionDropped    = "dropped"
+	ActionSummarized = "summarized"
+)
+
+const (
+	// minSectionTokens - меньше этого обрезанный раздел теряет смысл и отбрасывается
+	minSectionTokens = 32
+	// minAnswerTokens - минимальный запас окна под ответ модели
+	minAnswerTokens = 256
+	truncatedMarker = "\n…[обрезано]"
+)
+
+type Section struct {
+	Name     string
+	Title    string
+	Text     string
+	Priority int
+}
+
+type SectionReport struct {
+	Name   string `json:"name"`
+	Tokens int    `json:"tokens"`
+	Kept   int    `json:"kept"`
+	Action string `json:"action"`
+}
+
+// Report описывает, как был собран контекст и что в него не поместилось
+type Report struct {
+	NumCtx     int             `json:"numCtx"`
+	Budget     int             `json:"budget"`
+	Used       int             `json:"used"`
+	Sections   []SectionReport `json:"sections"`
+	Dropped    []string        `json:"dropped"`
+	Summarized []string        `json:"summarized"`
+}
+
+// dir - каталог с пользовательскими системными промптами (prompt_dir в конфигурации)
+var dir atomic.Value
+
+// SetDir задает каталог, из которого System читает промпты
+func SetDir(promptDir string) {
+	dir.Store(promptDir)
+}
+
+// System возвращает системный промпт из файла <prompt_dir>/<name>.txt или fallback,
+// если каталог не задан или файла нет. Файл читается при каждом вызове, так что
+// правки применяются без перезапуска.
+func System(name, fallback string) string {
+	promptDir, _ := dir.Load().(string)
+	if promptDir == "" {
+		return fallback
+	}
+	data, err := os.ReadFile(filepath.Join(promptDir, name+".txt"))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Ошибка чтения промпта %s: %v", name, err)
+		}
+		return fallback
+	}
+	if text := strings.TrimSpace(string(data)); text != "" {
+		return text
+	}
+	return fallback
+}
+
+// Builder собирает сообщение для модели в пределах окна контекста
+type Builder struct {
+	// NumCtx - окно контекста модели в токенах (num_ctx из /api/show)
+	NumCtx int
+	// AnswerReserve - доля окна, оставляемая под ответ модели
+	AnswerReserve float64
+	// Summarize, если задан, сжимает не поместившиеся разделы до maxTokens
+	Summarize func(text string, maxTokens int) (string, error)
+}
+
+func NewBuilder(numCtx int) *Builder {
+	return &Builder{NumCtx: numCtx, AnswerReserve: 0.25}
+}
+
+// EstimateTokens грубо оценивает число токенов: около 4 символов латиницы
+// или 2 символов кириллицы и прочих алфавитов на токен
+func EstimateTokens(s string) int {
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii + 2*other + 3) / 4
+}
+
+// Build добавляет к вопросу пользователя разделы контекста по приоритету.
+// Не поместившиеся разделы сжимаются через Summarize, если он задан, иначе
+// обрезаются или отбрасываются.
+func (b *Builder) Build(question string, sections []Section) (string, Report) {
+	reserve := int(float64(b.NumCtx) * b.AnswerReserve)
+	if reserve < minAnswerTokens {
+		reserve = minAnswerTokens
+	}
+	budget := b.NumCtx - reserve - EstimateTokens(question)
+	if budget < 0 {
+		budget = 0
+	}
+
+	report := Report{NumCtx: b.NumCtx, Budget: budget, Dropped: []string{}, Summarized: []string{}}
+
+	ordered := make([]Section, len(sections))
+	copy(ordered, sections)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Priority < ordered[j].Priority
+	})
+
+	remaining := budget
+	var parts []string
+	var overflow []Section
+	add := func(block string, entry SectionReport) {
+		if entry.Action == ActionDropped {
+			report.Dropped = append(report.Dropped, entry.Name)
+		} else {
+			parts = append(parts, block)
+			remaining -= entry.Kept
+			report.Used += entry.Kept
+		}
+		report.Sections = append(report.Sections, entry)
+	}
+
+	for _, s := range ordered {
+		block := s.block()
+		if block == "" {
+			continue
+		}
+		// После первого не поместившегося раздела менее важные тоже откладываются
+		// на сжатие, чтобы не занять бюджет, нужный более важному
+		if b.Summarize != nil && len(overflow) > 0 {
+			overflow = append(overflow, s)
+			continue
+		}
+		tokens := EstimateTokens(block)
+		if tokens <= remaining {
+			add(block, SectionReport{Name: s.Name, Tokens: tokens, Kept: tokens, Action: ActionIncluded})
+			continue
+		}
+		if b.Summarize != nil {
+			overflow = append(overflow, s)
+			continue
+		}
+		add(fit(s.Name, block, remaining))
+	}
+
+	if len(overflow) > 0 {
+		if block, entries, ok := b.summarizeOverflow(overflow, remaining); ok {
+			parts = append(parts, block)
+			for _, entry := range entries {
+				report.Used += entry.Kept
+				report.Summarized = append(report.Summarized, entry.Name)
+			}
+			report.Sections = append(report.Sections, entries...)
+		} else {
+			for _, s := range overflow {
+				add(fit(s.Name, s.block(), remaining))
+			}
+		}
+	}
+
+	if len(parts) == 0 {
+		return question, report
+	}
+	return question + "\n\n" + strings.Join(parts, "\n\n"), report
+}
+
+// summarizeOverflow сжимает все не поместившиеся разделы в одну сводку размером с остаток бюджета
+func (b *Builder) summarizeOverflow(overflow []Section, remaining int) (string, []SectionReport, bool) {
+	var names, blocks []string
+	for _, s := range overflow {
+		names = append(names, s.Name)
+		blocks = append(blocks, s.block())
+	}
+
+	title := "Сводка (" + strings.Join(names, ", ") + "):\n"
+	limit := remaining - EstimateTokens(title)
+	if limit < minSectionTokens {
+		return "", nil, false
+	}
+
+	summary, err := b.Summarize(strings.Join(blocks, "\n\n"), limit)
+	if err != nil {
+		log.Printf("Не удалось сжать разделы %v, они будут обрезаны: %v", names, err)
+		return "", nil, false
+	}
+
+	block := title + strings.TrimSpace(summary)
+	kept := EstimateTokens(block)
+	if kept > remaining {
+		return "", nil, false
+	}
+
+	// Весь объем сводки относим к первому разделу, чтобы сумма Kept совпадала с Used
+	entries := make([]SectionReport, len(overflow))
+	for i, s := range overflow {
+		entries[i] = SectionReport{Name: s.Name, Tokens: EstimateTokens(blocks[i]), Action: ActionSummarized}
+	}
+	entries[0].Kept = kept
+	return block, entries, true
+}
+
+// fit обрезает раздел под остаток бюджета или отбрасывает его, если места почти не осталось
+func fit(name, block string, remaining int) (string, SectionReport) {
+	entry := SectionReport{Name: name, Tokens: EstimateTokens(block)}
+	if remaining < minSectionTokens {
+		entry.Action = ActionDropped
+		return "", entry
+	}
+	block = Truncate(block, remaining-EstimateTokens(truncatedMarker)) + truncatedMarker
+	entry.Action, entry.Kept = ActionTruncated, EstimateTokens(block)
+	return block, entry
+}
+
+func (s Section) block() string {
+	text := strings.TrimSpace(s.Text)
+	if text == "" {
+		return ""
+	}
+	return s.Title + ":\n" + text
+}
+
+// Truncate обрезает текст так, чтобы его оценка не превышала maxTokens.
+// Результат всегда является началом исходной строки.
+func Truncate(s string, maxTokens int) string {
+	if maxTokens <= 0 {
+		return ""
+	}
+	cost := 0
+	for i, r := range s {
+		if r < utf8.RuneSelf {
+			cost++
+		} else {
+			cost += 2
+		}
+		if (cost+3)/4 > maxTokens {
+			return strings.TrimRight(s[:i], " \t\n")
+		}
+	}
+	return s
+}
+
+// TaskSections раскладывает задачу Jira на разделы контекста. Комментарии идут от новых
+// к старым, так что при нехватке места первыми отбрасываются самые старые.
+func TaskSections(task jira.JiraTask) []Section {
+	sections := []Section{
+		{Name: "summary", Title: "Задача " + task.Key, Text: task.Fields.Summary, Priority: PrioritySummary},
+		{Name: "description", Title: "Описание", Text: task.Fields.Description.Markdown(), Priority: PriorityDescription},
+	}
+
+	comments := task.Fields.Comment.Comments
+	for i := len(comments) - 1; i >= 0; i-- {
+		c := comments[i]
+		sections = append(sections, Section{
+			Name:     fmt.Sprintf("comment-%d", i+1),
+			Title:    fmt.Sprintf("Комментарий %s (%s)", c.Author.DisplayName, c.Created),
+			Text:     c.Body.Markdown(),
+			Priority: PriorityComments,
+		})
+	}
+
+	var links []string
+	for _, l := range task.Fields.IssueLinks {
+		relation, issue := l.Type.Outward, l.OutwardIssue
+		if issue == nil {
+			relation, issue = l.Type.Inward, l.InwardIssue
+		}
+		if issue == nil {
+			continue
+		}
+		links = append(links, fmt.Sprintf("- %s %s: %s [%s]", relation, issue.Key, issue.Fields.Summary, issue.Fields.Status.Name))
+	}
+	if len(links) > 0 {
+		sections = append(sections, Section{Name: "links", Title: "Связанные задачи", Text: strings.Join(links, "\n"), Priority: PriorityLinks})
+	}
+
+	return sections
+}
@@ -0,0 +1,151 @@
+package prompt
+
+import (
+	"encoding/json"
+	"jira-go/pkg/jira"
+	"strings"
+	"testing"
+)
+
+func testTask(t *testing.T, description string) jira.JiraTask {
+	var task jira.JiraTask
+	raw := `{
+		"key": "TEST-1",
+		"fields": {
+			"summary": "Login fails",
+			"description": ` + mustJSON(t, description) + `,
+			"comment": {"comments": [
+				{"author": {"displayName": "Anna"}, "body": "old comment", "created": "2024-01-01"},
+				{"author": {"displayName": "Boris"}, "body": "new comment", "created": "2024-02-01"}
+			]},
+			"issuelinks": [
+				{"type": {"name": "Blocks", "inward": "is blocked by", "outward": "blocks"}, "outwardIssue": {"key": "TEST-2", "fields": {"summary": "Release", "status": {"name": "Open"}}}},
+				{"type": {"name": "Blocks", "inward": "is blocked by", "outward": "blocks"}, "inwardIssue": {"key": "TEST-3", "fields": {"summary": "Auth service", "status": {"name": "Done"}}}}
+			]
+		}
+	}`
+	if err := json.Unmarshal([]byte(raw), &task); err != nil {
+		t.Fatalf("failed to decode fixture: %v", err)
+	}
+	return task
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected int
+	}{
+		{"", 0},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"привет", 3},
+	}
+	for _, tt := range tests {
+		if got := EstimateTokens(tt.text); got != tt.expected {
+			t.Errorf("EstimateTokens(%q) = %d, expected %d", tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestTaskSections(t *testing.T) {
+	sections := TaskSections(testTask(t, "*bold* text"))
+
+	names := []string{}
+	for _, s := range sections {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, ",") != "summary,description,comment-2,comment-1,links" {
+		t.Fatalf("unexpected sections order: %v", names)
+	}
+	if sections[1].Text != "**bold** text" {
+		t.Errorf("description should be converted to markdown, got %q", sections[1].Text)
+	}
+	if !strings.Contains(sections[2].Title, "Boris") {
+		t.Errorf("newest comment should go first, got %q", sections[2].Title)
+	}
+	links := sections[4].Text
+	if !strings.Contains(links, "blocks TEST-2: Release [Open]") || !strings.Contains(links, "is blocked by TEST-3: Auth service [Done]") {
+		t.Errorf("unexpected links section: %q", links)
+	}
+}
+
+func TestBuildFitsEverything(t *testing.T) {
+	message, report := NewBuilder(4096).Build("Что делать?", TaskSections(testTask(t, "short")))
+
+	if len(report.Dropped) != 0 {
+		t.Errorf("expected nothing dropped, got %v", report.Dropped)
+	}
+	for _, want := range []string{"Что делать?", "Задача TEST-1:\nLogin fails", "Описание:\nshort", "new comment", "old comment", "TEST-3"} {
+		if !strings.Contains(message, want) {
+			t.Errorf("expected %q in message:\n%s", want, message)
+		}
+	}
+	if report.Used > report.Budget {
+		t.Errorf("used %d tokens over budget %d", report.Used, report.Budget)
+	}
+}
+
+func TestBuildTruncatesAndDrops(t *testing.T) {
+	description := strings.Repeat("long description ", 200)
+	builder := &Builder{NumCtx: 600, AnswerReserve: 0.25}
+
+	message, report := builder.Build("Q", TaskSections(testTask(t, description)))
+
+	if report.Used > report.Budget {
+		t.Errorf("used %d tokens over budget %d", report.Used, report.Budget)
+	}
+	if !strings.Contains(message, "Login fails") {
+		t.Error("summary must always be kept")
+	}
+	if !strings.Contains(message, "…[обрезано]") {
+		t.Error("expected oversized description to be truncated")
+	}
+
+	actions := map[string]string{}
+	for _, s := range report.Sections {
+		actions[s.Name] = s.Action
+	}
+	if actions["description"] != ActionTruncated {
+		t.Errorf("expected description to be truncated, got %q", actions["description"])
+	}
+	if strings.Join(report.Dropped, ",") != "comment-2,comment-1,links" {
+		t.Errorf("unexpected dropped sections: %v", report.Dropped)
+	}
+}
+
+// Если описание не помещается, комментарии не занимают бюджет раньше него,
+// а сжимаются вместе с ним
+func TestBuildSummarizeKeepsPriority(t *testing.T) {
+	description := strings.Repeat("long description ", 200)
+	builder := &Builder{NumCtx: 600, AnswerReserve: 0.25}
+	var limit int
+	var text string
+	builder.Summarize = func(s string, maxTokens int) (string, error) {
+		text, limit = s, maxTokens
+		return "short summary", nil
+	}
+
+	message, report := builder.Build("Q", TaskSections(testTask(t, description)))
+
+	if !strings.HasPrefix(text, "Описание:") || !strings.Contains(text, "new comment") || !strings.Contains(text, "TEST-3") {
+		t.Errorf("expected description, comments and links to be summarized together:\n%s", text)
+	}
+	summaryTokens := EstimateTokens("Задача TEST-1:\nLogin fails")
+	if want := report.Budget - summaryTokens - EstimateTokens("Сводка (description, comment-2, comment-1, links):\n"); limit != want {
+		t.Errorf("expected summary limit %d, got %d", want, limit)
+	}
+	if strings.Contains(message, "Комментарий Boris") {
+		t.Errorf("comments must not be included before the description:\n%s", message)
+	}
+	if strings.Join(report.Summarized, ",") != "description,comment-2,comment-1,links" {
+		t.Errorf("unexpected summarized sections: %v", report.Summarized)
+	}
+}
@@ -0,0 +1,240 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"jira-go/models"
+	"jira-go/pkg/jira"
+	"jira-go/pkg/ollama"
+	"jira-go/pkg/prompt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Способы группировки задач в заметках о выпуске
+const (
+	GroupByComponent = "component"
+	GroupByType      = "type"
+)
+
+// systemPrompt - инструкция по умолчанию, ее можно заменить файлом release_notes.txt в prompt_dir
+const systemPrompt = "Ты помощник руководителя разработки. По списку решенных задач составь в формате Markdown " +
+	"два раздела: \"## Заметки о выпуске\" (изменения, сгруппированные так же, как во входных данных, " +
+	"понятным для пользователей языком) и \"## Черновик ретроспективы\" (что получилось, что можно улучшить, " +
+	"предлагаемые действия). Не выдумывай задачи, которых нет в списке."
+
+// Название группы для задач без компонента или типа
+const ungrouped = "Прочее"
+
+type Group struct {
+	Name   string          `json:"name"`
+	Issues []jira.JiraTask `json:"issues"`
+}
+
+type Result struct {
+	Title      string  `json:"title"`
+	Markdown   string  `json:"markdown"`
+	Wiki       string  `json:"wiki"`
+	IssueCount int     `json:"issueCount"`
+	Groups     []Group `json:"groups"`
+}
+
+// Generate просит модель составить заметки о выпуске и ретроспективу и возвращает их
+// в виде Markdown и Jira wiki; отмена ctx обрывает запрос к модели
+func Generate(ctx context.Context, OllamaHost, model, title string, issues []jira.JiraTask, groupBy string) (*Result, error) {
+	if len(issues) == 0 {
+		return nil, fmt.Errorf("нет решенных задач для выпуска %s", title)
+	}
+
+	groups := GroupIssues(issues, groupBy)
+	notes, err := ollama.SendOllamaMessageContext(ctx, OllamaHost, model, BuildMessages(title, groups), ollama.ChatOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	markdown := RenderMarkdown(title, notes, groups)
+	return &Result{
+		Title:      title,
+		Markdown:   markdown,
+		Wiki:       MarkdownToWiki(markdown),
+		IssueCount: len(issues),
+		Groups:     groups,
+	}, nil
+}
+
+// BuildJQL формирует JQL для выборки решенных задач спринта или версии
+func BuildJQL(projectKey, sprint, fixVersion string) (string, error) {
+	var conditions []string
+	if projectKey != "" {
+		conditions = append(conditions, fmt.Sprintf("project = %s", quote(projectKey)))
+	}
+
+	switch {
+	case sprint != "" && fixVersion != "":
+		return "", fmt.Errorf("укажите либо спринт, либо версию, но не оба")
+	case sprint != "":
+		conditions = append(conditions, fmt.Sprintf("sprint = %s", quote(sprint)))
+	case fixVersion != "":
+		conditions = append(conditions, fmt.Sprintf("fixVersion = %s", quote(fixVersion)))
+	default:
+		return "", fmt.Errorf("не указан спринт или версия")
+	}
+
+	conditions = append(conditions, "resolution IS NOT EMPTY")
+	return strings.Join(conditions, " AND ") + " ORDER BY issuetype, key", nil
+}
+
+// GroupIssues раскладывает задачи по компонентам или типам; задача с несколькими
+// компонентами попадает в группу первого из них
+func GroupIssues(issues []jira.JiraTask, groupBy string) []Group {
+	index := map[string]int{}
+	var groups []Group
+
+	for _, issue := range issues {
+		name := issue.Fields.IssueType.Name
+		if groupBy == GroupByComponent {
+			name = ""
+			if len(issue.Fields.Components) > 0 {
+				name = issue.Fields.Components[0].Name
+			}
+		}
+		if name == "" {
+			name = ungrouped
+		}
+
+		i, ok := index[name]
+		if !ok {
+			i = len(groups)
+			index[name] = i
+			groups = append(groups, Group{Name: name})
+		}
+		groups[i].Issues = append(groups[i].Issues, issue)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Name == ungrouped || groups[j].Name == ungrouped {
+			return groups[j].Name == ungrouped && groups[i].Name != ungrouped
+		}
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
+
+// BuildMessages готовит запрос к модели на составление заметок о выпуске и ретроспективы
+func BuildMessages(title string, groups []Group) []models.Message {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Выпуск: %s\n\n", title)
+	for _, g := range groups {
+		fmt.Fprintf(&b, "Группа: %s\n", g.Name)
+		for _, issue := range g.Issues {
+			fmt.Fprintf(&b, "- %s [%s] %s\n", issue.Key, issue.Fields.IssueType.Name, issue.Fields.Summary)
+			if desc := strings.TrimSpace(issue.Fields.Description.Markdown()); desc != "" {
+				fmt.Fprintf(&b, "  Описание: %s\n", oneLine(desc))
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	return []models.Message{
+		{
+			Role:    "system",
+			Content: prompt.System("release_notes", systemPrompt),
+		},
+		{
+			Role:    "user",
+			Content: b.String(),
+		},
+	}
+}
+
+// RenderMarkdown собирает итоговый документ: текст модели и справочный список задач по группам
+func RenderMarkdown(title, notes string, groups []Group) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	b.WriteString(strings.TrimSpace(notes))
+	b.WriteString("\n\n## Список задач\n")
+	for _, g := range groups {
+		fmt.Fprintf(&b, "\n### %s\n\n", g.Name)
+		for _, issue := range g.Issues {
+			fmt.Fprintf(&b, "- **%s** %s\n", issue.Key, issue.Fields.Summary)
+		}
+	}
+	return b.String()
+}
+
+var (
+	mdHeading = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	mdBullet  = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	mdOrdered = regexp.MustCompile(`^(\s*)\d+[.)]\s+(.*)$`)
+	mdBold    = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	mdItalic  = regexp.MustCompile(`(^|[^*])\*([^*\s][^*]*?)\*`)
+	mdCode    = regexp.MustCompile("`([^`]+)`")
+	mdLink    = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
+)
+
+// MarkdownToWiki переводит Markdown в разметку Jira wiki, пригодную для вставки в задачу или Confluence
+func MarkdownToWiki(md string) string {
+	var out []string
+	inCode := false
+
+	for _, line := range strings.Split(md, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if inCode {
+				out = append(out, "{code}")
+			} else if lang := strings.TrimPrefix(strings.TrimSpace(line), "```"); lang != "" {
+				out = append(out, "{code:"+lang+"}")
+			} else {
+				out = append(out, "{code}")
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			out = append(out, line)
+			continue
+		}
+
+		switch {
+		case mdHeading.MatchString(line):
+			m := mdHeading.FindStringSubmatch(line)
+			out = append(out, fmt.Sprintf("h%d. %s", len(m[1]), inlineToWiki(m[2])))
+		case mdBullet.MatchString(line):
+			m := mdBullet.FindStringSubmatch(line)
+			out = append(out, strings.Repeat("*", listDepth(m[1]))+" "+inlineToWiki(m[2]))
+		case mdOrdered.MatchString(line):
+			m := mdOrdered.FindStringSubmatch(line)
+			out = append(out, strings.Repeat("#", listDepth(m[1]))+" "+inlineToWiki(m[2]))
+		default:
+			out = append(out, inlineToWiki(line))
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func inlineToWiki(s string) string {
+	s = mdCode.ReplaceAllString(s, "{{$1}}")
+	s = mdLink.ReplaceAllString(s, "[$1|$2]")
+	s = mdBold.ReplaceAllString(s, "\x00$1\x00")
+	s = mdItalic.ReplaceAllString(s, "${1}_${2}_")
+	return strings.ReplaceAll(s, "\x00", "*")
+}
+
+func listDepth(indent string) int {
+	return len(strings.ReplaceAll(indent, "\t", "  "))/2 + 1
+}
+
+// jqlEscaper экранирует обратную косую черту и кавычки внутри строки JQL
+var jqlEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func quote(s string) string {
+	return `"` + jqlEscaper.Replace(s) + `"`
+}
+
+func oneLine(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > 300 {
+		s = string(r[:300]) + "…"
+	}
+	return s
+}
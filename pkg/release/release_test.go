@@ -0,0 +1,151 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"jira-go/pkg/jira"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testIssues(t *testing.T) []jira.JiraTask {
+	var issues []jira.JiraTask
+	err := json.Unmarshal([]byte(`[
+		{"key": "TEST-1", "fields": {"summary": "Fix login", "issuetype": {"name": "Bug"}, "components": [{"name": "Auth"}]}},
+		{"key": "TEST-2", "fields": {"summary": "Add export", "issuetype": {"name": "Story"}, "components": [{"name": "API"}]}},
+		{"key": "TEST-3", "fields": {"summary": "Cleanup", "issuetype": {"name": "Task"}}},
+		{"key": "TEST-4", "fields": {"summary": "Token refresh", "issuetype": {"name": "Story"}, "components": [{"name": "Auth"}]}}
+	]`), &issues)
+	if err != nil {
+		t.Fatalf("failed to decode fixture: %v", err)
+	}
+	return issues
+}
+
+func TestBuildJQL(t *testing.T) {
+	tests := []struct {
+		name        string
+		project     string
+		sprint      string
+		fixVersion  string
+		expected    string
+		expectError bool
+	}{
+		{
+			name:       "Fix version with project",
+			project:    "TEST",
+			fixVersion: "1.2.0",
+			expected:   `project = "TEST" AND fixVersion = "1.2.0" AND resolution IS NOT EMPTY ORDER BY issuetype, key`,
+		},
+		{
+			name:     "Sprint without project",
+			sprint:   `Sprint "42"`,
+			expected: `sprint = "Sprint \"42\"" AND resolution IS NOT EMPTY ORDER BY issuetype, key`,
+		},
+		{
+			name:       "Backslash in version",
+			fixVersion: `v1\`,
+			expected:   `fixVersion = "v1\\" AND resolution IS NOT EMPTY ORDER BY issuetype, key`,
+		},
+		{
+			name:        "Both sprint and version",
+			sprint:      "1",
+			fixVersion:  "1.0",
+			expectError: true,
+		},
+		{
+			name:        "Neither sprint nor version",
+			project:     "TEST",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jql, err := BuildJQL(tt.project, tt.sprint, tt.fixVersion)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if jql != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, jql)
+			}
+		})
+	}
+}
+
+func TestGroupIssues(t *testing.T) {
+	issues := testIssues(t)
+
+	byComponent := GroupIssues(issues, GroupByComponent)
+	names := []string{}
+	for _, g := range byComponent {
+		names = append(names, g.Name)
+	}
+	if strings.Join(names, ",") != "API,Auth,Прочее" {
+		t.Errorf("unexpected component groups: %v", names)
+	}
+	if len(byComponent[1].Issues) != 2 {
+		t.Errorf("expected 2 issues in Auth, got %d", len(byComponent[1].Issues))
+	}
+
+	byType := GroupIssues(issues, GroupByType)
+	if len(byType) != 3 || byType[1].Name != "Story" || len(byType[1].Issues) != 2 {
+		t.Errorf("unexpected type groups: %+v", byType)
+	}
+}
+
+func TestMarkdownToWiki(t *testing.T) {
+	md := "# Release\n\n## Notes\n- **Fixed** login in `auth`\n  - see [docs](http://example.com)\n1. first\n```go\nx := *y*\n```"
+	expected := "h1. Release\n\nh2. Notes\n* *Fixed* login in {{auth}}\n** see [docs|http://example.com]\n# first\n{code:go}\nx := *y*\n{code}"
+
+	if got := MarkdownToWiki(md); got != expected {
+		t.Errorf("unexpected wiki markup:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Messages) != 2 || !strings.Contains(req.Messages[1].Content, "TEST-4") {
+			t.Errorf("prompt does not contain issues: %+v", req.Messages)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": map[string]interface{}{
+				"content": "## Заметки о выпуске\n- **Auth**: вход исправлен",
+			},
+		})
+	}))
+	defer server.Close()
+
+	result, err := Generate(context.Background(), server.URL, "test-model", "TEST: 1.0", testIssues(t), GroupByType)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.IssueCount != 4 {
+		t.Errorf("expected 4 issues, got %d", result.IssueCount)
+	}
+	if !strings.Contains(result.Markdown, "### Story") || !strings.Contains(result.Markdown, "- **TEST-2** Add export") {
+		t.Errorf("markdown is missing issue list: %s", result.Markdown)
+	}
+	if !strings.Contains(result.Wiki, "h2. Заметки о выпуске") || !strings.Contains(result.Wiki, "* *TEST-2* Add export") {
+		t.Errorf("wiki is missing converted content: %s", result.Wiki)
+	}
+
+	if _, err := Generate(context.Background(), server.URL, "test-model", "empty", nil, GroupByType); err == nil {
+		t.Error("expected error for empty issue list")
+	}
+}
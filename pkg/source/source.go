@@ -0,0 +1,107 @@
+// Package source выбирает, откуда брать задачи подключения Jira: из Jira REST API или
+// из импортированной выгрузки (jira[].import). Им пользуются и веб-интерфейс, и CLI,
+// чтобы работать с выгрузкой одинаково.
+package source
+
+import (
+	"context"
+	"jira-go/pkg/config"
+	"jira-go/pkg/importer"
+	"jira-go/pkg/jira"
+)
+
+// Jira - запросы к Jira REST API. По умолчанию их выполняют функции pkg/jira (REST);
+// в тестах можно подставить свою реализацию.
+type Jira interface {
+	ProjectTasks(url, token, projectKey string) (*jira.SearchResult, error)
+	Issue(url, token, key string) (*jira.JiraTask, error)
+	EpicChildren(url, token, epicKey string) ([]jira.JiraTask, error)
+	Search(url, token, jql string) ([]jira.JiraTask, error)
+	Myself(ctx context.Context, url, token string) (*jira.User, error)
+}
+
+// REST - запросы к Jira REST API через pkg/jira
+type REST struct{}
+
+func (REST) ProjectTasks(url, token, projectKey string) (*jira.SearchResult, error) {
+	return jira.GetJiraTask(url, token, projectKey)
+}
+
+func (REST) Issue(url, token, key string) (*jira.JiraTask, error) {
+	return jira.GetIssue(url, token, key)
+}
+
+func (REST) EpicChildren(url, token, epicKey string) ([]jira.JiraTask, error) {
+	return jira.GetEpicChildren(url, token, epicKey)
+}
+
+func (REST) Search(url, token, jql string) ([]jira.JiraTask, error) {
+	return jira.SearchIssues(url, token, jql)
+}
+
+func (REST) Myself(ctx context.Context, url, token string) (*jira.User, error) {
+	return jira.GetMyselfContext(ctx, url, token)
+}
+
+// Source - задачи одного подключения: из выгрузки, если она задана, иначе через Jira
+type Source struct {
+	Instance config.JiraInstance
+	Jira     Jira
+}
+
+// New возвращает источник задач подключения; client nil - запросы через REST
+func New(instance config.JiraInstance, client Jira) Source {
+	if client == nil {
+		client = REST{}
+	}
+	return Source{Instance: instance, Jira: client}
+}
+
+// ProjectTasks получает задачи проекта
+func (s Source) ProjectTasks(projectKey string) (*jira.SearchResult, error) {
+	if s.Instance.Offline() {
+		snapshot, err := importer.Open(s.Instance.Import)
+		if err != nil {
+			return nil, err
+		}
+		return snapshot.ProjectTasks(projectKey), nil
+	}
+	return s.Jira.ProjectTasks(s.Instance.URL, s.Instance.Token, projectKey)
+}
+
+// Issue получает задачу со всеми полями
+func (s Source) Issue(key string) (*jira.JiraTask, error) {
+	if s.Instance.Offline() {
+		snapshot, err := importer.Open(s.Instance.Import)
+		if err != nil {
+			return nil, err
+		}
+		return snapshot.Issue(key)
+	}
+	return s.Jira.Issue(s.Instance.URL, s.Instance.Token, key)
+}
+
+// EpicChildren получает задачи эпика
+func (s Source) EpicChildren(epicKey string) ([]jira.JiraTask, error) {
+	if s.Instance.Offline() {
+		snapshot, err := importer.Open(s.Instance.Import)
+		if err != nil {
+			return nil, err
+		}
+		return snapshot.EpicChildren(epicKey), nil
+	}
+	return s.Jira.EpicChildren(s.Instance.URL, s.Instance.Token, epicKey)
+}
+
+// Resolved получает решенные задачи спринта или версии: из Jira по jql
+// (см. release.BuildJQL) или из выгрузки по тем же условиям
+func (s Source) Resolved(jql, projectKey, sprint, fixVersion string) ([]jira.JiraTask, error) {
+	if s.Instance.Offline() {
+		snapshot, err := importer.Open(s.Instance.Import)
+		if err != nil {
+			return nil, err
+		}
+		return snapshot.Resolved(projectKey, sprint, fixVersion), nil
+	}
+	return s.Jira.Search(s.Instance.URL, s.Instance.Token, jql)
+}
@@ -0,0 +1,88 @@
+package source
+
+import (
+	"errors"
+	"jira-go/pkg/config"
+	"jira-go/pkg/jira"
+	"jira-go/pkg/upstream"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// recordingJira запоминает, какие запросы к Jira были сделаны
+type recordingJira struct {
+	REST
+	calls []string
+}
+
+func (r *recordingJira) ProjectTasks(url, token, projectKey string) (*jira.SearchResult, error) {
+	r.calls = append(r.calls, "ProjectTasks "+url+" "+token+" "+projectKey)
+	return &jira.SearchResult{}, nil
+}
+
+func (r *recordingJira) Issue(url, token, key string) (*jira.JiraTask, error) {
+	r.calls = append(r.calls, "Issue "+key)
+	return &jira.JiraTask{Key: key}, nil
+}
+
+func (r *recordingJira) Search(url, token, jql string) ([]jira.JiraTask, error) {
+	r.calls = append(r.calls, "Search "+jql)
+	return nil, nil
+}
+
+func TestOnline(t *testing.T) {
+	client := &recordingJira{}
+	s := New(config.JiraInstance{Name: "main", URL: "https://jira", Token: "secret"}, client)
+
+	s.ProjectTasks("PROJ")
+	s.Issue("PROJ-1")
+	s.Resolved("sprint = 5", "PROJ", "5", "")
+	want := []string{"ProjectTasks https://jira secret PROJ", "Issue PROJ-1", "Search sprint = 5"}
+	if len(client.calls) != len(want) {
+		t.Fatalf("unexpected calls %v", client.calls)
+	}
+	for i := range want {
+		if client.calls[i] != want[i] {
+			t.Errorf("call %d: expected %q, got %q", i, want[i], client.calls[i])
+		}
+	}
+
+	if _, ok := New(config.JiraInstance{}, nil).Jira.(REST); !ok {
+		t.Error("expected REST client by default")
+	}
+}
+
+func TestOffline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "issues.json")
+	export := `[
+		{"key": "OFF-1", "fields": {"summary": "Эпик", "issuetype": {"name": "Epic"}, "status": {"name": "Open"}}},
+		{"key": "OFF-2", "fields": {"summary": "Задача", "status": {"name": "Open"}, "parent": {"key": "OFF-1"}}},
+		{"key": "OFF-3", "fields": {"summary": "Готово", "status": {"name": "Done"}, "resolution": {"name": "Fixed"}, "fixVersions": [{"name": "1.0"}]}}
+	]`
+	if err := os.WriteFile(path, []byte(export), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	client := &recordingJira{}
+	s := New(config.JiraInstance{Name: "snapshot", Import: path}, client)
+
+	found, err := s.ProjectTasks("OFF")
+	if err != nil || found.Total != 2 {
+		t.Errorf("unexpected project tasks %+v: %v", found, err)
+	}
+	if task, err := s.Issue("OFF-2"); err != nil || task.Fields.Summary != "Задача" {
+		t.Errorf("unexpected issue %+v: %v", task, err)
+	}
+	if _, err := s.Issue("OFF-9"); !errors.Is(err, upstream.ErrNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+	if children, err := s.EpicChildren("OFF-1"); err != nil || len(children) != 1 || children[0].Key != "OFF-2" {
+		t.Errorf("unexpected epic children %v: %v", children, err)
+	}
+	if resolved, err := s.Resolved("ignored", "OFF", "", "1.0"); err != nil || len(resolved) != 1 || resolved[0].Key != "OFF-3" {
+		t.Errorf("unexpected resolved %v: %v", resolved, err)
+	}
+	if len(client.calls) != 0 {
+		t.Errorf("offline source must not call Jira: %v", client.calls)
+	}
+}
@@ -0,0 +1,207 @@
+package summarize
+
+import (
+	"fmt"
+	"jira-go/models"
+	"jira-go/pkg/ollama"
+	"jira-go/pkg/prompt"
+	"log"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultParallel - сколько фрагментов одновременно отправляется в модель
+	DefaultParallel = 3
+	// maxDepth ограничивает число повторных свёрток, если модель плохо сжимает текст
+	maxDepth = 3
+	// minChunkSummary - минимальный объем сводки одного фрагмента
+	minChunkSummary = 128
+)
+
+// ChatFunc отправляет сообщения в модель и возвращает ответ
+type ChatFunc func(messages []models.Message) (string, error)
+
+// Summarizer сжимает длинный текст по схеме map-reduce: текст режется на фрагменты,
+// умещающиеся в окно модели, фрагменты параллельно пересказываются, а пересказы
+// сводятся в итоговую сводку
+type Summarizer struct {
+	Chat ChatFunc
+	// ChunkTokens - размер фрагмента в токенах
+	ChunkTokens int
+	// Parallel - число одновременных запросов к модели
+	Parallel int
+}
+
+// New создает Summarizer для модели Ollama с окном контекста numCtx. Фрагмент занимает
+// половину окна, остальное остается под инструкцию и ответ.
+func New(OllamaHost, model string, numCtx int) *Summarizer {
+	return NewWithChat(func(messages []models.Message) (string, error) {
+		return ollama.SendOllamaMessage(OllamaHost, model, messages)
+	}, numCtx)
+}
+
+// NewWithChat создает Summarizer, отправляющий запросы через chat (например, через пул серверов)
+func NewWithChat(chat ChatFunc, numCtx int) *Summarizer {
+	return &Summarizer{
+		Chat:        chat,
+		ChunkTokens: numCtx / 2,
+		Parallel:    DefaultParallel,
+	}
+}
+
+// Summarize сжимает текст примерно до maxTokens токенов. Короткий текст возвращается без изменений.
+func (s *Summarizer) Summarize(text string, maxTokens int) (string, error) {
+	return s.summarize(text, maxTokens, 0)
+}
+
+func (s *Summarizer) summarize(text string, maxTokens, depth int) (string, error) {
+	if prompt.EstimateTokens(text) <= maxTokens {
+		return text, nil
+	}
+
+	chunks := Chunk(text, s.ChunkTokens)
+	log.Printf("Суммаризация: %d токенов, %d фрагментов, уровень %d", prompt.EstimateTokens(text), len(chunks), depth)
+
+	perChunk := maxTokens / len(chunks)
+	if perChunk < minChunkSummary {
+		perChunk = minChunkSummary
+	}
+
+	summaries, err := s.mapChunks(chunks, perChunk)
+	if err != nil {
+		return "", err
+	}
+	combined := strings.Join(summaries, "\n\n")
+
+	// Пересказы все еще не помещаются в одно окно - сворачиваем их еще раз
+	if prompt.EstimateTokens(combined) > s.ChunkTokens && depth < maxDepth {
+		return s.summarize(combined, maxTokens, depth+1)
+	}
+
+	result := combined
+	if len(summaries) > 1 || prompt.EstimateTokens(combined) > maxTokens {
+		result, err = s.Chat(reduceMessages(combined, maxTokens))
+		if err != nil {
+			return "", fmt.Errorf("ошибка сведения сводок: %v", err)
+		}
+	}
+
+	result = strings.TrimSpace(result)
+	if prompt.EstimateTokens(result) > maxTokens {
+		result = prompt.Truncate(result, maxTokens)
+	}
+	return result, nil
+}
+
+// mapChunks параллельно пересказывает фрагменты, сохраняя их порядок
+func (s *Summarizer) mapChunks(chunks []string, maxTokens int) ([]string, error) {
+	parallel := s.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	summaries := make([]string, len(chunks))
+	errs := make([]error, len(chunks))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func(i int, chunk string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			summary, err := s.Chat(mapMessages(chunk, i+1, len(chunks), maxTokens))
+			if err != nil {
+				errs[i] = fmt.Errorf("ошибка пересказа фрагмента %d: %v", i+1, err)
+				return
+			}
+			summaries[i] = strings.TrimSpace(summary)
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return summaries, nil
+}
+
+func mapMessages(chunk string, n, total, maxTokens int) []models.Message {
+	return []models.Message{
+		{
+			Role: "system",
+			Content: fmt.Sprintf("Ты сжимаешь фрагменты обсуждения задачи Jira. Перескажи фрагмент %d из %d "+
+				"не длиннее %d слов. Сохрани факты, решения, открытые вопросы, ключи задач и имена. "+
+				"Не добавляй вступлений и ничего не выдумывай.", n, total, wordsFor(maxTokens)),
+		},
+		{Role: "user", Content: chunk},
+	}
+}
+
+func reduceMessages(summaries string, maxTokens int) []models.Message {
+	return []models.Message{
+		{
+			Role: "system",
+			Content: fmt.Sprintf("Ниже пересказы последовательных фрагментов одной задачи Jira. Объедини их в одну "+
+				"связную сводку не длиннее %d слов, убрав повторы. Сохрани факты, решения и открытые вопросы.",
+				wordsFor(maxTokens)),
+		},
+		{Role: "user", Content: summaries},
+	}
+}
+
+// wordsFor переводит бюджет токенов в число слов для инструкции модели
+func wordsFor(tokens int) int {
+	return tokens * 2 / 3
+}
+
+// Chunk режет текст на фрагменты не больше maxTokens, стараясь не разрывать абзацы и строки
+func Chunk(text string, maxTokens int) []string {
+	if maxTokens <= 0 || prompt.EstimateTokens(text) <= maxTokens {
+		return []string{text}
+	}
+
+	var chunks []string
+	var current []string
+	currentTokens := 0
+
+	flush := func() {
+		if len(current) > 0 {
+			chunks = append(chunks, strings.Join(current, "\n"))
+			current, currentTokens = nil, 0
+		}
+	}
+
+	for _, piece := range splitPieces(text, maxTokens) {
+		tokens := prompt.EstimateTokens(piece) + 1
+		if currentTokens+tokens > maxTokens {
+			flush()
+		}
+		current = append(current, piece)
+		currentTokens += tokens
+	}
+	flush()
+	return chunks
+}
+
+// splitPieces делит текст на строки, а слишком длинные строки - на куски по maxTokens
+func splitPieces(text string, maxTokens int) []string {
+	var pieces []string
+	for _, line := range strings.Split(text, "\n") {
+		for prompt.EstimateTokens(line) > maxTokens {
+			head := prompt.Truncate(line, maxTokens)
+			if head == "" {
+				break
+			}
+			pieces = append(pieces, head)
+			line = strings.TrimSpace(line[len(head):])
+		}
+		pieces = append(pieces, line)
+	}
+	return pieces
+}
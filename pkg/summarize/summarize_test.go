@@ -0,0 +1,133 @@
+package summarize
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jira-go/models"
+	"jira-go/pkg/prompt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestChunk(t *testing.T) {
+	text := strings.Repeat("paragraph line number one\n", 40) + strings.Repeat("x", 400)
+
+	chunks := Chunk(text, 50)
+	if len(chunks) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+	for i, c := range chunks {
+		if tokens := prompt.EstimateTokens(c); tokens > 50 {
+			t.Errorf("chunk %d has %d tokens, limit 50", i, tokens)
+		}
+	}
+	if joined := strings.Join(chunks, ""); strings.Count(joined, "paragraph") != 40 || strings.Count(joined, "x") != 400 {
+		t.Error("chunks lost part of the text")
+	}
+
+	if short := Chunk("short", 50); len(short) != 1 || short[0] != "short" {
+		t.Errorf("short text should be a single chunk, got %v", short)
+	}
+}
+
+func TestSummarizeShortText(t *testing.T) {
+	s := &Summarizer{Chat: func(messages []models.Message) (string, error) {
+		t.Error("model should not be called for short text")
+		return "", nil
+	}, ChunkTokens: 100}
+
+	got, err := s.Summarize("short text", 100)
+	if err != nil || got != "short text" {
+		t.Errorf("expected text unchanged, got %q, %v", got, err)
+	}
+}
+
+func TestSummarizeMapReduce(t *testing.T) {
+	var mapCalls, reduceCalls, running, maxRunning int32
+
+	s := &Summarizer{
+		ChunkTokens: 100,
+		Parallel:    2,
+		Chat: func(messages []models.Message) (string, error) {
+			if strings.Contains(messages[0].Content, "Объедини") {
+				atomic.AddInt32(&reduceCalls, 1)
+				return "final summary", nil
+			}
+
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+
+			return fmt.Sprintf("summary %d", atomic.AddInt32(&mapCalls, 1)), nil
+		},
+	}
+
+	text := strings.Repeat("some long comment thread line\n", 100)
+	got, err := s.Summarize(text, 50)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "final summary" {
+		t.Errorf("expected reduced summary, got %q", got)
+	}
+	if int(mapCalls) != len(Chunk(text, 100)) {
+		t.Errorf("expected one map call per chunk, got %d calls for %d chunks", mapCalls, len(Chunk(text, 100)))
+	}
+	if reduceCalls != 1 {
+		t.Errorf("expected 1 reduce call, got %d", reduceCalls)
+	}
+	if maxRunning > 2 {
+		t.Errorf("expected at most 2 parallel calls, got %d", maxRunning)
+	}
+}
+
+func TestSummarizeError(t *testing.T) {
+	s := &Summarizer{ChunkTokens: 20, Parallel: 2, Chat: func(messages []models.Message) (string, error) {
+		return "", errors.New("model is down")
+	}}
+
+	if _, err := s.Summarize(strings.Repeat("word ", 200), 10); err == nil {
+		t.Error("expected error from failing model")
+	}
+}
+
+func TestBuilderWithSummarizer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": map[string]interface{}{"content": "сжатый пересказ"},
+		})
+	}))
+	defer server.Close()
+
+	builder := prompt.NewBuilder(1024)
+	builder.Summarize = New(server.URL, "test-model", 1024).Summarize
+
+	sections := []prompt.Section{
+		{Name: "summary", Title: "Задача TEST-1", Text: "Login fails", Priority: prompt.PrioritySummary},
+		{Name: "description", Title: "Описание", Text: strings.Repeat("very long description ", 300), Priority: prompt.PriorityDescription},
+		{Name: "comment-1", Title: "Комментарий", Text: strings.Repeat("long comment ", 300), Priority: prompt.PriorityComments},
+	}
+
+	message, report := builder.Build("Что делать?", sections)
+
+	if !strings.Contains(message, "Сводка (description, comment-1):\nсжатый пересказ") {
+		t.Errorf("expected summary block in message:\n%s", message)
+	}
+	if strings.Join(report.Summarized, ",") != "description,comment-1" || len(report.Dropped) != 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if report.Used > report.Budget {
+		t.Errorf("used %d tokens over budget %d", report.Used, report.Budget)
+	}
+}
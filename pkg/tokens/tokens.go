@@ -0,0 +1,201 @@
+package tokens
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// KeySize - длина ключа шифрования (AES-256)
+const KeySize = 32
+
+// Store хранит личные токены Jira пользователей в зашифрованном виде (AES-GCM).
+// Если путь не задан, токены хранятся только в памяти и теряются при перезапуске.
+type Store struct {
+	mu   sync.Mutex
+	path string
+	aead cipher.AEAD
+	// data: пользователь -> подключение Jira -> nonce и шифротекст в base64
+	data map[string]map[string]string
+}
+
+// ParseKey декодирует ключ шифрования из base64
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("ключ должен быть в base64: %v", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("ключ должен быть длиной %d байта, получено %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// NewStore открывает хранилище. Без ключа создается хранилище в памяти со случайным
+// ключом; хранить токены в файле без заданного ключа нельзя.
+func NewStore(path string, key []byte) (*Store, error) {
+	if key == nil {
+		if path != "" {
+			return nil, fmt.Errorf("для хранения токенов в файле %s нужен ключ шифрования", path)
+		}
+		key = make([]byte, KeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("ошибка генерации ключа: %v", err)
+		}
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания шифра: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания шифра: %v", err)
+	}
+
+	s := &Store{path: path, aead: aead, data: map[string]map[string]string{}}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("ошибка чтения хранилища токенов: %v", err)
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &s.data); err != nil {
+				return nil, fmt.Errorf("ошибка разбора хранилища токенов %s: %v", path, err)
+			}
+		}
+	}
+	return s, nil
+}
+
+// Set сохраняет токен пользователя для подключения Jira
+func (s *Store) Set(user, instance, token string) error {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("ошибка генерации nonce: %v", err)
+	}
+	// Пользователь и подключение входят в проверяемые данные, поэтому шифротекст
+	// нельзя переставить другому пользователю
+	sealed := s.aead.Seal(nonce, nonce, []byte(token), additionalData(user, instance))
+
+	return s.update(user, func(tokens map[string]string) {
+		tokens[instance] = base64.StdEncoding.EncodeToString(sealed)
+	})
+}
+
+// Get возвращает расшифрованный токен; ok равен false, если токен не сохранен
+func (s *Store) Get(user, instance string) (string, bool, error) {
+	s.mu.Lock()
+	encoded, ok := s.data[user][instance]
+	s.mu.Unlock()
+	if !ok {
+		return "", false, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return "", false, fmt.Errorf("поврежден токен пользователя %s для %s", user, instance)
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	token, err := s.aead.Open(nil, nonce, ciphertext, additionalData(user, instance))
+	if err != nil {
+		return "", false, fmt.Errorf("не удалось расшифровать токен пользователя %s для %s (сменился ключ?)", user, instance)
+	}
+	return string(token), true, nil
+}
+
+// Delete удаляет токен пользователя для подключения Jira
+func (s *Store) Delete(user, instance string) error {
+	return s.update(user, func(tokens map[string]string) {
+		delete(tokens, instance)
+	})
+}
+
+// Instances возвращает подключения, для которых у пользователя сохранен токен
+func (s *Store) Instances(user string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.data[user]))
+	for name := range s.data[user] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Persistent сообщает, сохраняются ли токены между перезапусками
+func (s *Store) Persistent() bool {
+	return s.path != ""
+}
+
+// update меняет токены пользователя в копии хранилища и заменяет ею текущее только
+// после записи на диск: если записать не удалось, в памяти остается прежнее состояние
+func (s *Store) update(user string, change func(tokens map[string]string)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := make(map[string]string, len(s.data[user])+1)
+	for instance, token := range s.data[user] {
+		tokens[instance] = token
+	}
+	change(tokens)
+
+	data := make(map[string]map[string]string, len(s.data)+1)
+	for name, userTokens := range s.data {
+		data[name] = userTokens
+	}
+	if len(tokens) == 0 {
+		delete(data, user)
+	} else {
+		data[user] = tokens
+	}
+
+	if err := s.save(data); err != nil {
+		return err
+	}
+	s.data = data
+	return nil
+}
+
+// save записывает хранилище через временный файл, чтобы не оставить его недописанным
+func (s *Store) save(tokens map[string]map[string]string) error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации хранилища токенов: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("ошибка создания каталога хранилища токенов: %v", err)
+	}
+	// CreateTemp создает файл с правами 0600, их и сохраняет переименование
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".tokens-*")
+	if err != nil {
+		return fmt.Errorf("ошибка записи хранилища токенов: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("ошибка записи хранилища токенов: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("ошибка записи хранилища токенов: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("ошибка записи хранилища токенов: %v", err)
+	}
+	return nil
+}
+
+func additionalData(user, instance string) []byte {
+	return []byte(user + "\x00" + instance)
+}
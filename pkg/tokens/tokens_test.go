@@ -0,0 +1,132 @@
+package tokens
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	s, err := NewStore(path, testKey(1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := s.Set("alice", "main", "alice-secret-pat"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok, _ := s.Get("bob", "main"); ok {
+		t.Error("bob must not see alice's token")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "alice-secret-pat") {
+		t.Errorf("token stored in plain text:\n%s", data)
+	}
+
+	// Токены переживают перезапуск с тем же ключом
+	reopened, err := NewStore(path, testKey(1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	token, ok, err := reopened.Get("alice", "main")
+	if err != nil || !ok || token != "alice-secret-pat" {
+		t.Errorf("Get = %q, %v, %v", token, ok, err)
+	}
+	if got := reopened.Instances("alice"); len(got) != 1 || got[0] != "main" {
+		t.Errorf("Instances = %v", got)
+	}
+
+	// С другим ключом расшифровать нельзя
+	other, err := NewStore(path, testKey(2))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, err := other.Get("alice", "main"); err == nil {
+		t.Error("expected decryption error with another key")
+	}
+
+	if err := reopened.Delete("alice", "main"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok, _ := reopened.Get("alice", "main"); ok {
+		t.Error("token not deleted")
+	}
+}
+
+// Если хранилище не удалось записать, токен не начинает действовать
+func TestStoreSaveError(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStore(filepath.Join(dir, "tokens.json"), testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("alice", "main", "old-token"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Вместо каталога - файл, поэтому записать хранилище нельзя
+	blocker := filepath.Join(dir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	s.path = filepath.Join(blocker, "tokens.json")
+
+	if err := s.Set("alice", "main", "new-token"); err == nil {
+		t.Fatal("expected save error")
+	}
+	if err := s.Set("bob", "main", "bob-token"); err == nil {
+		t.Fatal("expected save error")
+	}
+	if err := s.Delete("alice", "main"); err == nil {
+		t.Fatal("expected save error")
+	}
+	if token, ok, _ := s.Get("alice", "main"); !ok || token != "old-token" {
+		t.Errorf("failed changes must be rolled back, got %q %v", token, ok)
+	}
+	if _, ok, _ := s.Get("bob", "main"); ok {
+		t.Error("token must not be kept after a failed save")
+	}
+}
+
+func TestStoreRejectsSwappedCiphertext(t *testing.T) {
+	s, err := NewStore("", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Persistent() {
+		t.Error("store without path must not be persistent")
+	}
+	if err := s.Set("alice", "main", "alice-pat"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Шифротекст чужого пользователя не расшифровывается
+	s.data["bob"] = map[string]string{"main": s.data["alice"]["main"]}
+	if _, _, err := s.Get("bob", "main"); err == nil {
+		t.Error("expected error for ciphertext of another user")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	if _, err := ParseKey(base64.StdEncoding.EncodeToString(testKey(1))); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := ParseKey("c2hvcnQ="); err == nil {
+		t.Error("expected error for short key")
+	}
+	if _, err := NewStore("tokens.json", nil); err == nil {
+		t.Error("expected error for file store without key")
+	}
+}
@@ -0,0 +1,158 @@
+// Package upstream описывает ошибки внешних сервисов (Jira, Ollama). Клиенты возвращают
+// *Error с кодом и телом ответа, а вид ошибки проверяется через errors.Is по ErrUnauthorized,
+// ErrNotFound и т.д., так что обработчики могут ответить подходящим статусом.
+package upstream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	// ErrUnauthorized - сервис не принял токен или у него нет прав (401, 403)
+	ErrUnauthorized = errors.New("нет доступа")
+	// ErrNotFound - запрошенный объект не найден (404)
+	ErrNotFound = errors.New("не найдено")
+	// ErrBadRequest - сервис отклонил запрос, например неверный JQL или несуществующий проект (400)
+	ErrBadRequest = errors.New("запрос отклонен")
+	// ErrRateLimited - сервис ограничил частоту запросов (429)
+	ErrRateLimited = errors.New("превышен лимит запросов")
+	// ErrModelNotFound - на сервере Ollama нет запрошенной модели
+	ErrModelNotFound = errors.New("модель не найдена")
+	// ErrUpstreamUnavailable - сервис не ответил или ответил 502/503/504
+	ErrUpstreamUnavailable = errors.New("сервис недоступен")
+)
+
+// maxBody - сколько байт тела ответа сохраняется в ошибке
+const maxBody = 1024
+
+// Error - ошибка запроса к внешнему сервису
+type Error struct {
+	// Service - имя сервиса для сообщений: "Jira" или "Ollama"
+	Service string
+	// Status - HTTP-статус ответа; 0, если ответа не было
+	Status int
+	// Messages - сообщения об ошибке из тела ответа (errorMessages и errors у Jira, error у Ollama)
+	Messages []string
+	// Body - начало тела ответа
+	Body string
+	// RetryAfter - заголовок Retry-After ответа 429
+	RetryAfter time.Duration
+	// Kind - вид ошибки (ErrNotFound и т.д.); nil, если статус не распознан
+	Kind error
+	// Cause - ошибка соединения, если ответа не было
+	Cause error
+}
+
+func (e *Error) Error() string {
+	if e.Status == 0 {
+		return fmt.Sprintf("сервер %s недоступен: %v", e.Service, e.Cause)
+	}
+	message := fmt.Sprintf("ошибка от %s API: %d %s", e.Service, e.Status, http.StatusText(e.Status))
+	switch {
+	case len(e.Messages) > 0:
+		message += ": " + strings.Join(e.Messages, "; ")
+	case e.Body != "":
+		message += ": " + truncate(e.Body, 200)
+	}
+	return message
+}
+
+// Unwrap позволяет проверять вид ошибки через errors.Is и исходную ошибку соединения через errors.As
+func (e *Error) Unwrap() []error {
+	var errs []error
+	for _, err := range []error{e.Kind, e.Cause} {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// FromResponse создает ошибку по ответу сервиса с неуспешным статусом; body - прочитанное тело ответа
+func FromResponse(service string, resp *http.Response, body []byte) *Error {
+	e := &Error{
+		Service:  service,
+		Status:   resp.StatusCode,
+		Messages: decodeMessages(body),
+		Body:     strings.TrimSpace(truncate(string(body), maxBody)),
+	}
+	switch resp.StatusCode {
+	case http.StatusBadRequest:
+		e.Kind = ErrBadRequest
+	case http.StatusUnauthorized, http.StatusForbidden:
+		e.Kind = ErrUnauthorized
+	case http.StatusNotFound:
+		e.Kind = ErrNotFound
+	case http.StatusTooManyRequests:
+		e.Kind = ErrRateLimited
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			e.RetryAfter = time.Duration(seconds) * time.Second
+		}
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		e.Kind = ErrUpstreamUnavailable
+	}
+	return e
+}
+
+// Unavailable оборачивает ошибку соединения с сервисом (отказ, таймаут, DNS)
+func Unavailable(service string, err error) *Error {
+	return &Error{Service: service, Kind: ErrUpstreamUnavailable, Cause: err}
+}
+
+// As возвращает *Error из цепочки ошибок
+func As(err error) (*Error, bool) {
+	var e *Error
+	ok := errors.As(err, &e)
+	return e, ok
+}
+
+// decodeMessages извлекает сообщения из тела ошибки: Jira отвечает
+// {"errorMessages": [...], "errors": {"поле": "сообщение"}}, Ollama - {"error": "..."}
+func decodeMessages(body []byte) []string {
+	var decoded struct {
+		ErrorMessages []string          `json:"errorMessages"`
+		Errors        map[string]string `json:"errors"`
+		Error         string            `json:"error"`
+	}
+	if json.Unmarshal(body, &decoded) != nil {
+		return nil
+	}
+
+	var messages []string
+	for _, message := range decoded.ErrorMessages {
+		if message = strings.TrimSpace(message); message != "" {
+			messages = append(messages, message)
+		}
+	}
+	fields := make([]string, 0, len(decoded.Errors))
+	for field := range decoded.Errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		messages = append(messages, field+": "+decoded.Errors[field])
+	}
+	if decoded.Error != "" {
+		messages = append(messages, decoded.Error)
+	}
+	return messages
+}
+
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "…"
+}
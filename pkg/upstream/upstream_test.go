@@ -0,0 +1,61 @@
+package upstream
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFromResponse(t *testing.T) {
+	tests := []struct {
+		status int
+		kind   error
+	}{
+		{http.StatusBadRequest, ErrBadRequest},
+		{http.StatusUnauthorized, ErrUnauthorized},
+		{http.StatusForbidden, ErrUnauthorized},
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusTooManyRequests, ErrRateLimited},
+		{http.StatusBadGateway, ErrUpstreamUnavailable},
+		{http.StatusGatewayTimeout, ErrUpstreamUnavailable},
+		{http.StatusInternalServerError, nil},
+	}
+	for _, tt := range tests {
+		e := FromResponse("Jira", &http.Response{StatusCode: tt.status, Header: http.Header{}}, nil)
+		if e.Kind != tt.kind {
+			t.Errorf("status %d: expected %v, got %v", tt.status, tt.kind, e.Kind)
+		}
+		if tt.kind != nil && !errors.Is(e, tt.kind) {
+			t.Errorf("status %d: errors.Is does not match %v", tt.status, tt.kind)
+		}
+	}
+
+	e := FromResponse("Ollama", &http.Response{StatusCode: http.StatusInternalServerError, Header: http.Header{}}, []byte(`{"error":"out of memory"}`))
+	if e.Error() != "ошибка от Ollama API: 500 Internal Server Error: out of memory" {
+		t.Errorf("unexpected message: %s", e.Error())
+	}
+
+	long := strings.Repeat("я", maxBody)
+	e = FromResponse("Jira", &http.Response{StatusCode: http.StatusBadGateway, Header: http.Header{}}, []byte(long))
+	if len(e.Body) > maxBody+len("…") || !strings.HasSuffix(e.Body, "я…") {
+		t.Errorf("body is not truncated on a rune boundary: %d bytes", len(e.Body))
+	}
+}
+
+func TestUnavailable(t *testing.T) {
+	cause := &url.Error{Op: "Get", URL: "http://jira", Err: errors.New("connection refused")}
+	err := error(Unavailable("Jira", cause))
+
+	if !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Error("expected ErrUpstreamUnavailable")
+	}
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		t.Error("expected connection error to be preserved")
+	}
+	if !strings.HasPrefix(err.Error(), "сервер Jira недоступен: ") {
+		t.Errorf("unexpected message: %s", err)
+	}
+}
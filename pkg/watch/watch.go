@@ -0,0 +1,67 @@
+package watch
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// Snapshot - время изменения и размер каждого файла из отслеживаемых путей
+type Snapshot map[string]string
+
+// Take снимает состояние файлов. Каталоги обходятся рекурсивно, отсутствующие пути
+// пропускаются, так что появление файла тоже считается изменением.
+func Take(paths []string) Snapshot {
+	snap := Snapshot{}
+	for _, root := range paths {
+		if root == "" {
+			continue
+		}
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				snap[path] = fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+			}
+			return nil
+		})
+	}
+	return snap
+}
+
+// Changed сообщает, отличается ли состояние файлов от прежнего
+func (s Snapshot) Changed(other Snapshot) bool {
+	if len(s) != len(other) {
+		return true
+	}
+	for path, stamp := range s {
+		if other[path] != stamp {
+			return true
+		}
+	}
+	return false
+}
+
+// Poll проверяет пути каждые interval и вызывает onChange, когда файлы меняются.
+// Список путей запрашивается заново на каждой проверке, поэтому он может зависеть
+// от перезагруженной конфигурации. Работает, пока не закрыт stop.
+func Poll(paths func() []string, interval time.Duration, stop <-chan struct{}, onChange func()) {
+	last := Take(paths())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			current := Take(paths())
+			if current.Changed(last) {
+				onChange()
+				// onChange мог поменять список путей, поэтому снимаем состояние заново
+				last = Take(paths())
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotChanged(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "sub", "index.html")
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, ".env")
+
+	before := Take([]string{dir, missing, ""})
+	if before.Changed(Take([]string{dir, missing})) {
+		t.Error("expected no change without modifications")
+	}
+
+	if err := os.WriteFile(file, []byte("version 2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	afterEdit := Take([]string{dir, missing})
+	if !afterEdit.Changed(before) {
+		t.Error("expected edited file to be detected")
+	}
+
+	if err := os.WriteFile(missing, []byte("A=1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !Take([]string{dir, missing}).Changed(afterEdit) {
+		t.Error("expected new file to be detected")
+	}
+}
+
+func TestPoll(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := make(chan struct{}, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go Poll(func() []string { return []string{file} }, 10*time.Millisecond, stop, func() {
+		changes <- struct{}{}
+	})
+
+	time.Sleep(30 * time.Millisecond)
+	if err := os.WriteFile(file, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-changes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected change callback")
+	}
+}
@@ -0,0 +1,9 @@
+// static/js/csrf.js
+// Все изменяющие ajax-запросы отправляют CSRF-токен страницы в заголовке
+$.ajaxSetup({
+    beforeSend: function(xhr, settings) {
+        if (!/^(GET|HEAD|OPTIONS)$/i.test(settings.type)) {
+            xhr.setRequestHeader('X-CSRF-Token', $('meta[name="csrf-token"]').attr('content'));
+        }
+    }
+});
@@ -0,0 +1,89 @@
+// static/js/epic.js
+function getEpicReport() {
+    const epicKey = $('#epicKey').val().trim().toUpperCase();
+
+    if (!epicKey) {
+        alert('Пожалуйста, введите ключ эпика');
+        return;
+    }
+    if (!initialSelectedModel) {
+        alert('Пожалуйста, сначала выберите модель на главной странице');
+        return;
+    }
+
+    const btn = $('#epic-submit');
+    btn.prop('disabled', true).html('<span class="loading"></span> ИИ анализирует эпик...');
+    const stopQueue = watchQueue(function(text) {
+        btn.html('<span class="loading"></span> ' + (text || 'ИИ анализирует эпик...'));
+    });
+
+    $.ajax({
+        url: '/api/epic-report',
+        type: 'POST',
+        contentType: 'application/json',
+        data: JSON.stringify({ epicKey: epicKey, model: initialSelectedModel, instance: $('#jiraInstance').val() || '' }),
+        success: function(response) {
+            renderEpicReport(response.report);
+        },
+        error: function(xhr) {
+            $('#epic-report').removeClass('hidden').html(`
+                <div class="error">
+                    <i class="fas fa-exclamation-triangle"></i> Ошибка: ${escapeHtml(busyMessage(xhr))}
+                </div>
+            `);
+        },
+        complete: function() {
+            stopQueue();
+            btn.prop('disabled', false).html('<i class="fas fa-chart-line"></i> Построить сводку');
+        }
+    });
+}
+
+function renderEpicReport(report) {
+    const epic = report.epic;
+
+    let html = `
+        <div class="section">
+            <h2>${escapeHtml(epic.key)}: ${escapeHtml(epic.summary)}</h2>
+            <div class="progress-bar"><div class="progress-fill" style="width: ${report.progress}%"></div></div>
+            <div style="display: flex; gap: 20px;">
+                ${statCard(report.progress + '%', 'Прогресс')}
+                ${statCard(report.done, 'Готово')}
+                ${statCard(report.inProgress, 'В работе')}
+                ${statCard(report.toDo, 'Не начато')}
+            </div>
+        </div>
+        <div class="two-columns">
+            <div class="section">${itemList('fa-ban', 'Блокеры', report.blockers, it => it.reason)}</div>
+            <div class="section">${itemList('fa-hourglass-half', 'Зависшие задачи', report.stale, it => 'без обновлений ' + it.daysStale + ' дн.')}</div>
+        </div>
+        <div class="section">${itemList('fa-expand-arrows-alt', 'Добавлены после старта', report.scopeAdded, it => it.reason)}</div>
+        <div class="section">
+            <h2><i class="fas fa-robot"></i> Разбор от ${escapeHtml(report.model)}</h2>
+            <div class="epic-analysis">${escapeHtml(report.analysis)}</div>
+        </div>
+    `;
+
+    $('#epic-report').removeClass('hidden').html(html);
+}
+
+function statCard(value, label) {
+    return `
+        <div class="stat-card">
+            <div class="stat-number">${escapeHtml(String(value))}</div>
+            <div class="stat-label">${label}</div>
+        </div>
+    `;
+}
+
+function itemList(icon, title, items, detail) {
+    let html = `<h2><i class="fas ${icon}"></i> ${title} <span>${items.length}</span></h2>`;
+    if (items.length === 0) {
+        return html + '<p>Нет</p>';
+    }
+    html += '<ul class="epic-items">';
+    items.forEach(it => {
+        html += `<li><strong>${escapeHtml(it.key)}</strong> ${escapeHtml(it.summary)} <em>(${escapeHtml(detail(it))})</em></li>`;
+    });
+    return html + '</ul>';
+}
@@ -0,0 +1,17 @@
+// exportTasks скачивает текущий список задач с ответами ИИ в выбранном формате и столбцах
+function exportTasks() {
+    const columns = $('input[name="exportColumn"]:checked').map(function() {
+        return $(this).val();
+    }).get();
+    if (columns.length === 0) {
+        alert('Выберите хотя бы один столбец');
+        return;
+    }
+
+    const params = new URLSearchParams({
+        format: $('#exportFormat').val(),
+        columns: columns.join(',')
+    });
+    // Файл отдается с Content-Disposition: attachment, страница остается на месте
+    window.location.href = '/api/v1/export?' + params.toString();
+}
@@ -17,11 +17,12 @@ function getTasks() {
         url: '/get-tasks',
         type: 'POST',
         contentType: 'application/json',
-        data: JSON.stringify({ projectKey: projectKey }),
+        data: JSON.stringify({ projectKey: projectKey, instance: selectedJiraInstance() }),
         success: function(response) {
             if (response.success) {
-                updateTasksList(response.tasks);
-                $('#tasks-count').text(response.count);
+                updateTasksList(response.tasks, response);
+                // Если Jira нашла больше задач, чем получено, показываем "N из M"
+                $('#tasks-count').text(response.partial ? response.count + ' из ' + response.total : response.count);
                 // После успешного получения задач фокусируемся на них
                 setTimeout(function() {
                     focusOnTasks();
@@ -46,33 +47,42 @@ function getTasks() {
     });
 }
 
-function updateTasksList(tasks) {
+// updateTasksList выводит задачи; search - ответ сервера с total, partial и jql
+function updateTasksList(tasks, search) {
     console.log('Получены задачи:', tasks);
+    search = search || {};
     
     let html = '';
+    if (search.partial) {
+        html += `<div class="tasks-note">Показаны ${search.count} из ${search.total} найденных задач</div>`;
+    }
     if (tasks && tasks.length > 0) {
         tasks.forEach(task => {
             // Правильно извлекаем данные из структуры Jira
             const key = escapeHtml(task.key || '');
+            // Ключи задач уникальны только внутри одного подключения Jira
+            const ref = escapeHtml((task.instance || '') + '/' + (task.key || ''));
+            const instance = task.instance ? `<span class="task-instance">${escapeHtml(task.instance)}</span> ` : '';
             const summary = escapeHtml(task.fields?.summary || '');
             const status = escapeHtml(task.fields?.status?.name || 'Неизвестен');
             const priority = escapeHtml(task.fields?.priority?.name || 'Не указан');
             const assignee = escapeHtml(task.fields?.assignee?.displayName || 'Не назначена');
-            const description = escapeHtml(task.fields?.description || 'Описание отсутствует');
+            // descriptionHtml приходит с сервера уже очищенным от небезопасной разметки
+            const description = task.descriptionHtml || escapeHtml('Описание отсутствует');
             
             html += `
                 <div class="task-card">
-                    <h3>${key}: ${summary}</h3>
+                    <h3>${instance}${key}: ${summary}</h3>
                     <div class="task-info">
                         <p><strong>Статус:</strong> ${status}</p>
                         <p><strong>Приоритет:</strong> ${priority}</p>
                         <p><strong>Назначена:</strong> ${assignee}</p>
                     </div>
-                    <p class="task-description">${description}</p>
+                    <div class="task-description">${description}</div>
                     <div class="task-actions">
                         <label class="task-select">
-                            <input type="radio" name="selectedTask" value="${key}" 
-                                   onchange="selectTaskForAI('${key}')">
+                            <input type="radio" name="selectedTask" value="${ref}" 
+                                   onchange="selectTaskForAI('${ref}')">
                             Выбрать для ИИ
                         </label>
                     </div>
@@ -80,15 +90,38 @@ function updateTasksList(tasks) {
             `;
         });
     } else {
-        html = '<div class="error">Задачи не найдены</div>';
+        // Пустой проект - не ошибка: показываем, по какому запросу искали
+        const jql = search.jql ? `<p class="hint">Запрос: <code>${escapeHtml(search.jql)}</code></p>` : '';
+        html = `
+            <div class="tasks-empty">
+                <i class="fas fa-inbox"></i>
+                <p>Задачи не найдены: в проекте нет незакрытых задач, созданных за последнюю неделю.</p>
+                ${jql}
+            </div>
+        `;
     }
     $('#tasks-list').html(html);
 }
 
+// Выбранная задача хранится как "подключение/КЛЮЧ"
 let selectedTaskKey = '';
 
-function selectTaskForAI(taskKey) {
-    selectedTaskKey = taskKey;
-    console.log('Выбрана задача для ИИ:', taskKey);
+function selectTaskForAI(taskRef) {
+    selectedTaskKey = taskRef;
+    console.log('Выбрана задача для ИИ:', taskRef);
     updateAIMessageWithTask();
+}
+
+// selectedJiraInstance возвращает выбранное подключение Jira; пустое значение - подключение по умолчанию
+function selectedJiraInstance() {
+    return $('#jiraInstance').val() || '';
+}
+
+// splitTaskRef разбирает "подключение/КЛЮЧ" на части для запроса к серверу
+function splitTaskRef(taskRef) {
+    const i = taskRef.lastIndexOf('/');
+    if (i < 0) {
+        return { instance: '', taskKey: taskRef };
+    }
+    return { instance: taskRef.slice(0, i), taskKey: taskRef.slice(i + 1) };
 }
\ No newline at end of file
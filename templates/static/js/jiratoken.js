@@ -0,0 +1,62 @@
+// static/js/jiratoken.js
+// Личные токены Jira: запросы к Jira выполняются с токеном вошедшего пользователя
+
+$(document).ready(function() {
+    if ($('#jira-token').length > 0) {
+        loadJiraTokens();
+    }
+});
+
+function loadJiraTokens() {
+    $.get('/api/jira-token')
+        .done(function(data) {
+            const list = $('#jira-token-list').empty();
+            data.tokens.forEach(function(t) {
+                const status = t.configured
+                    ? '<i class="fas fa-check"></i> сохранен'
+                    : '<i class="fas fa-exclamation-triangle"></i> не указан';
+                const remove = t.configured
+                    ? ` <button type="button" class="btn-link" onclick="deleteJiraToken('${escapeHtml(t.instance)}')">удалить</button>`
+                    : '';
+                list.append(`<li class="${t.configured ? 'configured' : 'missing'}">${escapeHtml(t.instance)}: ${status}${remove}</li>`);
+            });
+            if (!data.persistent) {
+                list.append('<li class="hint">Токены хранятся до перезапуска сервиса</li>');
+            }
+        })
+        .fail(function(xhr) {
+            console.error('Ошибка загрузки токенов Jira:', xhr.responseText);
+        });
+}
+
+function saveJiraToken() {
+    const token = $('#jiraToken').val().trim();
+    if (!token) {
+        return;
+    }
+
+    $.ajax({
+        url: '/api/jira-token',
+        method: 'POST',
+        contentType: 'application/json',
+        data: JSON.stringify({ instance: $('#jiraTokenInstance').val() || '', token: token })
+    })
+        .done(function(data) {
+            $('#jiraToken').val('');
+            alert('Токен сохранен, пользователь Jira: ' + (data.jiraUser.displayName || data.jiraUser.name));
+            loadJiraTokens();
+        })
+        .fail(function(xhr) {
+            alert('Ошибка: ' + xhr.responseText);
+        });
+}
+
+function deleteJiraToken(instance) {
+    $.ajax({ url: '/api/jira-token?instance=' + encodeURIComponent(instance), method: 'DELETE' })
+        .done(function() {
+            loadJiraTokens();
+        })
+        .fail(function(xhr) {
+            alert('Ошибка: ' + xhr.responseText);
+        });
+}
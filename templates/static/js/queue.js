@@ -0,0 +1,27 @@
+// static/js/queue.js
+// Пока запрос ждет места у модели, показываем позицию в очереди
+
+// watchQueue опрашивает /api/queue и передает в onUpdate текст о месте в очереди
+// (пустая строка - запрос уже выполняется). Возвращает функцию остановки опроса.
+function watchQueue(onUpdate) {
+    const timer = setInterval(function() {
+        $.get('/api/queue').done(function(data) {
+            if (data.waiting.length === 0) {
+                onUpdate('');
+                return;
+            }
+            const first = data.waiting[0];
+            onUpdate(`В очереди к ${escapeHtml(first.key)}: место ${first.position} из ${first.queued}`);
+        });
+    }, 2000);
+    return function() { clearInterval(timer); };
+}
+
+// busyMessage поясняет ответ 429: очередь заполнена или превышен лимит запросов
+function busyMessage(xhr) {
+    if (xhr.status !== 429) {
+        return xhr.responseText || 'Неизвестная ошибка';
+    }
+    const retry = xhr.getResponseHeader('Retry-After');
+    return 'Сервер занят: ' + (xhr.responseText || 'очередь заполнена') + (retry ? ` (повторите через ${retry} с)` : '');
+}
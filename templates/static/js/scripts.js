@@ -104,15 +104,21 @@ function sendToAI() {
 
     $('#ai-response').removeClass('hidden').html('<div class="loading"></div> ИИ анализирует...');
     
+     const task = splitTaskRef(selectedTaskKey || '');
      const requestData = {
         model: selectedModel,
         messages: messages,
         temperature: temperature,
-        taskKey: selectedTaskKey || ''
+        taskKey: task.taskKey,
+        instance: task.instance
     };
 
     console.log('Отправка данных:', requestData);
 
+    const stopQueue = watchQueue(function(text) {
+        $('#ai-response').html('<div class="loading"></div> ' + (text || 'ИИ анализирует...'));
+    });
+
     $.ajax({
         url: '/send-to-ai',
         type: 'POST',
@@ -123,6 +129,7 @@ function sendToAI() {
                 <div class="success">
                     <h4><i class="fas fa-robot"></i> Ответ от ${selectedModel}:</h4>
                     <p>${response.answer || 'Нет ответа'}</p>
+                    ${contextNote(response.context)}
                 </div>
             `);
         },
@@ -130,9 +137,26 @@ function sendToAI() {
             console.error('Ошибка отправки:', xhr);
             $('#ai-response').html(`
                 <div class="error">
-                    <i class="fas fa-exclamation-triangle"></i> Ошибка: ${xhr.responseText || 'Неизвестная ошибка'}
+                    <i class="fas fa-exclamation-triangle"></i> Ошибка: ${escapeHtml(busyMessage(xhr))}
                 </div>
             `);
-        }
+        },
+        complete: stopQueue
     });
+}
+
+// Пояснение о том, какие части задачи не поместились в окно контекста модели
+function contextNote(context) {
+    if (!context || !context.sections) return '';
+
+    const truncated = context.sections.filter(s => s.action === 'truncated').map(s => s.name);
+    const summarized = context.summarized || [];
+    const dropped = context.dropped || [];
+    if (truncated.length === 0 && summarized.length === 0 && dropped.length === 0) return '';
+
+    let note = `<p class="context-note"><i class="fas fa-info-circle"></i> Контекст: ${context.used} из ${context.budget} токенов.`;
+    if (summarized.length > 0) note += ` Сжато: ${escapeHtml(summarized.join(', '))}.`;
+    if (truncated.length > 0) note += ` Обрезано: ${escapeHtml(truncated.join(', '))}.`;
+    if (dropped.length > 0) note += ` Не вошло: ${escapeHtml(dropped.join(', '))}.`;
+    return note + '</p>';
 }
\ No newline at end of file
@@ -9,6 +9,13 @@ function escapeHtml(unsafe) {
         .replace(/"/g, "&quot;")
         .replace(/'/g, "&#039;");
 }
+// Сессия истекла - отправляем на страницу входа
+$(document).ajaxError(function(event, xhr) {
+    if (xhr.status === 401) {
+        window.location.href = '/login?next=' + encodeURIComponent(window.location.pathname);
+    }
+});
+
 function refreshModels() {
     const btn = $('button').filter(function() {
         return $(this).text().includes('Обновить модели');
@@ -47,6 +54,7 @@ function updateModelsList(data) {
             const family = escapeHtml(model.details?.family || 'N/A');
             const format = escapeHtml(model.details?.format || 'N/A');
             const quantization = escapeHtml(model.details?.quantization_level || 'N/A');
+            const hosts = escapeHtml((model.hosts || []).join(', ') || 'N/A');
             
             html += `
                     <div class="model-card">
@@ -57,6 +65,7 @@ function updateModelsList(data) {
                             <p><strong>Семейство:</strong> ${family}</p>
                             <p><strong>Формат:</strong> ${format}</p>
                             <p><strong>Квантование:</strong> ${quantization}</p>
+                            <p><strong>Серверы:</strong> ${hosts}</p>
                         </div>
                         <button class="btn btn-secondary select-model-btn" data-model="${escapeHtml(modelName)}">
                             <i class="fas fa-check"></i> Выбрать